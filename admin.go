@@ -0,0 +1,593 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jamesyang124/webauthn-example/internal/aaguid"
+	"github.com/jamesyang124/webauthn-example/internal/audit"
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/jamesyang124/webauthn-example/internal/credential"
+	"github.com/jamesyang124/webauthn-example/internal/session"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/txconfirm"
+	userrepo "github.com/jamesyang124/webauthn-example/internal/user"
+	"go.uber.org/zap"
+)
+
+const adminUsage = `Usage: webauthn-example admin [-tenant ID] <command> [flags]
+
+Users belong to the tenant given by -tenant (default "default"), see TENANTS_FILE.
+
+Commands:
+  create-user         -username NAME -email EMAIL [-password-file FILE|-]
+  list-users          [-limit 50] [-offset 0] [-json]
+  credentials         -username NAME [-json]
+  revoke-credential   -username NAME -credential-id ID
+  reset-passkeys      -username NAME
+  set-roles           -username NAME -roles admin,support,auditor (empty to clear)
+  purge-challenges    [-older-than 10m]
+  export-audit        [-since RFC3339] [-output FILE]
+  authenticators      [-json]
+  set-authenticator   -aaguid UUID -name NAME [-icon URL] [-icon-dark URL]
+  unset-authenticator -aaguid UUID
+`
+
+// adminEnv carries the connections and tenant shared by the admin subcommands.
+type adminEnv struct {
+	db     *sql.DB
+	redis  *redis.Client
+	actor  string
+	tenant string
+}
+
+// adminActor identifies the operator in the audit log.
+func adminActor() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+func runAdmin(args []string) int {
+	fs := flag.NewFlagSet("admin", flag.ContinueOnError)
+	tenantID := fs.String("tenant", config.DefaultTenantID, "tenant of the users")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, adminUsage)
+		return 2
+	}
+	if err := checkTenant(*tenantID); err != nil {
+		fmt.Fprintf(os.Stderr, "admin: %v\n", err)
+		return 2
+	}
+
+	commands := map[string]func(env *adminEnv, args []string) error{
+		"create-user":         adminCreateUser,
+		"list-users":          adminListUsers,
+		"credentials":         adminCredentials,
+		"revoke-credential":   adminRevokeCredential,
+		"reset-passkeys":      adminResetPasskeys,
+		"set-roles":           adminSetRoles,
+		"purge-challenges":    adminPurgeChallenges,
+		"export-audit":        adminExportAudit,
+		"authenticators":      adminAuthenticators,
+		"set-authenticator":   adminSetAuthenticator,
+		"unset-authenticator": adminUnsetAuthenticator,
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown admin command %q\n\n%s", args[0], adminUsage)
+		return 2
+	}
+
+	if err := aaguid.Load(config.LoadAuthenticators()); err != nil {
+		zap.L().Error("Failed to load authenticator metadata", zap.Error(err))
+		return 1
+	}
+
+	database, err := openDatabase()
+	if err != nil {
+		zap.L().Error("Failed to connect to database", zap.Error(err))
+		return 1
+	}
+	defer func() {
+		if err := database.Close(); err != nil {
+			zap.L().Error("Error closing database", zap.Error(err))
+		}
+	}()
+	redisClient := openRedis()
+	defer func() {
+		if err := redisClient.Close(); err != nil {
+			zap.L().Error("Error closing redis client", zap.Error(err))
+		}
+	}()
+
+	env := &adminEnv{db: database, redis: redisClient, actor: adminActor(), tenant: *tenantID}
+	if err := command(env, args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// checkTenant fails when no configured tenant has the ID.
+func checkTenant(id string) error {
+	tenants, err := config.LoadTenants()
+	if err != nil {
+		return err
+	}
+	for _, t := range tenants {
+		if t.ID == id {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown tenant %q", id)
+}
+
+// lookupUserID resolves a username of the tenant to the users.id primary key.
+func (env *adminEnv) lookupUserID(username string) (string, error) {
+	var userID, name, createDate string
+	if _, err := userrepo.QueryUserByUsername(env.db, env.tenant, username, &userID, &name, &createDate); err != nil {
+		return "", err
+	}
+	return userID, nil
+}
+
+func requireFlag(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("-%s is required", name)
+	}
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func adminCreateUser(env *adminEnv, args []string) error {
+	fs := flag.NewFlagSet("create-user", flag.ContinueOnError)
+	username := fs.String("username", "", "username of the new user")
+	email := fs.String("email", "", "email of the new user")
+	passwordFile := fs.String("password-file", "", "file holding the initial password, - for stdin; generated when omitted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlag("username", *username); err != nil {
+		return err
+	}
+	if err := requireFlag("email", *email); err != nil {
+		return err
+	}
+	// Public registration only creates new users, so a created user signs in with the
+	// password first and enrolls a passkey from the account. It is never taken from
+	// the arguments, which other local users can read.
+	password, generated, err := initialPassword(*passwordFile)
+	if err != nil {
+		return err
+	}
+
+	userID, err := userrepo.CreateUser(env.db, env.tenant, *username, *email, password)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created user %s (id %s)\n", *username, userID)
+	if generated {
+		// Printed once; it is only stored as a hash
+		fmt.Printf("initial password: %s\n", password)
+	}
+	// Recorded after the password is printed, which a failure must not lose
+	return audit.Record(env.db, audit.Entry{
+		Actor:    env.actor,
+		Action:   audit.ActionUserCreate,
+		UserID:   userID,
+		Username: *username,
+	})
+}
+
+// initialPassword reads the password of a new user from path, or from stdin when path
+// is "-". Without a path it generates one and reports that it did.
+func initialPassword(path string) (password string, generated bool, err error) {
+	var data []byte
+	switch path {
+	case "":
+		secret := make([]byte, 18)
+		if _, err := rand.Read(secret); err != nil {
+			return "", false, fmt.Errorf("generate password: %w", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(secret), true, nil
+	case "-":
+		data, err = io.ReadAll(os.Stdin)
+	default:
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("read password: %w", err)
+	}
+	password = strings.TrimRight(string(data), "\r\n")
+	if password == "" {
+		return "", false, fmt.Errorf("password in %s is empty", path)
+	}
+	return password, false, nil
+}
+
+func adminListUsers(env *adminEnv, args []string) error {
+	fs := flag.NewFlagSet("list-users", flag.ContinueOnError)
+	limit := fs.Int("limit", 50, "maximum number of users")
+	offset := fs.Int("offset", 0, "number of users to skip")
+	asJSON := fs.Bool("json", false, "print JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	users, err := userrepo.ListUsers(env.db, env.tenant, *limit, *offset)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(users)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tEMAIL\tDISPLAY NAME\tROLES\tLOCKED\tCREDENTIALS\tCREATED AT")
+	for _, u := range users {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%t\t%d\t%s\n",
+			u.ID, u.Username, u.Email, u.DisplayName, strings.Join(u.Roles, ","),
+			u.LockedAt != nil, u.CredentialCount, u.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func adminCredentials(env *adminEnv, args []string) error {
+	fs := flag.NewFlagSet("credentials", flag.ContinueOnError)
+	username := fs.String("username", "", "owner of the credentials")
+	asJSON := fs.Bool("json", false, "print JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlag("username", *username); err != nil {
+		return err
+	}
+
+	userID, err := env.lookupUserID(*username)
+	if err != nil {
+		return err
+	}
+	credentials, err := credential.QueryCredentialsByUserID(env.db, userID)
+	if err != nil {
+		return err
+	}
+	if err := aaguid.Annotate(env.db, credentials); err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(credentials)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CREDENTIAL ID\tAUTHENTICATOR\tSIGN COUNT\tTRANSPORTS\tBACKUP\tCREATED AT\tLAST USED AT")
+	for _, c := range credentials {
+		lastUsed := "never"
+		if c.LastUsedAt != nil {
+			lastUsed = c.LastUsedAt.Format(time.RFC3339)
+		}
+		authenticator := "unknown"
+		if c.Authenticator != nil {
+			authenticator = c.Authenticator.Name
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			c.CredentialID, authenticator, c.SignCount, strings.Join(c.Transports, ","), c.BackupClass,
+			c.CreatedAt.Format(time.RFC3339), lastUsed)
+	}
+	return w.Flush()
+}
+
+func adminRevokeCredential(env *adminEnv, args []string) error {
+	fs := flag.NewFlagSet("revoke-credential", flag.ContinueOnError)
+	username := fs.String("username", "", "owner of the credential")
+	credentialID := fs.String("credential-id", "", "base64url credential ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlag("username", *username); err != nil {
+		return err
+	}
+	if err := requireFlag("credential-id", *credentialID); err != nil {
+		return err
+	}
+
+	userID, err := env.lookupUserID(*username)
+	if err != nil {
+		return err
+	}
+	result, err := credential.DeleteCredential(env.db, userID, *credentialID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("user %s has no credential %s", *username, *credentialID)
+	}
+	if err := audit.Record(env.db, audit.Entry{
+		Actor:    env.actor,
+		Action:   audit.ActionCredentialRevoke,
+		UserID:   userID,
+		Username: *username,
+		Detail:   map[string]interface{}{"credentialId": *credentialID},
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("revoked credential %s of %s\n", *credentialID, *username)
+	return nil
+}
+
+func adminResetPasskeys(env *adminEnv, args []string) error {
+	fs := flag.NewFlagSet("reset-passkeys", flag.ContinueOnError)
+	username := fs.String("username", "", "user whose passkeys are removed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlag("username", *username); err != nil {
+		return err
+	}
+
+	userID, err := env.lookupUserID(*username)
+	if err != nil {
+		return err
+	}
+
+	// The credentials, the user handle and the audit event change together
+	tx, err := env.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := credential.DeleteCredentialsByUserID(tx, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := userrepo.ClearUserWebauthnIdentity(tx, userID); err != nil {
+		return err
+	}
+	removed, _ := result.RowsAffected()
+	if err := audit.Record(tx, audit.Entry{
+		Actor:    env.actor,
+		Action:   audit.ActionPasskeysReset,
+		UserID:   userID,
+		Username: *username,
+		Detail:   map[string]interface{}{"removedCredentials": removed},
+	}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Sessions signed in with the removed passkeys, and ceremonies that would still
+	// complete against the old user handle, must not survive the reset. Discoverable
+	// ceremonies are not tied to a user; with the credentials gone they cannot complete.
+	ctx := context.Background()
+	revoked, err := session.RevokeUserSessions(ctx, env.redis, env.tenant, userID)
+	if err != nil {
+		return err
+	}
+	if err := env.redis.Del(ctx,
+		tenant.RedisKey(env.tenant, session.LoginSessionPrefix+*username),
+	).Err(); err != nil {
+		return err
+	}
+	transactions, err := txconfirm.DeletePendingOfUser(ctx, env.redis, env.tenant, userID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("removed %d credential(s) of %s, revoked %d session(s) and %d pending transaction(s)\n",
+		removed, *username, revoked, transactions)
+	return nil
+}
+
+func adminSetRoles(env *adminEnv, args []string) error {
+	fs := flag.NewFlagSet("set-roles", flag.ContinueOnError)
+	username := fs.String("username", "", "user whose roles are replaced")
+	rolesFlag := fs.String("roles", "", "comma separated roles; empty removes every role")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlag("username", *username); err != nil {
+		return err
+	}
+
+	roles := []string{}
+	for _, role := range strings.Split(*rolesFlag, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	if _, err := userrepo.ValidateRoles(roles); err != nil {
+		return err
+	}
+
+	userID, err := env.lookupUserID(*username)
+	if err != nil {
+		return err
+	}
+	if _, err := userrepo.UpdateUserRoles(env.db, userID, roles); err != nil {
+		return err
+	}
+	if err := audit.Record(env.db, audit.Entry{
+		Actor:    env.actor,
+		Action:   audit.ActionRolesSet,
+		UserID:   userID,
+		Username: *username,
+		Detail:   map[string]interface{}{"roles": roles},
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("set roles of %s to [%s]\n", *username, strings.Join(roles, ", "))
+	return nil
+}
+
+func adminPurgeChallenges(env *adminEnv, args []string) error {
+	fs := flag.NewFlagSet("purge-challenges", flag.ContinueOnError)
+	olderThan := fs.Duration("older-than", 10*time.Minute, "minimum age of the ceremony data to purge")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	transactions, err := config.LoadTransactions()
+	if err != nil {
+		return err
+	}
+	ceremonies := append(session.Ceremonies(), session.Ceremony{Prefix: txconfirm.PendingPrefix, TTL: transactions.TTL})
+	purged, err := session.PurgeStaleSessions(context.Background(), env.redis, ceremonies, *olderThan)
+	if err != nil {
+		return err
+	}
+	if err := audit.Record(env.db, audit.Entry{
+		Actor:  env.actor,
+		Action: audit.ActionChallengesPurge,
+		Detail: map[string]interface{}{"purged": purged, "olderThan": olderThan.String()},
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("purged %d stale challenge(s)\n", purged)
+	return nil
+}
+
+func adminExportAudit(env *adminEnv, args []string) error {
+	fs := flag.NewFlagSet("export-audit", flag.ContinueOnError)
+	since := fs.String("since", "", "only export events at or after this RFC 3339 time")
+	output := fs.String("output", "", "write JSON lines to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var from time.Time
+	if *since != "" {
+		parsed, err := time.Parse(time.RFC3339, *since)
+		if err != nil {
+			return fmt.Errorf("invalid -since: %w", err)
+		}
+		from = parsed
+	}
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if *output != "" {
+		var err error
+		if f, err = os.Create(*output); err != nil {
+			return err
+		}
+		w = f
+	}
+
+	count, err := audit.ExportEvents(env.db, from, w)
+	if f != nil {
+		// A failed close can lose the end of the export
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("close %s: %w", *output, closeErr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d audit event(s)\n", count)
+	return nil
+}
+
+func adminAuthenticators(env *adminEnv, args []string) error {
+	fs := flag.NewFlagSet("authenticators", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	overrides, err := aaguid.ListOverrides(env.db)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(overrides)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AAGUID\tNAME\tICON")
+	for _, o := range overrides {
+		fmt.Fprintf(w, "%s\t%s\t%t\n", o.AAGUID, o.Name, o.Icon != "" || o.IconDark != "")
+	}
+	return w.Flush()
+}
+
+func adminSetAuthenticator(env *adminEnv, args []string) error {
+	fs := flag.NewFlagSet("set-authenticator", flag.ContinueOnError)
+	id := fs.String("aaguid", "", "AAGUID of the authenticator model")
+	name := fs.String("name", "", "name shown to users")
+	icon := fs.String("icon", "", "icon URL or data URI for light backgrounds")
+	iconDark := fs.String("icon-dark", "", "icon URL or data URI for dark backgrounds")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlag("name", *name); err != nil {
+		return err
+	}
+	key, ok := aaguid.Normalize(*id)
+	if !ok {
+		return fmt.Errorf("invalid -aaguid %q", *id)
+	}
+
+	override := aaguid.Override{AAGUID: key}
+	override.Name, override.Icon, override.IconDark = *name, *icon, *iconDark
+	if _, err := aaguid.SetOverride(env.db, override); err != nil {
+		return err
+	}
+	if err := audit.Record(env.db, audit.Entry{
+		Actor:  env.actor,
+		Action: audit.ActionAuthenticatorSet,
+		Detail: map[string]interface{}{"aaguid": key, "name": *name},
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("authenticator %s is now named %q\n", key, *name)
+	return nil
+}
+
+func adminUnsetAuthenticator(env *adminEnv, args []string) error {
+	fs := flag.NewFlagSet("unset-authenticator", flag.ContinueOnError)
+	id := fs.String("aaguid", "", "AAGUID of the authenticator model")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	key, ok := aaguid.Normalize(*id)
+	if !ok {
+		return fmt.Errorf("invalid -aaguid %q", *id)
+	}
+
+	result, err := aaguid.DeleteOverride(env.db, key)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("no override for %s", key)
+	}
+	if err := audit.Record(env.db, audit.Entry{
+		Actor:  env.actor,
+		Action: audit.ActionAuthenticatorUnset,
+		Detail: map[string]interface{}{"aaguid": key},
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("removed the override of %s\n", key)
+	return nil
+}
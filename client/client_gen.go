@@ -0,0 +1,711 @@
+// Code generated by internal/openapi/clientgen from internal/openapi/openapi.json. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+var (
+	_ = json.RawMessage{}
+	_ = url.PathEscape
+)
+
+// AccountResponse is generated from the AccountResponse schema.
+type AccountResponse struct {
+	// EnrollPasskey is the user has no passkey yet; the client should offer to enroll one.
+	EnrollPasskey bool `json:"enrollPasskey"`
+	// Passkeys is the number of passkeys of the user.
+	Passkeys int64 `json:"passkeys"`
+	// PasswordLogin is whether the user may sign in with their password.
+	PasswordLogin bool   `json:"passwordLogin"`
+	Username      string `json:"username"`
+}
+
+// AuthenticateOptionsRequest is generated from the AuthenticateOptionsRequest schema.
+type AuthenticateOptionsRequest struct {
+	// Blob is the blob to write with largeBlob write, base64url encoded, at most 1024 bytes.
+	Blob string `json:"blob,omitempty"`
+	// CredentialID is the credential to write the blob to with largeBlob write.
+	CredentialID string `json:"credentialId,omitempty"`
+	// LargeBlob is reads the large blob of a credential, or writes blob to the credential named by credentialId. Needs largeBlob enabled for the tenant, and narrows allowCredentials to credentials supporting it.
+	LargeBlob string `json:"largeBlob,omitempty"`
+	Username  string `json:"username"`
+}
+
+// AuthenticateVerificationRequest is generated from the AuthenticateVerificationRequest schema.
+type AuthenticateVerificationRequest struct {
+	// Credential is the PublicKeyCredential returned by navigator.credentials.get(), serialized as JSON.
+	Credential json.RawMessage `json:"credential"`
+	Username   string          `json:"username"`
+}
+
+// AuthenticateVerificationResponse is generated from the AuthenticateVerificationResponse schema.
+type AuthenticateVerificationResponse struct {
+	Message string             `json:"message"`
+	User    *AuthenticatedUser `json:"user,omitempty"`
+}
+
+// AuthenticatedUser is generated from the AuthenticatedUser schema.
+type AuthenticatedUser struct {
+	Credentials []json.RawMessage `json:"Credentials,omitempty"`
+	DisplayName string            `json:"DisplayName,omitempty"`
+	ID          string            `json:"ID,omitempty"`
+	Name        string            `json:"Name,omitempty"`
+}
+
+// Authenticator Authenticator model resolved from the AAGUID; absent when the AAGUID is unknown
+type Authenticator struct {
+	// Icon is uRL or data URI for light backgrounds
+	Icon string `json:"icon,omitempty"`
+	// IconDark is uRL or data URI for dark backgrounds
+	IconDark string `json:"iconDark,omitempty"`
+	Name     string `json:"name"`
+}
+
+// AuthenticatorSelection is generated from the AuthenticatorSelection schema.
+type AuthenticatorSelection struct {
+	AuthenticatorAttachment string `json:"authenticatorAttachment,omitempty"`
+	RequireResidentKey      bool   `json:"requireResidentKey,omitempty"`
+	ResidentKey             string `json:"residentKey,omitempty"`
+	UserVerification        string `json:"userVerification,omitempty"`
+}
+
+// CSRFTokenResponse is generated from the CSRFTokenResponse schema.
+type CSRFTokenResponse struct {
+	CsrfToken string `json:"csrfToken"`
+}
+
+// ChangeEmailRequest is generated from the ChangeEmailRequest schema.
+type ChangeEmailRequest struct {
+	Email string `json:"email"`
+}
+
+// CreateTransactionRequest is generated from the CreateTransactionRequest schema.
+type CreateTransactionRequest struct {
+	// Description is human-readable description of the transaction, at most 4096 bytes. It is shown to auditors and hashed into the challenge.
+	Description string `json:"description"`
+	Username    string `json:"username"`
+}
+
+// CreateTransactionResponse is generated from the CreateTransactionResponse schema.
+type CreateTransactionResponse struct {
+	ExpiresAt     string              `json:"expiresAt"`
+	Options       CredentialAssertion `json:"options"`
+	TransactionID string              `json:"transactionId"`
+}
+
+// CredentialAssertion is generated from the CredentialAssertion schema.
+type CredentialAssertion struct {
+	Mediation string                            `json:"mediation,omitempty"`
+	PublicKey PublicKeyCredentialRequestOptions `json:"publicKey"`
+}
+
+// CredentialCreation is generated from the CredentialCreation schema.
+type CredentialCreation struct {
+	Mediation string                             `json:"mediation,omitempty"`
+	PublicKey PublicKeyCredentialCreationOptions `json:"publicKey"`
+}
+
+// CredentialDescriptor is generated from the CredentialDescriptor schema.
+type CredentialDescriptor struct {
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+	Type       string   `json:"type"`
+}
+
+// CredentialListResponse is generated from the CredentialListResponse schema.
+type CredentialListResponse struct {
+	Credentials []StoredCredential `json:"credentials"`
+}
+
+// CredentialParameter is generated from the CredentialParameter schema.
+type CredentialParameter struct {
+	Alg  int64  `json:"alg"`
+	Type string `json:"type"`
+}
+
+// DiscoverableVerificationRequest is generated from the DiscoverableVerificationRequest schema.
+type DiscoverableVerificationRequest struct {
+	// Credential is the PublicKeyCredential returned by navigator.credentials.get(), serialized as JSON.
+	Credential json.RawMessage `json:"credential"`
+}
+
+// EnrollPasskeyOptionsRequest is generated from the EnrollPasskeyOptionsRequest schema.
+type EnrollPasskeyOptionsRequest struct {
+	// Profile is a registration profile offered by the tenant, as in registerOptions.
+	Profile string `json:"profile,omitempty"`
+}
+
+// EnrollPasskeyVerificationRequest is generated from the EnrollPasskeyVerificationRequest schema.
+type EnrollPasskeyVerificationRequest struct {
+	// Credential is the PublicKeyCredential returned by navigator.credentials.create(), serialized as JSON.
+	Credential json.RawMessage `json:"credential"`
+}
+
+// EnrollPasskeyVerificationResponse is generated from the EnrollPasskeyVerificationResponse schema.
+type EnrollPasskeyVerificationResponse struct {
+	// CredentialID is the ID of the new credential, base64url encoded.
+	CredentialID string `json:"credentialId"`
+	Message      string `json:"message"`
+}
+
+// Error is generated from the Error schema.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// HealthResponse is generated from the HealthResponse schema.
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// MessageResponse is generated from the MessageResponse schema.
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// PasswordLoginRequest is generated from the PasswordLoginRequest schema.
+type PasswordLoginRequest struct {
+	Password string `json:"password"`
+	Username string `json:"username"`
+}
+
+// PasswordLoginResponse is generated from the PasswordLoginResponse schema.
+type PasswordLoginResponse struct {
+	// EnrollPasskey is the user has no passkey yet; the client should offer to enroll one.
+	EnrollPasskey bool   `json:"enrollPasskey"`
+	Message       string `json:"message"`
+}
+
+// PublicKeyCredentialCreationOptions is generated from the PublicKeyCredentialCreationOptions schema.
+type PublicKeyCredentialCreationOptions struct {
+	Attestation            string                  `json:"attestation,omitempty"`
+	AttestationFormats     []string                `json:"attestationFormats,omitempty"`
+	AuthenticatorSelection *AuthenticatorSelection `json:"authenticatorSelection,omitempty"`
+	Challenge              string                  `json:"challenge"`
+	ExcludeCredentials     []CredentialDescriptor  `json:"excludeCredentials,omitempty"`
+	Extensions             json.RawMessage         `json:"extensions,omitempty"`
+	Hints                  []string                `json:"hints,omitempty"`
+	PubKeyCredParams       []CredentialParameter   `json:"pubKeyCredParams,omitempty"`
+	Rp                     RelyingPartyEntity      `json:"rp"`
+	Timeout                int64                   `json:"timeout,omitempty"`
+	User                   UserEntity              `json:"user"`
+}
+
+// PublicKeyCredentialRequestOptions is generated from the PublicKeyCredentialRequestOptions schema.
+type PublicKeyCredentialRequestOptions struct {
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	Challenge        string                 `json:"challenge"`
+	Extensions       json.RawMessage        `json:"extensions,omitempty"`
+	Hints            []string               `json:"hints,omitempty"`
+	RpID             string                 `json:"rpId,omitempty"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	UserVerification string                 `json:"userVerification,omitempty"`
+}
+
+// ReadinessChecks Outcome per dependency: ok or unavailable
+type ReadinessChecks struct {
+	Postgres string `json:"postgres"`
+	Redis    string `json:"redis"`
+	Webauthn string `json:"webauthn"`
+}
+
+// ReadinessResponse is generated from the ReadinessResponse schema.
+type ReadinessResponse struct {
+	Checks ReadinessChecks `json:"checks"`
+	Status string          `json:"status"`
+}
+
+// RegisterOptionsRequest Signs up a new user. The username and email must not belong to another user of the tenant.
+type RegisterOptionsRequest struct {
+	// Displayname is the name of the user, shown by authenticators and stored with the account.
+	Displayname string `json:"displayname"`
+	Email       string `json:"email"`
+	// Profile is a registration profile offered by the tenant, such as security-key or this-device, which overrides the authenticator selection, hints and attestation of the tenant policy. Omit it to use the policy alone.
+	Profile  string `json:"profile,omitempty"`
+	Username string `json:"username"`
+}
+
+// RegisterVerificationRequest is generated from the RegisterVerificationRequest schema.
+type RegisterVerificationRequest struct {
+	// Credential is the PublicKeyCredential returned by navigator.credentials.create(), serialized as JSON.
+	Credential json.RawMessage `json:"credential"`
+}
+
+// RegisterVerificationResponse is generated from the RegisterVerificationResponse schema.
+type RegisterVerificationResponse struct {
+	Credential json.RawMessage `json:"credential,omitempty"`
+	Message    string          `json:"message"`
+	Path       string          `json:"path,omitempty"`
+	// UserID is the id of the new user.
+	UserID string `json:"userId,omitempty"`
+}
+
+// RelatedOriginsResponse is generated from the RelatedOriginsResponse schema.
+type RelatedOriginsResponse struct {
+	Origins []string `json:"origins"`
+}
+
+// RelyingPartyEntity is generated from the RelyingPartyEntity schema.
+type RelyingPartyEntity struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+// RevokeSessionsResponse is generated from the RevokeSessionsResponse schema.
+type RevokeSessionsResponse struct {
+	Message         string `json:"message"`
+	RevokedSessions int64  `json:"revokedSessions"`
+}
+
+// SetPasswordLoginRequest is generated from the SetPasswordLoginRequest schema.
+type SetPasswordLoginRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// SetPasswordLoginResponse is generated from the SetPasswordLoginResponse schema.
+type SetPasswordLoginResponse struct {
+	Message       string `json:"message"`
+	PasswordLogin bool   `json:"passwordLogin"`
+}
+
+// StepUpVerificationRequest is generated from the StepUpVerificationRequest schema.
+type StepUpVerificationRequest struct {
+	// Credential is the PublicKeyCredential returned by navigator.credentials.get(), serialized as JSON.
+	Credential json.RawMessage `json:"credential"`
+}
+
+// StepUpVerificationResponse is generated from the StepUpVerificationResponse schema.
+type StepUpVerificationResponse struct {
+	Message        string `json:"message"`
+	UserVerifiedAt string `json:"userVerifiedAt"`
+}
+
+// StoredCredential is generated from the StoredCredential schema.
+type StoredCredential struct {
+	// Aaguid is authenticator model; absent for credentials registered before it was recorded
+	Aaguid string `json:"aaguid,omitempty"`
+	// Attachment is platform or cross-platform, when the client reported it
+	Attachment      string         `json:"attachment,omitempty"`
+	AttestationType string         `json:"attestationType,omitempty"`
+	Authenticator   *Authenticator `json:"authenticator,omitempty"`
+	// BackedUpAt is when the credential was first seen backed up
+	BackedUpAt string `json:"backedUpAt,omitempty"`
+	// BackupClass is device-bound when BE is clear; otherwise synced or syncable depending on BS; unknown while BE is absent
+	BackupClass string `json:"backupClass"`
+	// BackupEligible is whether the credential can be synced; never changes. Absent for credentials registered before it was recorded, until their next login.
+	BackupEligible bool `json:"backupEligible,omitempty"`
+	// BackupState is whether the credential was backed up at the latest ceremony
+	BackupState bool   `json:"backupState"`
+	CreatedAt   string `json:"createdAt"`
+	// CredentialID is base64url credential ID
+	CredentialID string `json:"credentialId"`
+	// Discoverable is credProps.rk reported at registration; absent when the client did not report it.
+	Discoverable bool  `json:"discoverable,omitempty"`
+	ID           int64 `json:"id"`
+	// LargeBlob is whether the authenticator can store a large blob, as reported at registration.
+	LargeBlob bool `json:"largeBlob,omitempty"`
+	// LargeBlobWrittenAt is when a blob was last written to the authenticator
+	LargeBlobWrittenAt string `json:"largeBlobWrittenAt,omitempty"`
+	LastUsedAt         string `json:"lastUsedAt,omitempty"`
+	// Prf is whether the authenticator supports the prf extension.
+	Prf bool `json:"prf,omitempty"`
+	// PublicKey is base64url COSE public key
+	PublicKey string `json:"publicKey"`
+	SignCount int64  `json:"signCount"`
+	// Transports is transports reported at registration, e.g. internal, hybrid, usb
+	Transports  []string `json:"transports"`
+	UserID      int64    `json:"userId"`
+	UserPresent bool     `json:"userPresent"`
+	// UserVerified is uV flag of the latest ceremony
+	UserVerified bool `json:"userVerified"`
+}
+
+// TransactionProof is generated from the TransactionProof schema.
+type TransactionProof struct {
+	ApprovedAt string `json:"approvedAt"`
+	// AuthenticatorData is base64url authenticator data of the assertion
+	AuthenticatorData string `json:"authenticatorData"`
+	// ClientDataJSON is base64url client data of the assertion
+	ClientDataJSON string `json:"clientDataJSON"`
+	// CredentialID is base64url credential ID
+	CredentialID string `json:"credentialId"`
+	Description  string `json:"description"`
+	// Nonce is base64url nonce the challenge was derived from
+	Nonce string `json:"nonce"`
+	// Origins is origins of the relying party, related origins included, the assertion may come from
+	Origins []string `json:"origins"`
+	// PublicKey is base64url COSE public key of the credential
+	PublicKey string `json:"publicKey"`
+	RpID      string `json:"rpId"`
+	// Signature is base64url signature over the authenticator data and the SHA-256 of the client data
+	Signature     string `json:"signature"`
+	TenantID      string `json:"tenantId"`
+	TransactionID string `json:"transactionId"`
+	Username      string `json:"username"`
+}
+
+// TransactionVerificationRequest is generated from the TransactionVerificationRequest schema.
+type TransactionVerificationRequest struct {
+	// Credential is the PublicKeyCredential returned by navigator.credentials.get(), serialized as JSON.
+	Credential    json.RawMessage `json:"credential"`
+	TransactionID string          `json:"transactionId"`
+}
+
+// UserEntity is generated from the UserEntity schema.
+type UserEntity struct {
+	DisplayName string `json:"displayName"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+}
+
+// UserSearchResponse is generated from the UserSearchResponse schema.
+type UserSearchResponse struct {
+	Users []UserSummary `json:"users"`
+}
+
+// UserSummary is generated from the UserSummary schema.
+type UserSummary struct {
+	CreatedAt       string `json:"createdAt"`
+	CredentialCount int64  `json:"credentialCount"`
+	DisplayName     string `json:"displayName,omitempty"`
+	Email           string `json:"email"`
+	ID              int64  `json:"id"`
+	// LockedAt is when the account was locked; absent when unlocked
+	LockedAt string   `json:"lockedAt,omitempty"`
+	Roles    []string `json:"roles"`
+	Username string   `json:"username"`
+}
+
+// VersionResponse is generated from the VersionResponse schema.
+type VersionResponse struct {
+	Message string `json:"message"`
+	Version string `json:"version"`
+}
+
+// GetRelatedOrigins lists the origins allowed to use the relying party ID of the host.
+func (c *Client) GetRelatedOrigins(ctx context.Context) (*RelatedOriginsResponse, error) {
+	var out RelatedOriginsResponse
+	if err := c.do(ctx, http.MethodGet, "/.well-known/webauthn", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAccount describes the account of the signed-in user.
+func (c *Client) GetAccount(ctx context.Context) (*AccountResponse, error) {
+	var out AccountResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/account", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListAccountCredentials lists the credentials of the signed-in user.
+func (c *Client) ListAccountCredentials(ctx context.Context) (*CredentialListResponse, error) {
+	var out CredentialListResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/account/credentials", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAccountCredential deletes a credential of the signed-in user.
+func (c *Client) DeleteAccountCredential(ctx context.Context, credentialID string) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, http.MethodDelete, "/api/v1/account/credentials/"+url.PathEscape(credentialID), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ChangeAccountEmail changes the email of the signed-in user.
+func (c *Client) ChangeAccountEmail(ctx context.Context, body ChangeEmailRequest) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, http.MethodPut, "/api/v1/account/email", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EnrollPasskeyOptions begins the enrollment of a passkey for the signed-in user.
+func (c *Client) EnrollPasskeyOptions(ctx context.Context, body EnrollPasskeyOptionsRequest) (*CredentialCreation, error) {
+	var out CredentialCreation
+	if err := c.do(ctx, http.MethodPost, "/api/v1/account/passkeys/options", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EnrollPasskeyVerification finishes the enrollment of a passkey.
+func (c *Client) EnrollPasskeyVerification(ctx context.Context, body EnrollPasskeyVerificationRequest) (*EnrollPasskeyVerificationResponse, error) {
+	var out EnrollPasskeyVerificationResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/account/passkeys/verification", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetAccountPasswordLogin turns password sign-in of the signed-in user off or on.
+func (c *Client) SetAccountPasswordLogin(ctx context.Context, body SetPasswordLoginRequest) (*SetPasswordLoginResponse, error) {
+	var out SetPasswordLoginResponse
+	if err := c.do(ctx, http.MethodPut, "/api/v1/account/password-login", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminSearchUsers searches users by username, email or display name.
+func (c *Client) AdminSearchUsers(ctx context.Context, query url.Values) (*UserSearchResponse, error) {
+	var out UserSearchResponse
+	if err := c.do(ctx, http.MethodGet, withQuery("/api/v1/admin/users", query), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminListCredentials lists the credential metadata of a user.
+func (c *Client) AdminListCredentials(ctx context.Context, userID string) (*CredentialListResponse, error) {
+	var out CredentialListResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/admin/users/"+url.PathEscape(userID)+"/credentials", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminRevokeCredential revokes a credential of a user.
+func (c *Client) AdminRevokeCredential(ctx context.Context, userID string, credentialID string) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, http.MethodDelete, "/api/v1/admin/users/"+url.PathEscape(userID)+"/credentials/"+url.PathEscape(credentialID), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminLockUser locks an account and signs it out of every session.
+func (c *Client) AdminLockUser(ctx context.Context, userID string) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/admin/users/"+url.PathEscape(userID)+"/lock", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminRevokeSessions signs a user out of every session.
+func (c *Client) AdminRevokeSessions(ctx context.Context, userID string) (*RevokeSessionsResponse, error) {
+	var out RevokeSessionsResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/admin/users/"+url.PathEscape(userID)+"/sessions/revoke", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminUnlockUser unlocks an account.
+func (c *Client) AdminUnlockUser(ctx context.Context, userID string) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/admin/users/"+url.PathEscape(userID)+"/unlock", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetCSRFToken returns the CSRF token, issuing the csrf_token cookie when missing.
+func (c *Client) GetCSRFToken(ctx context.Context) (*CSRFTokenResponse, error) {
+	var out CSRFTokenResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/csrf", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PasswordLogin signs in with the password of the account.
+func (c *Client) PasswordLogin(ctx context.Context, body PasswordLoginRequest) (*PasswordLoginResponse, error) {
+	var out PasswordLoginResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/password/login", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateTransaction submits a transaction for a user to approve.
+func (c *Client) CreateTransaction(ctx context.Context, body CreateTransactionRequest) (*CreateTransactionResponse, error) {
+	var out CreateTransactionResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/transactions", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TransactionVerification approves a transaction.
+func (c *Client) TransactionVerification(ctx context.Context, body TransactionVerificationRequest) (*TransactionProof, error) {
+	var out TransactionProof
+	if err := c.do(ctx, http.MethodPost, "/api/v1/transactions/verification", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetTransactionProof returns the proof of an approved transaction.
+func (c *Client) GetTransactionProof(ctx context.Context, transactionID string) (*TransactionProof, error) {
+	var out TransactionProof
+	if err := c.do(ctx, http.MethodGet, "/api/v1/transactions/"+url.PathEscape(transactionID), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DiscoverableAuthenticateOptions begins a discoverable authentication ceremony for conditional mediation.
+func (c *Client) DiscoverableAuthenticateOptions(ctx context.Context) (*CredentialAssertion, error) {
+	var out CredentialAssertion
+	if err := c.do(ctx, http.MethodPost, "/api/v1/webauthn/authenticate/discoverable/options", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DiscoverableAuthenticateVerification finishes a discoverable authentication ceremony.
+func (c *Client) DiscoverableAuthenticateVerification(ctx context.Context, body DiscoverableVerificationRequest) (*AuthenticateVerificationResponse, error) {
+	var out AuthenticateVerificationResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/webauthn/authenticate/discoverable/verification", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AuthenticateOptions begins an authentication ceremony.
+func (c *Client) AuthenticateOptions(ctx context.Context, body AuthenticateOptionsRequest) (*CredentialAssertion, error) {
+	var out CredentialAssertion
+	if err := c.do(ctx, http.MethodPost, "/api/v1/webauthn/authenticate/options", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AuthenticateVerification finishes an authentication ceremony.
+func (c *Client) AuthenticateVerification(ctx context.Context, body AuthenticateVerificationRequest) (*AuthenticateVerificationResponse, error) {
+	var out AuthenticateVerificationResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/webauthn/authenticate/verification", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RegisterOptions begins the signup of a new user.
+func (c *Client) RegisterOptions(ctx context.Context, body RegisterOptionsRequest) (*CredentialCreation, error) {
+	var out CredentialCreation
+	if err := c.do(ctx, http.MethodPost, "/api/v1/webauthn/register/options", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RegisterVerification finishes the signup of a new user.
+func (c *Client) RegisterVerification(ctx context.Context, body RegisterVerificationRequest) (*RegisterVerificationResponse, error) {
+	var out RegisterVerificationResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/webauthn/register/verification", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// StepUpOptions begins a step-up ceremony for the signed-in user.
+func (c *Client) StepUpOptions(ctx context.Context) (*CredentialAssertion, error) {
+	var out CredentialAssertion
+	if err := c.do(ctx, http.MethodPost, "/api/v1/webauthn/stepup/options", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// StepUpVerification finishes a step-up ceremony.
+func (c *Client) StepUpVerification(ctx context.Context, body StepUpVerificationRequest) (*StepUpVerificationResponse, error) {
+	var out StepUpVerificationResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/webauthn/stepup/verification", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetHealth reports that the process is alive.
+func (c *Client) GetHealth(ctx context.Context) (*HealthResponse, error) {
+	var out HealthResponse
+	if err := c.do(ctx, http.MethodGet, "/healthz", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetOpenAPI returns this OpenAPI document.
+func (c *Client) GetOpenAPI(ctx context.Context) (*json.RawMessage, error) {
+	var out json.RawMessage
+	if err := c.do(ctx, http.MethodGet, "/openapi.json", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetReadiness reports whether the instance can serve requests.
+func (c *Client) GetReadiness(ctx context.Context) (*ReadinessResponse, error) {
+	var out ReadinessResponse
+	if err := c.do(ctx, http.MethodGet, "/readyz", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetVersion returns service version information.
+func (c *Client) GetVersion(ctx context.Context) (*VersionResponse, error) {
+	var out VersionResponse
+	if err := c.do(ctx, http.MethodGet, "/version", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LegacyAuthenticateOptions begins an authentication ceremony.
+//
+// Deprecated: the server marks POST /webauthn/authenticate/options as deprecated.
+func (c *Client) LegacyAuthenticateOptions(ctx context.Context, body AuthenticateOptionsRequest) (*CredentialAssertion, error) {
+	var out CredentialAssertion
+	if err := c.do(ctx, http.MethodPost, "/webauthn/authenticate/options", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LegacyAuthenticateVerification finishes an authentication ceremony.
+//
+// Deprecated: the server marks POST /webauthn/authenticate/verification as deprecated.
+func (c *Client) LegacyAuthenticateVerification(ctx context.Context, body AuthenticateVerificationRequest) (*AuthenticateVerificationResponse, error) {
+	var out AuthenticateVerificationResponse
+	if err := c.do(ctx, http.MethodPost, "/webauthn/authenticate/verification", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LegacyRegisterOptions begins the signup of a new user.
+//
+// Deprecated: the server marks POST /webauthn/register/options as deprecated.
+func (c *Client) LegacyRegisterOptions(ctx context.Context, body RegisterOptionsRequest) (*CredentialCreation, error) {
+	var out CredentialCreation
+	if err := c.do(ctx, http.MethodPost, "/webauthn/register/options", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LegacyRegisterVerification finishes the signup of a new user.
+//
+// Deprecated: the server marks POST /webauthn/register/verification as deprecated.
+func (c *Client) LegacyRegisterVerification(ctx context.Context, body RegisterVerificationRequest) (*RegisterVerificationResponse, error) {
+	var out RegisterVerificationResponse
+	if err := c.do(ctx, http.MethodPost, "/webauthn/register/verification", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jamesyang124/webauthn-example/db"
+	"github.com/jamesyang124/webauthn-example/internal/migration"
+	"github.com/jamesyang124/webauthn-example/internal/tlscert"
+	"github.com/jamesyang124/webauthn-example/internal/txconfirm"
+	"go.uber.org/zap"
+)
+
+const usage = `Usage: webauthn-example [command]
+
+Commands:
+  serve                 Start the HTTP server (default)
+  migrate up            Apply all pending migrations
+  migrate down [n]      Roll back the last n migrations (default 1)
+  migrate status        Show applied and pending migrations
+  admin <command>       User and credential operations (see "admin help")
+  devcert [flags]       Write a self-signed TLS certificate for local development
+                        (-hosts, -cert, -key, -days)
+  verify-proof [flags]  Verify a transaction proof offline
+                        (-file, default stdin)
+`
+
+// runCommand dispatches a CLI subcommand and returns the process exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(args[1:])
+	case "admin":
+		if len(args) > 1 && args[1] == "help" {
+			fmt.Print(adminUsage)
+			return 0
+		}
+		return runAdmin(args[1:])
+	case "devcert":
+		return runDevCert(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+}
+
+func newMigrationRunner(database *sql.DB) (*migration.Runner, error) {
+	return migration.NewRunner(database, db.Migrations, "migrations")
+}
+
+// migrateUp applies pending migrations, used by both the CLI and MIGRATE_ON_START.
+func migrateUp(ctx context.Context, database *sql.DB) ([]migration.Migration, error) {
+	runner, err := newMigrationRunner(database)
+	if err != nil {
+		return nil, err
+	}
+	return runner.Up(ctx)
+}
+
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	database, err := openDatabase()
+	if err != nil {
+		zap.L().Error("Failed to connect to database", zap.Error(err))
+		return 1
+	}
+	defer func() {
+		if err := database.Close(); err != nil {
+			zap.L().Error("Error closing database", zap.Error(err))
+		}
+	}()
+
+	ctx := context.Background()
+	runner, err := newMigrationRunner(database)
+	if err != nil {
+		zap.L().Error("Failed to load migrations", zap.Error(err))
+		return 1
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := runner.Up(ctx)
+		if err != nil {
+			zap.L().Error("Migration failed", zap.Error(err))
+			return 1
+		}
+		fmt.Printf("applied %d migration(s)\n", len(applied))
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "invalid step count %q\n", args[1])
+				return 2
+			}
+		}
+		rolledBack, err := runner.Down(ctx, steps)
+		if err != nil {
+			zap.L().Error("Rollback failed", zap.Error(err))
+			return 1
+		}
+		fmt.Printf("rolled back %d migration(s)\n", len(rolledBack))
+
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			zap.L().Error("Failed to read migration status", zap.Error(err))
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		if err := w.Flush(); err != nil {
+			return 1
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n\n%s", args[0], usage)
+		return 2
+	}
+	return 0
+}
+
+// runDevCert writes a self-signed certificate for WEBAUTHN_RP_ID, so that the server can
+// run over TLS on a local RP ID other than localhost.
+func runDevCert(args []string) int {
+	fs := flag.NewFlagSet("devcert", flag.ContinueOnError)
+	hosts := fs.String("hosts", "", "comma separated DNS names and IPs (default WEBAUTHN_RP_ID, localhost and 127.0.0.1)")
+	certFile := fs.String("cert", "dev-cert.pem", "certificate output file")
+	keyFile := fs.String("key", "dev-key.pem", "private key output file")
+	days := fs.Int("days", 30, "validity in days")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	names := []string{}
+	for _, host := range strings.Split(*hosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			names = append(names, host)
+		}
+	}
+	if len(names) == 0 {
+		rpID := os.Getenv("WEBAUTHN_RP_ID")
+		if rpID != "" && rpID != "localhost" {
+			names = append(names, rpID)
+		}
+		names = append(names, "localhost", "127.0.0.1")
+	}
+
+	certPEM, keyPEM, err := tlscert.GenerateSelfSigned(names, time.Duration(*days)*24*time.Hour)
+	if err != nil {
+		zap.L().Error("Failed to generate certificate", zap.Error(err))
+		return 1
+	}
+	if err := os.WriteFile(*certFile, certPEM, 0o644); err != nil {
+		zap.L().Error("Failed to write certificate", zap.Error(err))
+		return 1
+	}
+	if err := os.WriteFile(*keyFile, keyPEM, 0o600); err != nil {
+		zap.L().Error("Failed to write key", zap.Error(err))
+		return 1
+	}
+	fmt.Printf("wrote %s and %s for %s\n", *certFile, *keyFile, strings.Join(names, ", "))
+	fmt.Printf("trust %s in your browser or OS, then set TLS_CERT_FILE and TLS_KEY_FILE\n", *certFile)
+	return 0
+}
+
+// runVerifyProof checks a proof returned by the transaction API without the server, so
+// that auditors can verify it with nothing but the binary.
+func runVerifyProof(args []string) int {
+	fs := flag.NewFlagSet("verify-proof", flag.ContinueOnError)
+	file := fs.String("file", "", "proof JSON file (default stdin)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if *file == "" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read proof: %v\n", err)
+		return 1
+	}
+
+	var proof txconfirm.Proof
+	if err := json.Unmarshal(data, &proof); err != nil {
+		fmt.Fprintf(os.Stderr, "parse proof: %v\n", err)
+		return 1
+	}
+	if err := txconfirm.Verify(proof); err != nil {
+		fmt.Printf("INVALID %s: %v\n", proof.TransactionID, err)
+		return 1
+	}
+	fmt.Printf("VALID %s approved by %s at %s\n", proof.TransactionID, proof.Username, proof.ApprovedAt.Format(time.RFC3339))
+	return 0
+}
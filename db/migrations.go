@@ -0,0 +1,9 @@
+// Package db embeds the versioned SQL migrations applied by internal/migration.
+package db
+
+import "embed"
+
+// Migrations holds the files NNNN_name.up.sql and NNNN_name.down.sql under migrations/.
+//
+//go:embed migrations/*.sql
+var Migrations embed.FS
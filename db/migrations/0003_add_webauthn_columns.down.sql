@@ -0,0 +1,6 @@
+ALTER TABLE users
+DROP COLUMN IF EXISTS webauthn_user_id,
+DROP COLUMN IF EXISTS webauthn_credential_id,
+DROP COLUMN IF EXISTS webauthn_credential_public_key,
+DROP COLUMN IF EXISTS webauthn_sign_count,
+DROP COLUMN IF EXISTS webauthn_displayname;
@@ -0,0 +1,16 @@
+-- Databases created from the former db/schema.sql may still carry the
+-- legacy columns and BYTEA types, so every step is idempotent.
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS webauthn_user_id VARCHAR(100) UNIQUE,
+ADD COLUMN IF NOT EXISTS webauthn_credential_id VARCHAR(255) UNIQUE,
+ADD COLUMN IF NOT EXISTS webauthn_credential_public_key VARCHAR(255),
+ADD COLUMN IF NOT EXISTS webauthn_sign_count INTEGER,
+ADD COLUMN IF NOT EXISTS webauthn_displayname VARCHAR(100) UNIQUE;
+
+DROP INDEX IF EXISTS idx_users_webauthn_id;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS webauthn_public_key,
+DROP COLUMN IF EXISTS webauthn_id,
+ALTER COLUMN webauthn_displayname TYPE VARCHAR(100),
+ALTER COLUMN webauthn_user_id TYPE VARCHAR(100);
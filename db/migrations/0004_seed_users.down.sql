@@ -0,0 +1,4 @@
+DELETE FROM users WHERE username IN (
+    'user1', 'user2', 'user3', 'user4', 'user5',
+    'user6', 'user7', 'user8', 'user9', 'user10'
+);
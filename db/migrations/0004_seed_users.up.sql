@@ -8,4 +8,5 @@ INSERT INTO users (username, email, password_hash) VALUES
 ('user7', 'user7@example.com', crypt('password7', gen_salt('bf'))),
 ('user8', 'user8@example.com', crypt('password8', gen_salt('bf'))),
 ('user9', 'user9@example.com', crypt('password9', gen_salt('bf'))),
-('user10', 'user10@example.com', crypt('password10', gen_salt('bf')));
+('user10', 'user10@example.com', crypt('password10', gen_salt('bf')))
+ON CONFLICT DO NOTHING;
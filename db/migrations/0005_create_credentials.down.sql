@@ -0,0 +1,18 @@
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS webauthn_credential_id VARCHAR(255) UNIQUE,
+ADD COLUMN IF NOT EXISTS webauthn_credential_public_key VARCHAR(255),
+ADD COLUMN IF NOT EXISTS webauthn_sign_count INTEGER;
+
+-- Only the most recently registered credential fits back on the user row
+UPDATE users u
+SET webauthn_credential_id = c.credential_id,
+    webauthn_credential_public_key = c.public_key,
+    webauthn_sign_count = c.sign_count
+FROM (
+    SELECT DISTINCT ON (user_id) user_id, credential_id, public_key, sign_count
+    FROM credentials
+    ORDER BY user_id, created_at DESC
+) c
+WHERE u.id = c.user_id;
+
+DROP TABLE IF EXISTS credentials;
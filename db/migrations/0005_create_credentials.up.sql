@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS credentials (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id VARCHAR(255) NOT NULL UNIQUE,
+    public_key TEXT NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_credentials_user_id ON credentials(user_id);
+
+-- Move the single credential previously stored on the user row
+INSERT INTO credentials (user_id, credential_id, public_key, sign_count)
+SELECT id, webauthn_credential_id, webauthn_credential_public_key, COALESCE(webauthn_sign_count, 0)
+FROM users
+WHERE webauthn_credential_id IS NOT NULL AND webauthn_credential_public_key IS NOT NULL
+ON CONFLICT (credential_id) DO NOTHING;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS webauthn_credential_id,
+DROP COLUMN IF EXISTS webauthn_credential_public_key,
+DROP COLUMN IF EXISTS webauthn_sign_count;
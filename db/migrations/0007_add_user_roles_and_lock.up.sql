@@ -0,0 +1,3 @@
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS roles TEXT[] NOT NULL DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS locked_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,14 @@
+-- Fails when two tenants share a username, email or display name
+DROP INDEX IF EXISTS idx_users_tenant_username;
+DROP INDEX IF EXISTS idx_users_tenant_email;
+DROP INDEX IF EXISTS idx_users_tenant_webauthn_displayname;
+
+ALTER TABLE users
+ADD CONSTRAINT users_username_key UNIQUE (username),
+ADD CONSTRAINT users_email_key UNIQUE (email),
+ADD CONSTRAINT users_webauthn_displayname_key UNIQUE (webauthn_displayname);
+
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS tenant_id;
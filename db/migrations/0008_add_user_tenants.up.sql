@@ -0,0 +1,15 @@
+-- Users belong to the tenant (relying party) they registered with. Existing users
+-- move to the default tenant, and usernames and emails are only unique per tenant.
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+ALTER TABLE users
+DROP CONSTRAINT IF EXISTS users_username_key,
+DROP CONSTRAINT IF EXISTS users_email_key,
+DROP CONSTRAINT IF EXISTS users_webauthn_displayname_key;
+
+DROP INDEX IF EXISTS idx_users_email;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_username ON users(tenant_id, username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email ON users(tenant_id, email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_webauthn_displayname ON users(tenant_id, webauthn_displayname);
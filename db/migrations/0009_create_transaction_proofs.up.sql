@@ -0,0 +1,12 @@
+-- Proofs of transactions approved with a passkey. The proof document is self-contained
+-- so that it can be verified without this database; user_id only links it to the
+-- account and is kept NULL once the user is deleted.
+CREATE TABLE IF NOT EXISTS transaction_proofs (
+    transaction_id VARCHAR(64) PRIMARY KEY,
+    tenant_id VARCHAR(64) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    proof JSONB NOT NULL,
+    approved_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_proofs_user_id ON transaction_proofs(user_id);
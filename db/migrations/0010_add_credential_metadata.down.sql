@@ -0,0 +1,9 @@
+ALTER TABLE credentials
+DROP COLUMN IF EXISTS transports,
+DROP COLUMN IF EXISTS user_present,
+DROP COLUMN IF EXISTS user_verified,
+DROP COLUMN IF EXISTS backup_eligible,
+DROP COLUMN IF EXISTS backup_state,
+DROP COLUMN IF EXISTS aaguid,
+DROP COLUMN IF EXISTS attestation_type,
+DROP COLUMN IF EXISTS attachment;
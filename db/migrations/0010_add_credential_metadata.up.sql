@@ -0,0 +1,12 @@
+-- Everything the relying party learns about a credential at registration. Existing rows
+-- predate it: their BE flag is unknown (NULL) until their next login records it, and
+-- their other metadata is left empty.
+ALTER TABLE credentials
+ADD COLUMN IF NOT EXISTS transports TEXT[] NOT NULL DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS user_present BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS user_verified BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS backup_eligible BOOLEAN,
+ADD COLUMN IF NOT EXISTS backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS aaguid UUID,
+ADD COLUMN IF NOT EXISTS attestation_type VARCHAR(32) NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS attachment VARCHAR(32) NOT NULL DEFAULT '';
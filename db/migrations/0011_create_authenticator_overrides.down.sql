@@ -0,0 +1 @@
+DROP TABLE IF EXISTS authenticator_overrides;
@@ -0,0 +1,10 @@
+-- Names and icons of authenticator models that take precedence over the embedded
+-- passkey provider list and the FIDO Metadata Service, e.g. for enterprise-managed
+-- security keys. Shared by every tenant.
+CREATE TABLE IF NOT EXISTS authenticator_overrides (
+    aaguid UUID PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    icon TEXT NOT NULL DEFAULT '',
+    icon_dark TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
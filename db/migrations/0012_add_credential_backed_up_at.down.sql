@@ -0,0 +1,2 @@
+ALTER TABLE credentials
+DROP COLUMN IF EXISTS backed_up_at;
@@ -0,0 +1,6 @@
+-- When a credential was first seen backed up (BS flag set), at registration or at a
+-- later login. Credentials already backed up count from their registration.
+ALTER TABLE credentials
+ADD COLUMN IF NOT EXISTS backed_up_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE credentials SET backed_up_at = created_at WHERE backup_state AND backed_up_at IS NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE credentials
+DROP COLUMN IF EXISTS large_blob_written_at,
+DROP COLUMN IF EXISTS prf,
+DROP COLUMN IF EXISTS large_blob,
+DROP COLUMN IF EXISTS discoverable;
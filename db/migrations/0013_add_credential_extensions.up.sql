@@ -0,0 +1,8 @@
+-- Outputs of the client extensions, NULL until a client reports them: discoverable is
+-- credProps.rk, large_blob whether the authenticator can store a large blob, and prf
+-- whether it can evaluate the PRF. large_blob_written_at is the last blob write.
+ALTER TABLE credentials
+ADD COLUMN IF NOT EXISTS discoverable BOOLEAN,
+ADD COLUMN IF NOT EXISTS large_blob BOOLEAN,
+ADD COLUMN IF NOT EXISTS prf BOOLEAN,
+ADD COLUMN IF NOT EXISTS large_blob_written_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,4 @@
+-- Users who enrolled a passkey may turn password sign-in off. The flag only applies
+-- while the user has a credential, so removing the last passkey cannot lock them out.
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS password_login_disabled BOOLEAN NOT NULL DEFAULT FALSE;
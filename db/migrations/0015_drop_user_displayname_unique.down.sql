@@ -0,0 +1,2 @@
+-- Fails when two users of a tenant share a display name
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_webauthn_displayname ON users(tenant_id, webauthn_displayname);
@@ -0,0 +1,3 @@
+-- Display names are chosen at signup and, unlike usernames and emails, need not be
+-- unique: two users may well have the same name.
+DROP INDEX IF EXISTS idx_users_tenant_webauthn_displayname;
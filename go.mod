@@ -4,6 +4,7 @@ go 1.23.6
 
 require (
 	github.com/IBM/fp-go v1.0.153
+	github.com/alicebob/miniredis/v2 v2.37.0
 	github.com/fasthttp/router v1.5.4
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/go-webauthn/webauthn v0.12.1
@@ -12,6 +13,7 @@ require (
 	github.com/lib/pq v1.10.9
 	github.com/valyala/fasthttp v1.59.0
 	go.uber.org/zap v1.27.0
+	golang.org/x/crypto v0.34.0
 )
 
 require (
@@ -27,7 +29,7 @@ require (
 	github.com/savsgio/gotils v0.0.0-20240704082632-aef3928b8a38 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/x448/float16 v0.8.4 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
-	golang.org/x/crypto v0.34.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
 )
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jamesyang124/webauthn-example/internal/aaguid"
+	"github.com/jamesyang124/webauthn-example/internal/audit"
+	"github.com/jamesyang124/webauthn-example/internal/clientip"
+	"github.com/jamesyang124/webauthn-example/internal/credential"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	user "github.com/jamesyang124/webauthn-example/internal/user"
+	util "github.com/jamesyang124/webauthn-example/internal/util"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/jamesyang124/webauthn-example/middlewares"
+	"github.com/jamesyang124/webauthn-example/types"
+	"github.com/valyala/fasthttp"
+)
+
+// accountSession returns the session stored by middlewares.RequireSession or
+// middlewares.RequireRecentUV, one of which guards every account route.
+func accountSession(ctx *fasthttp.RequestCtx) *types.AuthSession {
+	authSession, _ := ctx.UserValue(middlewares.AuthSessionKey).(*types.AuthSession)
+	return authSession
+}
+
+// HandleAccountDeleteCredential deletes a credential of the signed-in user.
+func HandleAccountDeleteCredential(ctx *fasthttp.RequestCtx, db *sql.DB) {
+	authSession := accountSession(ctx)
+	credentialID, _ := ctx.UserValue("credentialId").(string)
+
+	types.NewTryIO(func() (sql.Result, error) {
+		return credential.DeleteCredential(db, authSession.UserID, credentialID)
+	}).
+		ThenBytes(func(result sql.Result) ([]byte, error) {
+			if n, _ := result.RowsAffected(); n == 0 {
+				return nil, weberror.CredentialNotFoundError("delete own credential")
+			}
+			_ = audit.Record(db, audit.Entry{
+				Actor:    "user",
+				Action:   audit.ActionCredentialDelete,
+				UserID:   authSession.UserID,
+				Username: authSession.Username,
+				IP:       clientip.IP(ctx),
+				Detail:   map[string]interface{}{"credentialId": credentialID},
+			})
+			return util.MarshalAndRespondOnError(ctx, map[string]interface{}{
+				"message": "Credential deleted",
+			})
+		}).
+		Match(respondJSON(ctx, "HandleAccountDeleteCredential"))
+}
+
+// HandleAccountChangeEmail changes the email of the signed-in user.
+func HandleAccountChangeEmail(ctx *fasthttp.RequestCtx, db *sql.DB) {
+	authSession := accountSession(ctx)
+	var (
+		requestData map[string]interface{}
+		email       string
+	)
+
+	types.NewTryIO(func() (string, error) {
+		return util.ParseJSONBody(ctx, &requestData)
+	}).
+		ThenString(func(_ string) (string, error) {
+			return user.ValidateEmail(requestData, &email)
+		}).
+		ThenSQLResult(func(_ string) (sql.Result, error) {
+			return user.UpdateUserEmail(db, tenant.From(ctx).ID, authSession.UserID, email)
+		}).
+		ThenBytes(func(_ sql.Result) ([]byte, error) {
+			_ = audit.Record(db, audit.Entry{
+				Actor:    "user",
+				Action:   audit.ActionEmailChange,
+				UserID:   authSession.UserID,
+				Username: authSession.Username,
+				IP:       clientip.IP(ctx),
+			})
+			return util.MarshalAndRespondOnError(ctx, map[string]interface{}{
+				"message": "Email changed",
+			})
+		}).
+		Match(respondJSON(ctx, "HandleAccountChangeEmail"))
+}
+
+// HandleAccount describes the account of the signed-in user: how many passkeys they have,
+// whether they may sign in with their password, and whether the client should offer to
+// enroll a passkey.
+func HandleAccount(ctx *fasthttp.RequestCtx, db *sql.DB) {
+	authSession := accountSession(ctx)
+	var login user.PasswordLogin
+
+	types.NewTryIO(func() (string, error) {
+		return user.QueryPasswordLogin(db, tenant.From(ctx).ID, authSession.Username, &login)
+	}).
+		ThenBytes(func(_ string) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, map[string]interface{}{
+				"username":      login.Username,
+				"passkeys":      login.Passkeys,
+				"passwordLogin": login.Enabled(),
+				"enrollPasskey": login.Passkeys == 0,
+			})
+		}).
+		Match(respondJSON(ctx, "HandleAccount"))
+}
+
+// HandleAccountListCredentials lists the credentials of the signed-in user, with the
+// authenticator named from the AAGUID of each.
+func HandleAccountListCredentials(ctx *fasthttp.RequestCtx, db *sql.DB) {
+	authSession := accountSession(ctx)
+
+	types.NewTryIO(func() ([]types.StoredCredential, error) {
+		return credential.QueryCredentialsByUserID(db, authSession.UserID)
+	}).
+		ThenStoredCredentials(func(credentials []types.StoredCredential) ([]types.StoredCredential, error) {
+			return credentials, aaguid.Annotate(db, credentials)
+		}).
+		ThenBytes(func(credentials []types.StoredCredential) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, map[string]interface{}{"credentials": credentials})
+		}).
+		Match(respondJSON(ctx, "HandleAccountListCredentials"))
+}
+
+// HandleAccountSetPasswordLogin turns password sign-in of the signed-in user off or back
+// on. It can only be turned off once the user has a passkey.
+func HandleAccountSetPasswordLogin(ctx *fasthttp.RequestCtx, db *sql.DB) {
+	authSession := accountSession(ctx)
+	var requestData struct {
+		Enabled *bool `json:"enabled"`
+	}
+
+	types.NewTryIO(func() (string, error) {
+		return util.ParseJSONBody(ctx, &requestData)
+	}).
+		ThenSQLResult(func(_ string) (sql.Result, error) {
+			if requestData.Enabled == nil {
+				return nil, weberror.JSONParseError(fmt.Errorf("enabled is required"))
+			}
+			return user.SetPasswordLoginDisabled(db, tenant.From(ctx).ID, authSession.UserID, !*requestData.Enabled)
+		}).
+		ThenBytes(func(result sql.Result) ([]byte, error) {
+			if n, _ := result.RowsAffected(); n == 0 {
+				return nil, weberror.PasskeyRequiredError(authSession.UserID)
+			}
+			_ = audit.Record(db, audit.Entry{
+				Actor:    "user",
+				Action:   audit.ActionPasswordLoginSet,
+				UserID:   authSession.UserID,
+				Username: authSession.Username,
+				IP:       clientip.IP(ctx),
+				Detail:   map[string]interface{}{"enabled": *requestData.Enabled},
+			})
+			return util.MarshalAndRespondOnError(ctx, map[string]interface{}{
+				"message":       "Password sign-in updated",
+				"passwordLogin": *requestData.Enabled,
+			})
+		}).
+		Match(respondJSON(ctx, "HandleAccountSetPasswordLogin"))
+}
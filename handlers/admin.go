@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jamesyang124/webauthn-example/internal/aaguid"
+	"github.com/jamesyang124/webauthn-example/internal/audit"
+	"github.com/jamesyang124/webauthn-example/internal/clientip"
+	"github.com/jamesyang124/webauthn-example/internal/credential"
+	"github.com/jamesyang124/webauthn-example/internal/session"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	user "github.com/jamesyang124/webauthn-example/internal/user"
+	util "github.com/jamesyang124/webauthn-example/internal/util"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/jamesyang124/webauthn-example/middlewares"
+	"github.com/jamesyang124/webauthn-example/types"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 200
+)
+
+// adminActor identifies the signed-in operator in the audit log.
+func adminActor(ctx *fasthttp.RequestCtx) string {
+	if authSession, ok := ctx.UserValue(middlewares.AuthSessionKey).(*types.AuthSession); ok {
+		return "admin:" + authSession.Username
+	}
+	return "admin"
+}
+
+// ensureMayManage rejects an admin action on a user holding a role the operator lacks,
+// so that support cannot lock, sign out or revoke the passkeys of an admin.
+func ensureMayManage(ctx *fasthttp.RequestCtx, userID string, roles []string) (string, error) {
+	granted, _ := ctx.UserValue(middlewares.RolesKey).([]string)
+	if !user.HasAllRoles(granted, roles...) {
+		return "", weberror.TargetPrivilegedError(operatorID(ctx), userID)
+	}
+	return userID, nil
+}
+
+func operatorID(ctx *fasthttp.RequestCtx) string {
+	if authSession, ok := ctx.UserValue(middlewares.AuthSessionKey).(*types.AuthSession); ok {
+		return authSession.UserID
+	}
+	return ""
+}
+
+// respondJSON returns the shared (onError, onSuccess) responder of a handler chain: it
+// writes the JSON result, or the error the chain failed with.
+func respondJSON(ctx *fasthttp.RequestCtx, handler string) (func(error), func([]byte)) {
+	return func(err error) {
+			if appErr, ok := err.(*weberror.AppError); ok {
+				httpErr := weberror.ToHTTPError(appErr)
+				httpErr.RespondAndLog(ctx)
+			} else {
+				ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+				ctx.SetContentType("application/json")
+				ctx.SetBodyString(`{"error": "Internal server error"}`)
+				handlerLogger(ctx).Error("Unexpected error in "+handler, zap.Error(err))
+			}
+		},
+		func(responseJSON []byte) {
+			ctx.SetContentType("application/json")
+			ctx.SetStatusCode(fasthttp.StatusOK)
+			ctx.SetBody(responseJSON)
+		}
+}
+
+// HandleAdminSearchUsers lists users matching the optional q query argument.
+func HandleAdminSearchUsers(ctx *fasthttp.RequestCtx, db *sql.DB) {
+	args := ctx.QueryArgs()
+	limit := args.GetUintOrZero("limit")
+	if limit <= 0 {
+		limit = defaultAdminPageSize
+	}
+	if limit > maxAdminPageSize {
+		limit = maxAdminPageSize
+	}
+	offset := args.GetUintOrZero("offset")
+
+	onError, onSuccess := respondJSON(ctx, "HandleAdminSearchUsers")
+	types.NewTryIO(func() ([]types.UserSummary, error) {
+		return user.SearchUsers(db, tenant.From(ctx).ID, string(args.Peek("q")), limit, offset)
+	}).
+		ThenBytes(func(users []types.UserSummary) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, map[string]interface{}{"users": users})
+		}).
+		Match(onError, onSuccess)
+}
+
+// HandleAdminListCredentials lists the credential metadata of a user.
+func HandleAdminListCredentials(ctx *fasthttp.RequestCtx, db *sql.DB) {
+	var userID string
+	var roles []string
+	var locked bool
+
+	onError, onSuccess := respondJSON(ctx, "HandleAdminListCredentials")
+	types.NewTryIO(func() (string, error) {
+		return user.ValidateUserIDParam(ctx, &userID)
+	}).
+		// Distinguish an unknown user from a user without credentials
+		ThenString(func(_ string) (string, error) {
+			return user.QueryUserAccess(db, tenant.From(ctx).ID, userID, &roles, &locked)
+		}).
+		ThenStoredCredentials(func(_ string) ([]types.StoredCredential, error) {
+			return credential.QueryCredentialsByUserID(db, userID)
+		}).
+		// Name the authenticator of each credential from its AAGUID
+		ThenStoredCredentials(func(credentials []types.StoredCredential) ([]types.StoredCredential, error) {
+			return credentials, aaguid.Annotate(db, credentials)
+		}).
+		ThenBytes(func(credentials []types.StoredCredential) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, map[string]interface{}{"credentials": credentials})
+		}).
+		Match(onError, onSuccess)
+}
+
+// HandleAdminRevokeCredential deletes a single credential of a user.
+func HandleAdminRevokeCredential(ctx *fasthttp.RequestCtx, db *sql.DB) {
+	var userID string
+	var roles []string
+	var locked bool
+	credentialID, _ := ctx.UserValue("credentialId").(string)
+
+	onError, onSuccess := respondJSON(ctx, "HandleAdminRevokeCredential")
+	types.NewTryIO(func() (string, error) {
+		return user.ValidateUserIDParam(ctx, &userID)
+	}).
+		// Only users of the tenant of the operator can be changed
+		ThenString(func(_ string) (string, error) {
+			return user.QueryUserAccess(db, tenant.From(ctx).ID, userID, &roles, &locked)
+		}).
+		ThenString(func(_ string) (string, error) {
+			return ensureMayManage(ctx, userID, roles)
+		}).
+		ThenSQLResult(func(_ string) (sql.Result, error) {
+			return credential.DeleteCredential(db, userID, credentialID)
+		}).
+		ThenBytes(func(result sql.Result) ([]byte, error) {
+			if n, _ := result.RowsAffected(); n == 0 {
+				return nil, weberror.CredentialNotFoundError("revoke credential")
+			}
+			_ = audit.Record(db, audit.Entry{
+				Actor:  adminActor(ctx),
+				Action: audit.ActionCredentialRevoke,
+				UserID: userID,
+				IP:     clientip.IP(ctx),
+				Detail: map[string]interface{}{"credentialId": credentialID},
+			})
+			return util.MarshalAndRespondOnError(ctx, map[string]interface{}{
+				"message": "Credential revoked",
+			})
+		}).
+		Match(onError, onSuccess)
+}
+
+// HandleAdminRevokeSessions signs the user out of every session.
+func HandleAdminRevokeSessions(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client) {
+	var userID string
+	var roles []string
+	var locked bool
+
+	onError, onSuccess := respondJSON(ctx, "HandleAdminRevokeSessions")
+	types.NewTryIO(func() (string, error) {
+		return user.ValidateUserIDParam(ctx, &userID)
+	}).
+		ThenString(func(_ string) (string, error) {
+			return user.QueryUserAccess(db, tenant.From(ctx).ID, userID, &roles, &locked)
+		}).
+		ThenString(func(_ string) (string, error) {
+			return ensureMayManage(ctx, userID, roles)
+		}).
+		ThenInt64(func(_ string) (int64, error) {
+			return session.RevokeUserSessions(context.Background(), redisClient, tenant.From(ctx).ID, userID)
+		}).
+		ThenBytes(func(revoked int64) ([]byte, error) {
+			_ = audit.Record(db, audit.Entry{
+				Actor:  adminActor(ctx),
+				Action: audit.ActionSessionsRevoke,
+				UserID: userID,
+				IP:     clientip.IP(ctx),
+				Detail: map[string]interface{}{"revokedSessions": revoked},
+			})
+			return util.MarshalAndRespondOnError(ctx, map[string]interface{}{
+				"message":         "Sessions revoked",
+				"revokedSessions": revoked,
+			})
+		}).
+		Match(onError, onSuccess)
+}
+
+// HandleAdminLockUser locks the account and signs it out of every session.
+func HandleAdminLockUser(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client) {
+	handleAdminSetLocked(ctx, db, redisClient, true)
+}
+
+// HandleAdminUnlockUser unlocks the account.
+func HandleAdminUnlockUser(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client) {
+	handleAdminSetLocked(ctx, db, redisClient, false)
+}
+
+func handleAdminSetLocked(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client, locked bool) {
+	var userID string
+	var roles []string
+	var wasLocked bool
+	action, message := audit.ActionUserUnlock, "Account unlocked"
+	if locked {
+		action, message = audit.ActionUserLock, "Account locked"
+	}
+
+	onError, onSuccess := respondJSON(ctx, "handleAdminSetLocked")
+	types.NewTryIO(func() (string, error) {
+		return user.ValidateUserIDParam(ctx, &userID)
+	}).
+		ThenString(func(_ string) (string, error) {
+			return user.QueryUserAccess(db, tenant.From(ctx).ID, userID, &roles, &wasLocked)
+		}).
+		ThenString(func(_ string) (string, error) {
+			// An operator locking themselves out would need another operator to recover
+			if locked && userID == operatorID(ctx) {
+				return "", weberror.SelfLockError(userID)
+			}
+			return ensureMayManage(ctx, userID, roles)
+		}).
+		ThenSQLResult(func(_ string) (sql.Result, error) {
+			return user.SetUserLocked(db, tenant.From(ctx).ID, userID, locked)
+		}).
+		ThenInt64(func(result sql.Result) (int64, error) {
+			if n, _ := result.RowsAffected(); n == 0 {
+				return 0, weberror.UserNotFoundError(fmt.Errorf("no user with id %s", userID), "set user locked")
+			}
+			if !locked {
+				return 0, nil
+			}
+			// Existing sessions must not outlive the lock
+			return session.RevokeUserSessions(context.Background(), redisClient, tenant.From(ctx).ID, userID)
+		}).
+		ThenBytes(func(revoked int64) ([]byte, error) {
+			_ = audit.Record(db, audit.Entry{
+				Actor:  adminActor(ctx),
+				Action: action,
+				UserID: userID,
+				IP:     clientip.IP(ctx),
+				Detail: map[string]interface{}{"revokedSessions": revoked},
+			})
+			return util.MarshalAndRespondOnError(ctx, map[string]interface{}{
+				"message": message,
+			})
+		}).
+		Match(onError, onSuccess)
+}
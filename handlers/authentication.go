@@ -7,14 +7,18 @@ package handlers
 
 import (
 	"database/sql"
-	"net/http"
-	"time"
 
 	_ "github.com/lib/pq" // Justify blank import: required for PostgreSQL driver registration
 
 	"github.com/go-redis/redis/v8"
+	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jamesyang124/webauthn-example/internal/audit"
+	"github.com/jamesyang124/webauthn-example/internal/clientip"
+	"github.com/jamesyang124/webauthn-example/internal/credential"
+	"github.com/jamesyang124/webauthn-example/internal/extension"
 	"github.com/jamesyang124/webauthn-example/internal/session"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
 	user "github.com/jamesyang124/webauthn-example/internal/user"
 	util "github.com/jamesyang124/webauthn-example/internal/util"
 	"github.com/jamesyang124/webauthn-example/internal/weberror"
@@ -25,13 +29,16 @@ import (
 
 // HandleAuthenticateOptions handles the WebAuthn authentication options using TryIO monad chains
 func HandleAuthenticateOptions(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client) {
+	// Users, credentials and ceremony data are scoped to the tenant of the host
+	t := tenant.From(ctx)
+
 	// Shared variables for the chain
 	var (
-		requestData                                     map[string]interface{}
-		username, userID, displayName, webauthnUserID   string
-		credentialIDEncoded, credentialPublicKeyEncoded string
-		credentialPublicKey                             []byte
-		loginResponse                                   types.BeginLoginResponse
+		requestData                                   map[string]interface{}
+		username, userID, displayName, webauthnUserID string
+		loginResponse                                 types.BeginLoginResponse
+		extensionRequest                              extension.LoginRequest
+		loginOptions                                  []webauthn.LoginOption
 	)
 
 	// Parse request JSON body into map
@@ -42,35 +49,48 @@ func HandleAuthenticateOptions(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient
 		ThenString(func(_ string) (string, error) {
 			return user.ValidateUsername(ctx, requestData, &username)
 		}).
+		// Read the large blob operation the client asks for, if any
+		ThenString(func(_ string) (string, error) {
+			return extension.ParseLoginRequest(requestData, &extensionRequest)
+		}).
 		// Query user WebAuthn data from database
-		ThenString(func(validatedUsername string) (string, error) {
+		ThenString(func(_ string) (string, error) {
 			return user.QueryUserWebauthnByUsername(
-				db, username,
+				db, t.ID, username,
 				&userID, &webauthnUserID, &displayName,
-				&credentialIDEncoded, &credentialPublicKeyEncoded,
 			)
 		}).
-		// Decode base64 encoded credential public key
-		ThenBytes(func(_ string) ([]byte, error) {
-			return util.DecodeCredentialPublicKey(
-				ctx, credentialPublicKeyEncoded,
-				&credentialPublicKey,
-			)
+		// Locked accounts cannot start a login
+		ThenString(func(_ string) (string, error) {
+			return user.EnsureUserNotLocked(db, t.ID, userID)
+		}).
+		// Query every credential registered by the user
+		ThenStoredCredentials(func(_ string) ([]types.StoredCredential, error) {
+			return credential.QueryCredentialsByUserID(db, userID)
+		}).
+		// Request the extensions of the tenant, narrowing the credentials for a large blob
+		ThenStoredCredentials(func(stored []types.StoredCredential) ([]types.StoredCredential, error) {
+			opts, err := extension.LoginOptions(t.Extensions, t.RelyingParty.ID, extensionRequest, stored)
+			if err != nil {
+				return nil, err
+			}
+			loginOptions = opts
+			return stored, nil
 		}).
-		// Decode base64 encoded credential ID
-		ThenBytes(func(pubKey []byte) ([]byte, error) {
-			return util.DecodeCredentialID(ctx, credentialIDEncoded)
+		// Decode base64 encoded credential IDs and public keys
+		ThenWebAuthnCredentials(func(stored []types.StoredCredential) ([]webauthn.Credential, error) {
+			return util.DecodeStoredCredentials(ctx, stored, nil)
 		}).
 		// Create WebAuthn user with decoded credentials
-		ThenWebAuthnUser(func(credentialID []byte) (*types.WebAuthnUser, error) {
-			return util.NewWebAuthnUserWithCredential(
+		ThenWebAuthnUser(func(credentials []webauthn.Credential) (*types.WebAuthnUser, error) {
+			return util.NewWebAuthnUserWithCredentials(
 				webauthnUserID, username, displayName,
-				credentialID, credentialPublicKey,
+				credentials,
 			)
 		}).
 		// Begin WebAuthn login process and generate options
 		ThenBeginLoginResponse(func(webAuthnUser *types.WebAuthnUser) (*types.BeginLoginResponse, error) {
-			return util.BeginLogin(ctx, webAuthnUser, &loginResponse)
+			return util.BeginLogin(ctx, webAuthnUser, &loginResponse, loginOptions...)
 		}).
 		// Marshal session data to JSON
 		ThenBytes(func(loginResponseData *types.BeginLoginResponse) ([]byte, error) {
@@ -80,8 +100,8 @@ func HandleAuthenticateOptions(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient
 		ThenBytes(func(sessionDataJSON []byte) ([]byte, error) {
 			return session.SetWebauthnSessionData(
 				ctx, redisClient,
-				"webauthn_login_session:"+username,
-				sessionDataJSON, 86400*time.Second,
+				t.RedisKey(session.LoginSessionPrefix+username),
+				sessionDataJSON, session.CeremonySessionTTL,
 			)
 		}).
 		// Marshal login options for client response
@@ -99,7 +119,7 @@ func HandleAuthenticateOptions(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient
 					ctx.SetStatusCode(fasthttp.StatusInternalServerError)
 					ctx.SetContentType("application/json")
 					ctx.SetBodyString(`{"error": "Internal server error"}`)
-					zap.L().Error(
+					handlerLogger(ctx).Error(
 						"Unexpected error in HandleAuthenticateOptions",
 						zap.Error(err),
 					)
@@ -116,15 +136,17 @@ func HandleAuthenticateOptions(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient
 
 // HandleAuthenticateVerification processes the verification of WebAuthn authentication using a TryIO monad chain
 func HandleAuthenticateVerification(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client) {
+	// Users, credentials and ceremony data are scoped to the tenant of the host
+	t := tenant.From(ctx)
 
 	var (
-		credentialID, credentialPublicKey               []byte
-		requestData                                     map[string]interface{}
-		username, userID, webauthnUserID, displayName   string
-		credentialIDEncoded, credentialPublicKeyEncoded string
-		sessionData                                     webauthn.SessionData
-		WebAuthnUser                                    types.WebAuthnUser
-		convertedRequest                                http.Request
+		requestData                                   map[string]interface{}
+		username, userID, webauthnUserID, displayName string
+		sessionData                                   webauthn.SessionData
+		WebAuthnUser                                  types.WebAuthnUser
+		userVerified                                  bool
+		parsed                                        protocol.ParsedCredentialAssertionData
+		signed                                        types.StoredCredential
 	)
 
 	types.NewTryIO(func() (string, error) {
@@ -134,7 +156,7 @@ func HandleAuthenticateVerification(ctx *fasthttp.RequestCtx, db *sql.DB, redisC
 			return user.ValidateUsername(ctx, requestData, &username)
 		}).
 		ThenString(func(_ string) (string, error) {
-			sessionKey := "webauthn_login_session:" + username
+			sessionKey := t.RedisKey(session.LoginSessionPrefix + username)
 			return session.GetWebauthnSessionData(
 				ctx, redisClient, sessionKey,
 			)
@@ -147,43 +169,59 @@ func HandleAuthenticateVerification(ctx *fasthttp.RequestCtx, db *sql.DB, redisC
 			// Marshal credential field
 			return util.MarshalAndRespondOnError(ctx, requestData["credential"])
 		}).
-		ThenHttpRequest(func(credentialData []byte) (*http.Request, error) {
-			// TODO: will refactor this later
-			ctx.Request.SetBody(credentialData)
-			return util.ConvertFastHTTPToHTTPRequest(ctx, &convertedRequest)
+		ThenString(func(credentialData []byte) (string, error) {
+			return util.ParseAssertion(ctx, credentialData, &parsed)
 		}).
-		ThenString(func(req *http.Request) (string, error) {
+		ThenString(func(_ string) (string, error) {
 			return user.QueryUserWebauthnByUsername(
-				db, username,
+				db, t.ID, username,
 				&userID, &webauthnUserID, &displayName,
-				&credentialIDEncoded, &credentialPublicKeyEncoded,
 			)
 		}).
-		ThenBytes(func(_ string) ([]byte, error) {
-			return util.DecodeCredentialID(ctx, credentialIDEncoded)
+		ThenString(func(_ string) (string, error) {
+			return user.EnsureUserNotLocked(db, t.ID, userID)
+		}).
+		ThenStoredCredentials(func(_ string) ([]types.StoredCredential, error) {
+			return credential.QueryCredentialsByUserID(db, userID)
 		}).
-		ThenBytes(func(credID []byte) ([]byte, error) {
-			credentialID = credID
-			return util.DecodeCredentialPublicKey(ctx, credentialPublicKeyEncoded, &credentialPublicKey)
+		ThenWebAuthnCredentials(func(stored []types.StoredCredential) ([]webauthn.Credential, error) {
+			return util.DecodeStoredCredentials(ctx, stored, &parsed)
 		}).
-		ThenWebAuthnUser(func(_ []byte) (*types.WebAuthnUser, error) {
-			return util.NewWebAuthnUserWithBackupEligible(
+		ThenWebAuthnUser(func(credentials []webauthn.Credential) (*types.WebAuthnUser, error) {
+			return util.NewWebAuthnUserWithCredentials(
 				webauthnUserID, username, displayName,
-				credentialID, credentialPublicKey,
-				true,
+				credentials,
 			)
 		}).
 		ThenWebAuthnCredential(func(webauthnuser *types.WebAuthnUser) (*webauthn.Credential, error) {
 			WebAuthnUser = *webauthnuser
-			return util.FinishLogin(ctx, webauthnuser, sessionData, &convertedRequest)
+			return util.ValidateLogin(ctx, webauthnuser, sessionData, &parsed)
 		}).
-		ThenSQLResult(func(webauthnCredential *webauthn.Credential) (sql.Result, error) {
-			// 0 is a placeholder, replace with actual sign count if needed
-			return user.UpdateUserWebauthnSignCount(
-				db, 0, username,
-			)
+		// Apply the backup policy of the tenant and record a first backup
+		ThenWebAuthnCredential(func(webauthnCredential *webauthn.Credential) (*webauthn.Credential, error) {
+			return enforceBackupPolicy(ctx, db, userID, username, WebAuthnUser.Credentials, webauthnCredential)
 		}).
-		ThenBytes(func(_ sql.Result) ([]byte, error) {
+		// Store the flags and the outputs of the requested extensions
+		ThenSQLResult(func(webauthnCredential *webauthn.Credential) (sql.Result, error) {
+			userVerified = webauthnCredential.Flags.UserVerified
+			signed = util.EncodeCredential(webauthnCredential)
+			if err := extension.ApplyLogin(&signed, sessionData.Extensions, requestData["credential"]); err != nil {
+				return nil, err
+			}
+			return credential.UpdateCredentialAfterLogin(db, signed)
+		}).
+		ThenAuthSession(func(_ sql.Result) (*types.AuthSession, error) {
+			return session.CreateAuthSession(ctx, redisClient, userID, username, userVerified)
+		}).
+		ThenBytes(func(_ *types.AuthSession) ([]byte, error) {
+			_ = audit.Record(db, audit.Entry{
+				Actor:    "user",
+				Action:   audit.ActionLogin,
+				UserID:   userID,
+				Username: username,
+				IP:       clientip.IP(ctx),
+				Detail:   credentialDetail(db, signed),
+			})
 			responseData := map[string]interface{}{
 				"message": "Login verification successful",
 				"user":    WebAuthnUser,
@@ -199,7 +237,7 @@ func HandleAuthenticateVerification(ctx *fasthttp.RequestCtx, db *sql.DB, redisC
 					ctx.SetStatusCode(fasthttp.StatusInternalServerError)
 					ctx.SetContentType("application/json")
 					ctx.SetBodyString(`{"error": "Internal server error"}`)
-					zap.L().Error(
+					handlerLogger(ctx).Error(
 						"Unexpected error in HandleAuthenticateVerification",
 						zap.Error(err),
 					)
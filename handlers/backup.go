@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jamesyang124/webauthn-example/internal/audit"
+	"github.com/jamesyang124/webauthn-example/internal/backup"
+	"github.com/jamesyang124/webauthn-example/internal/clientip"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	user "github.com/jamesyang124/webauthn-example/internal/user"
+	util "github.com/jamesyang124/webauthn-example/internal/util"
+	"github.com/valyala/fasthttp"
+)
+
+// enforceBackupPolicy applies the backup policy of the tenant to the credential of a
+// ceremony. previous are the credentials of the user before a login, nil at
+// registration; a credential whose BS flag was clear and is now set is recorded in
+// the audit log as backed up.
+func enforceBackupPolicy(
+	ctx *fasthttp.RequestCtx,
+	db *sql.DB,
+	userID, username string,
+	previous []webauthn.Credential,
+	webauthnCredential *webauthn.Credential,
+) (*webauthn.Credential, error) {
+	t := tenant.From(ctx)
+	credentialID := util.EncodeRawURLEncoding(webauthnCredential.ID)
+
+	var (
+		roles  []string
+		locked bool
+	)
+	if _, err := user.QueryUserAccess(db, t.ID, userID, &roles, &locked); err != nil {
+		return nil, err
+	}
+	if err := t.Backup.Check(userID, roles, credentialID, webauthnCredential.Flags.BackupEligible); err != nil {
+		return nil, err
+	}
+
+	for _, before := range previous {
+		if bytes.Equal(before.ID, webauthnCredential.ID) && !before.Flags.BackupState && webauthnCredential.Flags.BackupState {
+			_ = audit.Record(db, audit.Entry{
+				Actor:    "user",
+				Action:   audit.ActionCredentialBackedUp,
+				UserID:   userID,
+				Username: username,
+				IP:       clientip.IP(ctx),
+				Detail: map[string]interface{}{
+					"credentialId": credentialID,
+					"backupClass":  backup.Synced,
+				},
+			})
+		}
+	}
+	return webauthnCredential, nil
+}
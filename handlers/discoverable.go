@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"database/sql"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jamesyang124/webauthn-example/internal/audit"
+	"github.com/jamesyang124/webauthn-example/internal/clientip"
+	"github.com/jamesyang124/webauthn-example/internal/credential"
+	"github.com/jamesyang124/webauthn-example/internal/extension"
+	"github.com/jamesyang124/webauthn-example/internal/session"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	user "github.com/jamesyang124/webauthn-example/internal/user"
+	util "github.com/jamesyang124/webauthn-example/internal/util"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/jamesyang124/webauthn-example/types"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// HandleDiscoverableOptions issues the options of a discoverable login for conditional
+// mediation. No username is needed: the session data is stored under its challenge.
+func HandleDiscoverableOptions(ctx *fasthttp.RequestCtx, redisClient *redis.Client) {
+	t := tenant.From(ctx)
+
+	var loginResponse types.BeginLoginResponse
+
+	types.NewTryIO(func() (*types.BeginLoginResponse, error) {
+		// Without an allow list, only the PRF extension applies
+		opts, err := extension.LoginOptions(t.Extensions, t.RelyingParty.ID, extension.LoginRequest{}, nil)
+		if err != nil {
+			return nil, err
+		}
+		return util.BeginDiscoverableLogin(ctx, session.DiscoverableSessionTTL, &loginResponse, opts...)
+	}).
+		// Marshal session data to JSON
+		ThenBytes(func(_ *types.BeginLoginResponse) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, loginResponse.SessionData)
+		}).
+		// Store session data in Redis, keyed by the challenge the assertion will echo
+		ThenBytes(func(sessionDataJSON []byte) ([]byte, error) {
+			return session.SetWebauthnSessionData(
+				ctx, redisClient,
+				t.RedisKey(session.DiscoverableSessionPrefix+loginResponse.SessionData.Challenge),
+				sessionDataJSON, session.DiscoverableSessionTTL,
+			)
+		}).
+		// Marshal login options for client response
+		ThenBytes(func(_ []byte) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, loginResponse.Options)
+		}).
+		Match(
+			func(err error) {
+				if appErr, ok := err.(*weberror.AppError); ok {
+					httpErr := weberror.ToHTTPError(appErr)
+					httpErr.RespondAndLog(ctx)
+				} else {
+					ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+					ctx.SetContentType("application/json")
+					ctx.SetBodyString(`{"error": "Internal server error"}`)
+					handlerLogger(ctx).Error(
+						"Unexpected error in HandleDiscoverableOptions",
+						zap.Error(err),
+					)
+				}
+			},
+			func(responseJSON []byte) {
+				ctx.SetContentType("application/json")
+				ctx.SetStatusCode(fasthttp.StatusOK)
+				ctx.SetBody(responseJSON)
+			},
+		)
+}
+
+// HandleDiscoverableVerification finishes a discoverable login. The challenge in the
+// client data selects the session data, which is deleted on read so that every
+// challenge is answered once, and the user handle of the assertion selects the user.
+func HandleDiscoverableVerification(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client) {
+	t := tenant.From(ctx)
+
+	var (
+		requestData                   map[string]interface{}
+		userID, username, displayName string
+		parsed                        protocol.ParsedCredentialAssertionData
+		sessionData                   webauthn.SessionData
+		WebAuthnUser                  types.WebAuthnUser
+		userVerified                  bool
+		signed                        types.StoredCredential
+	)
+
+	types.NewTryIO(func() (string, error) {
+		return util.ParseJSONBody(ctx, &requestData)
+	}).
+		ThenBytes(func(_ string) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, requestData["credential"])
+		}).
+		ThenString(func(credentialData []byte) (string, error) {
+			return util.ParseAssertion(ctx, credentialData, &parsed)
+		}).
+		ThenString(func(challenge string) (string, error) {
+			return session.TakeWebauthnSessionData(
+				ctx, redisClient,
+				t.RedisKey(session.DiscoverableSessionPrefix+challenge),
+			)
+		}).
+		ThenBytes(func(redisSessionData string) ([]byte, error) {
+			return util.UnmarshalAndRespondOnError(ctx, []byte(redisSessionData), &sessionData)
+		}).
+		ThenString(func(_ []byte) (string, error) {
+			return user.QueryUserByWebauthnHandle(
+				db, t.ID, string(parsed.Response.UserHandle),
+				&userID, &username, &displayName,
+			)
+		}).
+		ThenString(func(_ string) (string, error) {
+			return user.EnsureUserNotLocked(db, t.ID, userID)
+		}).
+		ThenStoredCredentials(func(_ string) ([]types.StoredCredential, error) {
+			return credential.QueryCredentialsByUserID(db, userID)
+		}).
+		ThenWebAuthnCredentials(func(stored []types.StoredCredential) ([]webauthn.Credential, error) {
+			return util.DecodeStoredCredentials(ctx, stored, &parsed)
+		}).
+		ThenWebAuthnUser(func(credentials []webauthn.Credential) (*types.WebAuthnUser, error) {
+			return util.NewWebAuthnUserWithCredentials(
+				string(parsed.Response.UserHandle), username, displayName,
+				credentials,
+			)
+		}).
+		ThenWebAuthnCredential(func(webauthnuser *types.WebAuthnUser) (*webauthn.Credential, error) {
+			WebAuthnUser = *webauthnuser
+			return util.FinishDiscoverableLogin(ctx, webauthnuser, sessionData, &parsed)
+		}).
+		// Apply the backup policy of the tenant and record a first backup
+		ThenWebAuthnCredential(func(webauthnCredential *webauthn.Credential) (*webauthn.Credential, error) {
+			return enforceBackupPolicy(ctx, db, userID, username, WebAuthnUser.Credentials, webauthnCredential)
+		}).
+		// Store the flags and the outputs of the requested extensions
+		ThenSQLResult(func(webauthnCredential *webauthn.Credential) (sql.Result, error) {
+			userVerified = webauthnCredential.Flags.UserVerified
+			signed = util.EncodeCredential(webauthnCredential)
+			if err := extension.ApplyLogin(&signed, sessionData.Extensions, requestData["credential"]); err != nil {
+				return nil, err
+			}
+			return credential.UpdateCredentialAfterLogin(db, signed)
+		}).
+		ThenAuthSession(func(_ sql.Result) (*types.AuthSession, error) {
+			return session.CreateAuthSession(ctx, redisClient, userID, username, userVerified)
+		}).
+		ThenBytes(func(_ *types.AuthSession) ([]byte, error) {
+			_ = audit.Record(db, audit.Entry{
+				Actor:    "user",
+				Action:   audit.ActionLogin,
+				UserID:   userID,
+				Username: username,
+				IP:       clientip.IP(ctx),
+				Detail:   credentialDetail(db, signed),
+			})
+			responseData := map[string]interface{}{
+				"message": "Login verification successful",
+				"user":    WebAuthnUser,
+			}
+			return util.MarshalAndRespondOnError(ctx, responseData)
+		}).
+		Match(
+			func(err error) {
+				if appErr, ok := err.(*weberror.AppError); ok {
+					httpErr := weberror.ToHTTPError(appErr)
+					httpErr.RespondAndLog(ctx)
+				} else {
+					ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+					ctx.SetContentType("application/json")
+					ctx.SetBodyString(`{"error": "Internal server error"}`)
+					handlerLogger(ctx).Error(
+						"Unexpected error in HandleDiscoverableVerification",
+						zap.Error(err),
+					)
+				}
+			},
+			func(responseJSON []byte) {
+				ctx.SetContentType("application/json")
+				ctx.SetStatusCode(fasthttp.StatusOK)
+				ctx.SetBody(responseJSON)
+			},
+		)
+}
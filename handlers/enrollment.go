@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/jamesyang124/webauthn-example/internal/audit"
+	"github.com/jamesyang124/webauthn-example/internal/clientip"
+	"github.com/jamesyang124/webauthn-example/internal/credential"
+	"github.com/jamesyang124/webauthn-example/internal/extension"
+	"github.com/jamesyang124/webauthn-example/internal/session"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	user "github.com/jamesyang124/webauthn-example/internal/user"
+	util "github.com/jamesyang124/webauthn-example/internal/util"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/jamesyang124/webauthn-example/types"
+	"github.com/valyala/fasthttp"
+)
+
+// ensureEnrollmentAllowed lets a session enroll its first passkey right after a password
+// sign-in, while adding another passkey to an account that has one needs a user
+// verification within maxAge, like the other account changes.
+func ensureEnrollmentAllowed(authSession *types.AuthSession, existing []webauthn.Credential, maxAge time.Duration) error {
+	if len(existing) == 0 {
+		return nil
+	}
+	if authSession.UserVerifiedAt.IsZero() || time.Since(authSession.UserVerifiedAt) > maxAge {
+		return weberror.StepUpRequiredError(authSession.UserID)
+	}
+	return nil
+}
+
+// HandleEnrollmentOptions begins the registration of a passkey for the signed-in user.
+// The session data is stored under the ID of the auth session, so only that session can
+// answer it.
+func HandleEnrollmentOptions(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client, maxAge time.Duration) {
+	t := tenant.From(ctx)
+	authSession := accountSession(ctx)
+
+	var (
+		requestData                         map[string]interface{}
+		userID, webauthnUserID, displayName string
+		registrationOptions                 []webauthn.RegistrationOption
+		options                             *protocol.CredentialCreation
+		sessionData                         *webauthn.SessionData
+	)
+
+	types.NewTryIO(func() (string, error) {
+		return util.ParseJSONBody(ctx, &requestData)
+	}).
+		ThenString(func(_ string) (string, error) {
+			return resolveRegistrationProfile(t, requestData, &registrationOptions)
+		}).
+		ThenString(func(_ string) (string, error) {
+			return user.QueryUserWebauthnByUsername(
+				db, t.ID, authSession.Username,
+				&userID, &webauthnUserID, &displayName,
+			)
+		}).
+		ThenStoredCredentials(func(_ string) ([]types.StoredCredential, error) {
+			return credential.QueryCredentialsByUserID(db, userID)
+		}).
+		ThenWebAuthnCredentials(func(stored []types.StoredCredential) ([]webauthn.Credential, error) {
+			return util.DecodeStoredCredentials(ctx, stored, nil)
+		}).
+		// Keep the user handle and display name of earlier registrations
+		ThenWebAuthnUser(func(existing []webauthn.Credential) (*types.WebAuthnUser, error) {
+			if err := ensureEnrollmentAllowed(authSession, existing, maxAge); err != nil {
+				return nil, err
+			}
+			if webauthnUserID == "" {
+				uuidVal, err := uuid.NewV7()
+				if err != nil {
+					return nil, weberror.UUIDGenerationError(err)
+				}
+				webauthnUserID = uuidVal.String()
+			}
+			if displayName == "" {
+				displayName = authSession.Username
+			}
+			webAuthnUser := util.NewWebAuthnUser(webauthnUserID, authSession.Username, displayName)
+			webAuthnUser.Credentials = existing
+			return webAuthnUser, nil
+		}).
+		ThenCredentialCreation(func(webAuthnUser *types.WebAuthnUser) (*protocol.CredentialCreation, error) {
+			opts, sessData, ok := util.BeginRegistration(ctx, webAuthnUser, registrationOptions...)
+			if !ok {
+				return nil, weberror.WebAuthnBeginRegistrationError(nil)
+			}
+			options = opts
+			sessionData = sessData
+			return options, nil
+		}).
+		ThenBytes(func(_ *protocol.CredentialCreation) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, sessionData)
+		}).
+		ThenBytes(func(sessionDataJSON []byte) ([]byte, error) {
+			return session.SetWebauthnSessionData(
+				ctx, redisClient,
+				t.RedisKey(session.EnrollmentSessionPrefix+authSession.ID),
+				sessionDataJSON, session.EnrollmentSessionTTL,
+			)
+		}).
+		ThenBytes(func(_ []byte) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, options)
+		}).
+		Match(respondJSON(ctx, "HandleEnrollmentOptions"))
+}
+
+// HandleEnrollmentVerification finishes the registration of a passkey for the signed-in
+// user. The challenge is deleted on read, so it can be answered once.
+func HandleEnrollmentVerification(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client, maxAge time.Duration) {
+	t := tenant.From(ctx)
+	authSession := accountSession(ctx)
+
+	var (
+		requestData                         map[string]interface{}
+		userID, webauthnUserID, displayName string
+		sessionData                         webauthn.SessionData
+		convertedRequest                    http.Request
+		webauthnCredential                  *webauthn.Credential
+	)
+
+	types.NewTryIO(func() (string, error) {
+		return util.ParseJSONBody(ctx, &requestData)
+	}).
+		ThenString(func(_ string) (string, error) {
+			return session.TakeWebauthnSessionData(
+				ctx, redisClient,
+				t.RedisKey(session.EnrollmentSessionPrefix+authSession.ID),
+			)
+		}).
+		ThenBytes(func(redisSessionData string) ([]byte, error) {
+			return util.UnmarshalAndRespondOnError(ctx, []byte(redisSessionData), &sessionData)
+		}).
+		ThenBytes(func(_ []byte) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, requestData["credential"])
+		}).
+		ThenHttpRequest(func(credentialData []byte) (*http.Request, error) {
+			ctx.Request.SetBody(credentialData)
+			return util.ConvertFastHTTPToHTTPRequest(ctx, &convertedRequest)
+		}).
+		ThenString(func(_ *http.Request) (string, error) {
+			return user.QueryUserWebauthnByUsername(
+				db, t.ID, authSession.Username,
+				&userID, &webauthnUserID, &displayName,
+			)
+		}).
+		ThenStoredCredentials(func(_ string) ([]types.StoredCredential, error) {
+			return credential.QueryCredentialsByUserID(db, userID)
+		}).
+		ThenWebAuthnCredentials(func(stored []types.StoredCredential) ([]webauthn.Credential, error) {
+			return util.DecodeStoredCredentials(ctx, stored, nil)
+		}).
+		// Checked again, since a passkey may have been enrolled since the options
+		ThenWebAuthnUser(func(existing []webauthn.Credential) (*types.WebAuthnUser, error) {
+			if err := ensureEnrollmentAllowed(authSession, existing, maxAge); err != nil {
+				return nil, err
+			}
+			if displayName == "" {
+				displayName = authSession.Username
+			}
+			return util.NewWebAuthnUser(string(sessionData.UserID), authSession.Username, displayName), nil
+		}).
+		ThenWebAuthnCredential(func(webAuthnUser *types.WebAuthnUser) (*webauthn.Credential, error) {
+			cred, ok := util.FinishRegistration(ctx, webAuthnUser, sessionData, &convertedRequest)
+			if !ok {
+				return nil, weberror.WebAuthnFinishRegistrationError(nil)
+			}
+			webauthnCredential = cred
+			return webauthnCredential, nil
+		}).
+		ThenWebAuthnCredential(func(cred *webauthn.Credential) (*webauthn.Credential, error) {
+			if err := t.CheckAlgorithm(cred); err != nil {
+				return nil, err
+			}
+			return cred, nil
+		}).
+		ThenWebAuthnCredential(func(cred *webauthn.Credential) (*webauthn.Credential, error) {
+			return enforceBackupPolicy(ctx, db, userID, authSession.Username, nil, cred)
+		}).
+		ThenSQLResult(func(_ *webauthn.Credential) (sql.Result, error) {
+			return user.UpdateUserWebauthnIdentity(db, t.ID, string(sessionData.UserID), displayName, authSession.Username)
+		}).
+		ThenSQLResult(func(_ sql.Result) (sql.Result, error) {
+			stored := util.EncodeCredential(webauthnCredential)
+			if err := extension.ApplyRegistration(&stored, t.Extensions, requestData["credential"]); err != nil {
+				return nil, err
+			}
+			return credential.InsertCredential(db, userID, stored)
+		}).
+		ThenBytes(func(_ sql.Result) ([]byte, error) {
+			stored := util.EncodeCredential(webauthnCredential)
+			_ = audit.Record(db, audit.Entry{
+				Actor:    "user",
+				Action:   audit.ActionRegister,
+				UserID:   userID,
+				Username: authSession.Username,
+				IP:       clientip.IP(ctx),
+				Detail:   credentialDetail(db, stored),
+			})
+			return util.MarshalAndRespondOnError(ctx, map[string]interface{}{
+				"message":      "Passkey enrolled",
+				"credentialId": stored.CredentialID,
+			})
+		}).
+		Match(respondJSON(ctx, "HandleEnrollmentVerification"))
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jamesyang124/webauthn-example/internal/health"
+	"github.com/jamesyang124/webauthn-example/internal/logging"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	util "github.com/jamesyang124/webauthn-example/internal/util"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// handlerLogger returns the logger of the handlers package with the request ID of ctx.
+func handlerLogger(ctx *fasthttp.RequestCtx) *zap.Logger {
+	return logging.WithRequest(ctx, logging.L("handlers"))
+}
+
+// HandleHealthz reports that the process is alive. It checks no dependency, so that an
+// outage of Postgres or Redis does not get every instance restarted.
+func HandleHealthz(ctx *fasthttp.RequestCtx) {
+	ctx.SetContentType("application/json")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBodyString(`{"status":"ok"}`)
+}
+
+// HandleReadyz reports whether the instance can serve requests: it is not shutting down,
+// and Postgres, Redis and WebAuthn are available.
+func HandleReadyz(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client, tenants *tenant.Registry) {
+	status, code := "ready", fasthttp.StatusOK
+	checks := map[string]string{}
+
+	if health.Draining() {
+		status, code = "draining", fasthttp.StatusServiceUnavailable
+	}
+	for _, check := range health.CheckDependencies(context.Background(), db, redisClient, tenants) {
+		if check.Err != nil {
+			checks[check.Name] = "unavailable"
+			if code == fasthttp.StatusOK {
+				status, code = "unavailable", fasthttp.StatusServiceUnavailable
+			}
+			handlerLogger(ctx).Warn("Readiness check failed", zap.String("check", check.Name), zap.Error(check.Err))
+			continue
+		}
+		checks[check.Name] = "ok"
+	}
+
+	responseJSON, err := util.MarshalAndRespondOnError(ctx, map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	})
+	if err != nil {
+		weberror.ToHTTPError(err.(*weberror.AppError)).RespondAndLog(ctx)
+		return
+	}
+	ctx.SetContentType("application/json")
+	ctx.SetStatusCode(code)
+	ctx.SetBody(responseJSON)
+}
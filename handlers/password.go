@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jamesyang124/webauthn-example/internal/audit"
+	"github.com/jamesyang124/webauthn-example/internal/clientip"
+	"github.com/jamesyang124/webauthn-example/internal/password"
+	"github.com/jamesyang124/webauthn-example/internal/session"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	user "github.com/jamesyang124/webauthn-example/internal/user"
+	util "github.com/jamesyang124/webauthn-example/internal/util"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/jamesyang124/webauthn-example/types"
+	"github.com/valyala/fasthttp"
+)
+
+// HandlePasswordLogin signs a user in with the password of their account, for users who
+// have not moved to passkeys yet. The session has no user verification, so account
+// changes need a step-up once a passkey is enrolled, and the response tells the client
+// to offer the enrollment when the user has no passkey. A client IP gets maxAttempts
+// sign-ins per username within window.
+func HandlePasswordLogin(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client, maxAttempts int, window time.Duration) {
+	t := tenant.From(ctx)
+
+	var (
+		requestData      map[string]interface{}
+		username, secret string
+		login            user.PasswordLogin
+	)
+
+	types.NewTryIO(func() (string, error) {
+		return util.ParseJSONBody(ctx, &requestData)
+	}).
+		ThenString(func(_ string) (string, error) {
+			return user.ValidateUsername(ctx, requestData, &username)
+		}).
+		// Counted before the password is compared, so that concurrent guesses are counted too
+		ThenString(func(_ string) (string, error) {
+			return password.CountAttempt(ctx, redisClient, t, username, clientip.IP(ctx), maxAttempts, window)
+		}).
+		// An unknown user is reported like a wrong password, after comparing against a
+		// dummy hash, so that neither the response nor its timing tells them apart
+		ThenString(func(_ string) (string, error) {
+			secret, _ = requestData["password"].(string)
+			if _, err := user.QueryPasswordLogin(db, t.ID, username, &login); err != nil {
+				if !errors.Is(err, sql.ErrNoRows) {
+					return "", err
+				}
+				password.Verify("", secret)
+				return "", weberror.InvalidPasswordError(username)
+			}
+			// Compared even when empty, so that an empty password takes as long as a wrong one
+			if ok := password.Verify(login.PasswordHash, secret); !ok || secret == "" {
+				return "", weberror.InvalidPasswordError(username)
+			}
+			return password.ResetAttempts(ctx, redisClient, t, username, clientip.IP(ctx))
+		}).
+		ThenString(func(_ string) (string, error) {
+			return user.EnsureUserNotLocked(db, t.ID, login.UserID)
+		}).
+		// Checked after the password, so the flag is not disclosed to whoever guesses usernames
+		ThenAuthSession(func(userID string) (*types.AuthSession, error) {
+			if !login.Enabled() {
+				return nil, weberror.PasswordLoginDisabledError(userID)
+			}
+			return session.CreateAuthSession(ctx, redisClient, userID, login.Username, false)
+		}).
+		ThenBytes(func(_ *types.AuthSession) ([]byte, error) {
+			_ = audit.Record(db, audit.Entry{
+				Actor:    "user",
+				Action:   audit.ActionPasswordLogin,
+				UserID:   login.UserID,
+				Username: login.Username,
+				IP:       clientip.IP(ctx),
+			})
+			return util.MarshalAndRespondOnError(ctx, map[string]interface{}{
+				"message":       "Login successful",
+				"enrollPasskey": login.Passkeys == 0,
+			})
+		}).
+		Match(respondJSON(ctx, "HandlePasswordLogin"))
+}
@@ -7,8 +7,7 @@ package handlers
 
 import (
 	"database/sql"
-	"net/http"
-	"time"
+	"fmt"
 
 	_ "github.com/lib/pq" // Justify blank import: required for PostgreSQL driver registration
 
@@ -16,8 +15,12 @@ import (
 	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/google/uuid"
-	session "github.com/jamesyang124/webauthn-example/internal/session"
-	user "github.com/jamesyang124/webauthn-example/internal/user"
+	"github.com/jamesyang124/webauthn-example/internal/aaguid"
+	"github.com/jamesyang124/webauthn-example/internal/audit"
+	"github.com/jamesyang124/webauthn-example/internal/clientip"
+	"github.com/jamesyang124/webauthn-example/internal/extension"
+	"github.com/jamesyang124/webauthn-example/internal/signup"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
 	util "github.com/jamesyang124/webauthn-example/internal/util"
 	"github.com/jamesyang124/webauthn-example/internal/weberror"
 	"github.com/jamesyang124/webauthn-example/types"
@@ -25,46 +28,49 @@ import (
 	"go.uber.org/zap"
 )
 
-// HandleRegisterOptions handles the WebAuthn registration options using TryIO monad chains
+// HandleRegisterOptions begins the signup of a new user using TryIO monad chains. The
+// username and email must be free in the tenant; the user is only created once the
+// ceremony succeeds, see HandleRegisterVerification.
 func HandleRegisterOptions(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client) {
+	// Users, credentials and ceremony data are scoped to the tenant of the host
+	t := tenant.From(ctx)
+
 	// Shared variables for the chain
 	var (
-		requestData    map[string]interface{}
-		username       string
-		webauthnUserID uuid.UUID
-		options        *protocol.CredentialCreation
-		sessionData    *webauthn.SessionData
+		requestData         map[string]interface{}
+		newUser             signup.Signup
+		options             *protocol.CredentialCreation
+		sessionData         *webauthn.SessionData
+		registrationOptions []webauthn.RegistrationOption
 	)
 
 	// Parse request JSON body into map
 	types.NewTryIO(func() (string, error) {
 		return util.ParseJSONBody(ctx, &requestData)
 	}).
-		// Validate username from request data
+		// Validate username, email and display name of the new user
 		ThenString(func(_ string) (string, error) {
-			return user.ValidateUsername(ctx, requestData, &username)
+			return signup.Validate(ctx, requestData, &newUser)
 		}).
-		// Query user by username from database
-		ThenString(func(validatedUsername string) (string, error) {
-			var userID, createDate string
-			return user.QueryUserByUsername(db, username, &userID, &username, &createDate)
+		// Resolve the registration profile, e.g. security-key, among those the tenant offers
+		ThenString(func(_ string) (string, error) {
+			return resolveRegistrationProfile(t, requestData, &registrationOptions)
 		}).
-		// Generate new UUID for WebAuthn user ID
-		ThenUUID(func(_ string) (uuid.UUID, error) {
-			return uuid.NewV7()
+		// Reject a username or email another user already has
+		ThenString(func(_ string) (string, error) {
+			return signup.EnsureAvailable(db, t.ID, newUser)
 		}).
-		// Create new WebAuthn user struct
-		ThenWebAuthnUser(func(uuidVal uuid.UUID) (*types.WebAuthnUser, error) {
-			webauthnUserID = uuidVal
-			return util.NewWebAuthnUser(
-				webauthnUserID.String(),
-				username,
-				username,
-			), nil
+		// Create WebAuthn user with a new user handle
+		ThenWebAuthnUser(func(_ string) (*types.WebAuthnUser, error) {
+			uuidVal, err := uuid.NewV7()
+			if err != nil {
+				return nil, weberror.UUIDGenerationError(err)
+			}
+			return util.NewWebAuthnUser(uuidVal.String(), newUser.Username, newUser.DisplayName), nil
 		}).
 		// Begin WebAuthn registration process
 		ThenCredentialCreation(func(webAuthnUser *types.WebAuthnUser) (*protocol.CredentialCreation, error) {
-			opts, sessData, ok := util.BeginRegistration(ctx, webAuthnUser)
+			opts, sessData, ok := util.BeginRegistration(ctx, webAuthnUser, registrationOptions...)
 			if !ok {
 				return nil, weberror.WebAuthnBeginRegistrationError(nil)
 			}
@@ -72,14 +78,9 @@ func HandleRegisterOptions(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *re
 			sessionData = sessData
 			return options, nil
 		}).
-		// Marshal session data to JSON
+		// Store the signup with its session data under the challenge
 		ThenBytes(func(_ *protocol.CredentialCreation) ([]byte, error) {
-			return util.MarshalAndRespondOnError(ctx, sessionData)
-		}).
-		// Store session data in Redis with TTL
-		ThenBytes(func(sessionDataJSON []byte) ([]byte, error) {
-			sessionKey := "webauthn_session:" + username
-			return session.SetWebauthnSessionData(ctx, redisClient, sessionKey, sessionDataJSON, 86400*time.Second)
+			return signup.Store(ctx, redisClient, t, signup.Pending{Signup: newUser, SessionData: *sessionData})
 		}).
 		// Marshal registration options for response
 		ThenBytes(func(_ []byte) ([]byte, error) {
@@ -102,110 +103,92 @@ func HandleRegisterOptions(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *re
 				ctx.SetContentType("application/json")
 				ctx.SetStatusCode(fasthttp.StatusOK)
 				ctx.SetBody(responseJSON)
-				zap.L().Info("HandleRegisterOptions completed successfully")
+				handlerLogger(ctx).Debug("HandleRegisterOptions completed successfully")
 			},
 		)
 }
 
-// HandleRegisterVerification handles the verification of WebAuthn registration using TryIO monad chains
+// HandleRegisterVerification finishes a signup using TryIO monad chains: the user is
+// created with the email and display name of the options request and its first
+// credential, in one transaction. The pending signup is found by the challenge the
+// credential answers, and deleted on read, so it can be answered once.
 func HandleRegisterVerification(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client) {
+	// Users, credentials and ceremony data are scoped to the tenant of the host
+	t := tenant.From(ctx)
+
 	// Shared variables for the chain
 	var (
-		requestData       map[string]interface{}
-		username          string
-		sessionData       webauthn.SessionData
-		convertedRequest  http.Request
-		webAuthnUser      *types.WebAuthnUser
-		credential        *webauthn.Credential
+		requestData        map[string]interface{}
+		parsed             protocol.ParsedCredentialCreationData
+		pending            signup.Pending
+		webauthnCredential *webauthn.Credential
 	)
 
 	// Parse request JSON body into map
 	types.NewTryIO(func() (string, error) {
 		return util.ParseJSONBody(ctx, &requestData)
 	}).
-		// Validate username and display name from request
-		ThenString(func(_ string) (string, error) {
-			validatedUsername, _, err := user.ValidateUsernameAndDisplayname(ctx, requestData)
-			if err != nil {
-				return "", err
-			}
-			username = validatedUsername
-			return username, nil
-		}).
-		// Retrieve session data from Redis
-		ThenString(func(_ string) (string, error) {
-			sessionKey := "webauthn_session:" + username
-			return session.GetWebauthnSessionData(ctx, redisClient, sessionKey)
-		}).
-		// Unmarshal session data from JSON
-		ThenBytes(func(redisSessionData string) ([]byte, error) {
-			zap.L().Info("Register verify sessionDataStr", zap.String("sessionDataStr", redisSessionData))
-			return util.UnmarshalAndRespondOnError(ctx, []byte(redisSessionData), &sessionData)
-		}).
 		// Marshal credential data from request
-		ThenBytes(func(_ []byte) ([]byte, error) {
+		ThenBytes(func(_ string) ([]byte, error) {
 			return util.MarshalAndRespondOnError(ctx, requestData["credential"])
 		}).
-		// Convert FastHTTP request to standard HTTP request
-		ThenHttpRequest(func(credentialData []byte) (*http.Request, error) {
-			ctx.Request.SetBody(credentialData)
-			zap.L().Info("Overridden PostBody", zap.String("postBody", string(ctx.PostBody())))
-			return util.ConvertFastHTTPToHTTPRequest(ctx, &convertedRequest)
+		// Parse the credential to read the challenge it answers
+		ThenString(func(credentialData []byte) (string, error) {
+			return util.ParseAttestation(ctx, credentialData, &parsed)
 		}).
-		// Query user by username from database
-		ThenString(func(req *http.Request) (string, error) {
-			var userID, createDate string
-			return user.QueryUserByUsername(db, username, &userID, &username, &createDate)
+		// Take the pending signup of that challenge from Redis
+		ThenString(func(challenge string) (string, error) {
+			return signup.Take(ctx, redisClient, t, challenge, &pending)
 		}).
 		// Create WebAuthn user with session data
-		ThenWebAuthnUser(func(validatedUsername string) (*types.WebAuthnUser, error) {
-			webAuthnUser = util.NewWebAuthnUser(
-				string(sessionData.UserID),
-				username,
-				username,
-			)
-			return webAuthnUser, nil
+		ThenWebAuthnUser(func(_ string) (*types.WebAuthnUser, error) {
+			return util.NewWebAuthnUser(
+				string(pending.SessionData.UserID),
+				pending.Username,
+				pending.DisplayName,
+			), nil
 		}).
 		// Finish WebAuthn registration process
 		ThenWebAuthnCredential(func(user *types.WebAuthnUser) (*webauthn.Credential, error) {
-			cred, ok := util.FinishRegistration(ctx, user, sessionData, &convertedRequest)
-			if !ok {
-				return nil, weberror.WebAuthnFinishRegistrationError(nil)
+			cred, err := util.CreateCredential(ctx, user, pending.SessionData, &parsed)
+			webauthnCredential = cred
+			return cred, err
+		}).
+		// Reject algorithms outside the policy, which clients were only asked to avoid.
+		// New users hold no roles yet, so the backup policy cannot reject the credential.
+		ThenWebAuthnCredential(func(cred *webauthn.Credential) (*webauthn.Credential, error) {
+			if err := t.CheckAlgorithm(cred); err != nil {
+				return nil, err
 			}
-			credential = cred
-			return credential, nil
-		}).
-		// Update user with WebAuthn credentials in database
-		ThenSQLResult(func(cred *webauthn.Credential) (sql.Result, error) {
-			// Encode credential public key and ID for storage
-			credentialPublicKeyEncoded := util.EncodeRawURLEncoding(cred.PublicKey)
-			credentialIDEncoded := util.EncodeRawURLEncoding(cred.ID)
-			
-			zap.L().Info("credentialPublicKeyEncoded", zap.String("credentialPublicKeyEncoded", credentialPublicKeyEncoded))
-			zap.L().Info("credentialIDEncoded", zap.String("credentialIDEncoded", credentialIDEncoded))
-			
-			return user.UpdateUserWebauthnCredentials(db,
-				webAuthnUser.ID,
-				cred.Authenticator.SignCount,
-				credentialIDEncoded,
-				credentialPublicKeyEncoded,
-				username,
-				username,
-			)
+			return cred, nil
 		}).
-		// Check rows affected and marshal final response
-		ThenBytes(func(result sql.Result) ([]byte, error) {
-			rowsAffected, err := result.RowsAffected()
-			if err != nil {
-				return nil, weberror.DatabaseQueryError(err, "get rows affected")
+		// Create the user with the credential, its transports, flags, AAGUID and
+		// extension outputs
+		ThenString(func(_ *webauthn.Credential) (string, error) {
+			stored := util.EncodeCredential(webauthnCredential)
+			if err := extension.ApplyRegistration(&stored, t.Extensions, requestData["credential"]); err != nil {
+				return "", err
 			}
-			zap.L().Info("rows affected", zap.Int64("rowsAffected", rowsAffected))
-			
+			return signup.Create(db, t.ID, pending.Signup, string(pending.SessionData.UserID), stored)
+		}).
+		// Record the signup and marshal final response
+		ThenBytes(func(userID string) ([]byte, error) {
+			handlerLogger(ctx).Debug("User signed up", zap.String("userId", userID))
+
+			_ = audit.Record(db, audit.Entry{
+				Actor:    "user",
+				Action:   audit.ActionSignup,
+				UserID:   userID,
+				Username: pending.Username,
+				IP:       clientip.IP(ctx),
+				Detail:   credentialDetail(db, util.EncodeCredential(webauthnCredential)),
+			})
+
 			responseData := map[string]interface{}{
-				"credential": credential,
-				"payload":    requestData,
+				"credential": webauthnCredential,
 				"message":    "Verification successful",
 				"path":       string(ctx.Path()),
+				"userId":     userID,
 			}
 			return util.MarshalAndRespondOnError(ctx, responseData)
 		}).
@@ -229,3 +212,33 @@ func HandleRegisterVerification(ctx *fasthttp.RequestCtx, db *sql.DB, redisClien
 			},
 		)
 }
+
+// credentialDetail describes the credential of a ceremony in the audit log, with the name of its
+// authenticator when the AAGUID is known.
+func credentialDetail(db *sql.DB, stored types.StoredCredential) map[string]interface{} {
+	detail := map[string]interface{}{"credentialId": stored.CredentialID}
+	if stored.AAGUID != "" {
+		detail["aaguid"] = stored.AAGUID
+	}
+	if name := aaguid.Name(db, stored.AAGUID); name != "" {
+		detail["authenticator"] = name
+	}
+	return detail
+}
+
+// resolveRegistrationProfile reads the optional profile field of a registration options
+// request and returns the registration options of that profile of the tenant.
+func resolveRegistrationProfile(
+	t *tenant.Tenant,
+	requestData map[string]interface{},
+	registrationOptions *[]webauthn.RegistrationOption,
+) (string, error) {
+	profile, ok := requestData["profile"].(string)
+	if requestData["profile"] != nil && !ok {
+		return "", weberror.RegistrationProfileError(fmt.Sprint(requestData["profile"]))
+	}
+	if *registrationOptions, ok = t.RegistrationOptions(profile); !ok {
+		return "", weberror.RegistrationProfileError(profile)
+	}
+	return profile, nil
+}
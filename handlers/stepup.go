@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jamesyang124/webauthn-example/internal/audit"
+	"github.com/jamesyang124/webauthn-example/internal/clientip"
+	"github.com/jamesyang124/webauthn-example/internal/credential"
+	"github.com/jamesyang124/webauthn-example/internal/session"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	user "github.com/jamesyang124/webauthn-example/internal/user"
+	util "github.com/jamesyang124/webauthn-example/internal/util"
+	"github.com/jamesyang124/webauthn-example/types"
+	"github.com/valyala/fasthttp"
+)
+
+// HandleStepUpOptions begins a step-up ceremony for the signed-in user: a login
+// restricted to their credentials that requires user verification. The session data is
+// stored under the ID of the auth session, so only that session can answer it.
+func HandleStepUpOptions(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client) {
+	t := tenant.From(ctx)
+
+	var (
+		authSession                         *types.AuthSession
+		userID, webauthnUserID, displayName string
+		loginResponse                       types.BeginLoginResponse
+	)
+
+	types.NewTryIO(func() (*types.AuthSession, error) {
+		return session.GetAuthSession(ctx, redisClient)
+	}).
+		ThenString(func(signedIn *types.AuthSession) (string, error) {
+			authSession = signedIn
+			return user.QueryUserWebauthnByUsername(
+				db, t.ID, authSession.Username,
+				&userID, &webauthnUserID, &displayName,
+			)
+		}).
+		ThenString(func(_ string) (string, error) {
+			return user.EnsureUserNotLocked(db, t.ID, userID)
+		}).
+		ThenStoredCredentials(func(_ string) ([]types.StoredCredential, error) {
+			return credential.QueryCredentialsByUserID(db, userID)
+		}).
+		ThenWebAuthnCredentials(func(stored []types.StoredCredential) ([]webauthn.Credential, error) {
+			return util.DecodeStoredCredentials(ctx, stored, nil)
+		}).
+		ThenWebAuthnUser(func(credentials []webauthn.Credential) (*types.WebAuthnUser, error) {
+			return util.NewWebAuthnUserWithCredentials(
+				webauthnUserID, authSession.Username, displayName,
+				credentials,
+			)
+		}).
+		ThenBeginLoginResponse(func(webAuthnUser *types.WebAuthnUser) (*types.BeginLoginResponse, error) {
+			return util.BeginStepUp(ctx, webAuthnUser, &loginResponse)
+		}).
+		ThenBytes(func(_ *types.BeginLoginResponse) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, loginResponse.SessionData)
+		}).
+		ThenBytes(func(sessionDataJSON []byte) ([]byte, error) {
+			return session.SetWebauthnSessionData(
+				ctx, redisClient,
+				t.RedisKey(session.StepUpSessionPrefix+authSession.ID),
+				sessionDataJSON, session.StepUpSessionTTL,
+			)
+		}).
+		ThenBytes(func(_ []byte) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, loginResponse.Options)
+		}).
+		Match(respondJSON(ctx, "HandleStepUpOptions"))
+}
+
+// HandleStepUpVerification finishes a step-up ceremony and records the time of the user
+// verification on the auth session, for middlewares.RequireRecentUV. The challenge is
+// deleted on read, so it can be answered once.
+func HandleStepUpVerification(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client) {
+	t := tenant.From(ctx)
+
+	var (
+		authSession                         *types.AuthSession
+		requestData                         map[string]interface{}
+		userID, webauthnUserID, displayName string
+		sessionData                         webauthn.SessionData
+		parsed                              protocol.ParsedCredentialAssertionData
+		signed                              types.StoredCredential
+		previous                            []webauthn.Credential
+	)
+
+	types.NewTryIO(func() (*types.AuthSession, error) {
+		return session.GetAuthSession(ctx, redisClient)
+	}).
+		ThenString(func(signedIn *types.AuthSession) (string, error) {
+			authSession = signedIn
+			return util.ParseJSONBody(ctx, &requestData)
+		}).
+		ThenString(func(_ string) (string, error) {
+			return session.TakeWebauthnSessionData(
+				ctx, redisClient,
+				t.RedisKey(session.StepUpSessionPrefix+authSession.ID),
+			)
+		}).
+		ThenBytes(func(redisSessionData string) ([]byte, error) {
+			return util.UnmarshalAndRespondOnError(ctx, []byte(redisSessionData), &sessionData)
+		}).
+		ThenBytes(func(_ []byte) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, requestData["credential"])
+		}).
+		ThenString(func(credentialData []byte) (string, error) {
+			return util.ParseAssertion(ctx, credentialData, &parsed)
+		}).
+		ThenString(func(_ string) (string, error) {
+			return user.QueryUserWebauthnByUsername(
+				db, t.ID, authSession.Username,
+				&userID, &webauthnUserID, &displayName,
+			)
+		}).
+		ThenString(func(_ string) (string, error) {
+			return user.EnsureUserNotLocked(db, t.ID, userID)
+		}).
+		ThenStoredCredentials(func(_ string) ([]types.StoredCredential, error) {
+			return credential.QueryCredentialsByUserID(db, userID)
+		}).
+		ThenWebAuthnCredentials(func(stored []types.StoredCredential) ([]webauthn.Credential, error) {
+			return util.DecodeStoredCredentials(ctx, stored, &parsed)
+		}).
+		ThenWebAuthnUser(func(credentials []webauthn.Credential) (*types.WebAuthnUser, error) {
+			return util.NewWebAuthnUserWithCredentials(
+				webauthnUserID, authSession.Username, displayName,
+				credentials,
+			)
+		}).
+		// The session data requires user verification, so ValidateLogin rejects assertions without the UV flag
+		ThenWebAuthnCredential(func(webauthnuser *types.WebAuthnUser) (*webauthn.Credential, error) {
+			previous = webauthnuser.Credentials
+			return util.ValidateLogin(ctx, webauthnuser, sessionData, &parsed)
+		}).
+		// Apply the backup policy of the tenant and record a first backup
+		ThenWebAuthnCredential(func(webauthnCredential *webauthn.Credential) (*webauthn.Credential, error) {
+			return enforceBackupPolicy(ctx, db, userID, authSession.Username, previous, webauthnCredential)
+		}).
+		ThenSQLResult(func(webauthnCredential *webauthn.Credential) (sql.Result, error) {
+			signed = util.EncodeCredential(webauthnCredential)
+			return credential.UpdateCredentialAfterLogin(db, signed)
+		}).
+		ThenAuthSession(func(_ sql.Result) (*types.AuthSession, error) {
+			return session.MarkUserVerified(ctx, redisClient, authSession)
+		}).
+		ThenBytes(func(verified *types.AuthSession) ([]byte, error) {
+			_ = audit.Record(db, audit.Entry{
+				Actor:    "user",
+				Action:   audit.ActionStepUp,
+				UserID:   userID,
+				Username: authSession.Username,
+				IP:       clientip.IP(ctx),
+				Detail:   credentialDetail(db, signed),
+			})
+			return util.MarshalAndRespondOnError(ctx, map[string]interface{}{
+				"message":        "Step-up verification successful",
+				"userVerifiedAt": verified.UserVerifiedAt,
+			})
+		}).
+		Match(respondJSON(ctx, "HandleStepUpVerification"))
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jamesyang124/webauthn-example/internal/audit"
+	"github.com/jamesyang124/webauthn-example/internal/clientip"
+	"github.com/jamesyang124/webauthn-example/internal/credential"
+	"github.com/jamesyang124/webauthn-example/internal/session"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/txconfirm"
+	user "github.com/jamesyang124/webauthn-example/internal/user"
+	util "github.com/jamesyang124/webauthn-example/internal/util"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/jamesyang124/webauthn-example/types"
+	"github.com/valyala/fasthttp"
+)
+
+// HandleCreateTransaction submits a transaction for a user to approve, on behalf of a
+// backend service. The challenge of the returned options is derived from the
+// description and a fresh nonce, see txconfirm.Challenge; the service passes the
+// options and the transaction ID to the browser of the user.
+func HandleCreateTransaction(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client, ttl time.Duration) {
+	t := tenant.From(ctx)
+
+	var (
+		requestData   map[string]interface{}
+		username      string
+		pending       txconfirm.Pending
+		loginResponse types.BeginLoginResponse
+	)
+
+	types.NewTryIO(func() (string, error) {
+		return util.ParseJSONBody(ctx, &requestData)
+	}).
+		ThenString(func(_ string) (string, error) {
+			return user.ValidateUsername(ctx, requestData, &username)
+		}).
+		ThenString(func(_ string) (string, error) {
+			description, ok := requestData["description"].(string)
+			if !ok || description == "" || len(description) > txconfirm.MaxDescriptionLength {
+				return "", weberror.TransactionInvalidError(
+					fmt.Errorf("description must be a non-empty string of at most %d bytes", txconfirm.MaxDescriptionLength),
+				)
+			}
+			pending.Description = description
+			pending.Username = username
+			return user.QueryUserWebauthnByUsername(
+				db, t.ID, username,
+				&pending.UserID, &pending.WebauthnUserID, &pending.DisplayName,
+			)
+		}).
+		ThenString(func(_ string) (string, error) {
+			return user.EnsureUserNotLocked(db, t.ID, pending.UserID)
+		}).
+		ThenStoredCredentials(func(_ string) ([]types.StoredCredential, error) {
+			return credential.QueryCredentialsByUserID(db, pending.UserID)
+		}).
+		ThenWebAuthnCredentials(func(stored []types.StoredCredential) ([]webauthn.Credential, error) {
+			return util.DecodeStoredCredentials(ctx, stored, nil)
+		}).
+		ThenWebAuthnUser(func(credentials []webauthn.Credential) (*types.WebAuthnUser, error) {
+			return util.NewWebAuthnUserWithCredentials(
+				pending.WebauthnUserID, username, pending.DisplayName,
+				credentials,
+			)
+		}).
+		ThenBeginLoginResponse(func(webAuthnUser *types.WebAuthnUser) (*types.BeginLoginResponse, error) {
+			var err error
+			if pending.TransactionID, err = txconfirm.NewID(); err != nil {
+				return nil, weberror.UnexpectedError(err, "generate transaction id").LogCtx(ctx)
+			}
+			if pending.Nonce, err = txconfirm.NewNonce(); err != nil {
+				return nil, weberror.UnexpectedError(err, "generate transaction nonce").LogCtx(ctx)
+			}
+			challenge, err := txconfirm.Challenge(pending.Description, pending.Nonce)
+			if err != nil {
+				return nil, weberror.UnexpectedError(err, "derive transaction challenge").LogCtx(ctx)
+			}
+			return util.BeginTransactionLogin(ctx, webAuthnUser, challenge, ttl, &loginResponse)
+		}).
+		ThenBytes(func(_ *types.BeginLoginResponse) ([]byte, error) {
+			pending.SessionData = *loginResponse.SessionData
+			return util.MarshalAndRespondOnError(ctx, pending)
+		}).
+		ThenBytes(func(pendingJSON []byte) ([]byte, error) {
+			return session.SetWebauthnSessionData(
+				ctx, redisClient,
+				t.RedisKey(txconfirm.PendingPrefix+pending.TransactionID),
+				pendingJSON, ttl,
+			)
+		}).
+		ThenBytes(func(_ []byte) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, map[string]interface{}{
+				"transactionId": pending.TransactionID,
+				"expiresAt":     time.Now().Add(ttl).UTC(),
+				"options":       loginResponse.Options,
+			})
+		}).
+		Match(respondJSON(ctx, "HandleCreateTransaction"))
+}
+
+// HandleTransactionVerification approves a transaction with the assertion of its user
+// and returns the proof, which is also stored for the service to fetch. The pending
+// transaction is deleted once the assertion verifies, so a failed attempt can be
+// retried but the transaction can be approved once.
+func HandleTransactionVerification(ctx *fasthttp.RequestCtx, db *sql.DB, redisClient *redis.Client) {
+	t := tenant.From(ctx)
+
+	var (
+		requestData map[string]interface{}
+		pendingKey  string
+		pending     txconfirm.Pending
+		parsed      protocol.ParsedCredentialAssertionData
+		stored      []types.StoredCredential
+		proof       txconfirm.Proof
+		previous    []webauthn.Credential
+		approved    *webauthn.Credential
+	)
+
+	types.NewTryIO(func() (string, error) {
+		return util.ParseJSONBody(ctx, &requestData)
+	}).
+		ThenString(func(_ string) (string, error) {
+			transactionID, ok := requestData["transactionId"].(string)
+			if !ok || transactionID == "" {
+				return "", weberror.TransactionInvalidError(errors.New("invalid or missing transactionId"))
+			}
+			pendingKey = t.RedisKey(txconfirm.PendingPrefix + transactionID)
+			return session.GetWebauthnSessionData(ctx, redisClient, pendingKey)
+		}).
+		ThenBytes(func(pendingJSON string) ([]byte, error) {
+			return util.UnmarshalAndRespondOnError(ctx, []byte(pendingJSON), &pending)
+		}).
+		ThenBytes(func(_ []byte) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, requestData["credential"])
+		}).
+		ThenString(func(credentialData []byte) (string, error) {
+			return util.ParseAssertion(ctx, credentialData, &parsed)
+		}).
+		ThenString(func(_ string) (string, error) {
+			return user.EnsureUserNotLocked(db, t.ID, pending.UserID)
+		}).
+		ThenStoredCredentials(func(_ string) ([]types.StoredCredential, error) {
+			return credential.QueryCredentialsByUserID(db, pending.UserID)
+		}).
+		ThenWebAuthnCredentials(func(credentials []types.StoredCredential) ([]webauthn.Credential, error) {
+			stored = credentials
+			return util.DecodeStoredCredentials(ctx, stored, &parsed)
+		}).
+		ThenWebAuthnUser(func(credentials []webauthn.Credential) (*types.WebAuthnUser, error) {
+			return util.NewWebAuthnUserWithCredentials(
+				pending.WebauthnUserID, pending.Username, pending.DisplayName,
+				credentials,
+			)
+		}).
+		// The session data holds the derived challenge and requires user verification
+		ThenWebAuthnCredential(func(webauthnuser *types.WebAuthnUser) (*webauthn.Credential, error) {
+			previous = webauthnuser.Credentials
+			return util.ValidateLogin(ctx, webauthnuser, pending.SessionData, &parsed)
+		}).
+		// Apply the backup policy of the tenant and record a first backup
+		ThenWebAuthnCredential(func(webauthnCredential *webauthn.Credential) (*webauthn.Credential, error) {
+			return enforceBackupPolicy(ctx, db, pending.UserID, pending.Username, previous, webauthnCredential)
+		}).
+		ThenString(func(webauthnCredential *webauthn.Credential) (string, error) {
+			approved = webauthnCredential
+			credentialID := util.EncodeRawURLEncoding(parsed.RawID)
+			var publicKey string
+			for _, sc := range stored {
+				if sc.CredentialID == credentialID {
+					publicKey = sc.PublicKey
+				}
+			}
+			proof = txconfirm.NewProof(t.ID, t.RelyingParty.ID, t.RelyingParty.AllOrigins(), pending, publicKey, &parsed, time.Now().UTC())
+			// Never hand out a proof that auditors could not verify
+			if err := txconfirm.Verify(proof); err != nil {
+				return "", weberror.UnexpectedError(err, "verify transaction proof").LogCtx(ctx)
+			}
+			// Only the first of concurrent approvals finds the transaction still pending
+			return session.TakeWebauthnSessionData(ctx, redisClient, pendingKey)
+		}).
+		ThenSQLResult(func(_ string) (sql.Result, error) {
+			return credential.UpdateCredentialAfterLogin(db, util.EncodeCredential(approved))
+		}).
+		ThenSQLResult(func(_ sql.Result) (sql.Result, error) {
+			return txconfirm.SaveProof(db, pending.UserID, proof)
+		}).
+		ThenBytes(func(_ sql.Result) ([]byte, error) {
+			_ = audit.Record(db, audit.Entry{
+				Actor:    "user",
+				Action:   audit.ActionTransactionApprove,
+				UserID:   pending.UserID,
+				Username: pending.Username,
+				IP:       clientip.IP(ctx),
+				Detail:   map[string]interface{}{"transactionId": pending.TransactionID},
+			})
+			return util.MarshalAndRespondOnError(ctx, proof)
+		}).
+		Match(respondJSON(ctx, "HandleTransactionVerification"))
+}
+
+// HandleGetTransactionProof returns the proof of an approved transaction of the tenant.
+func HandleGetTransactionProof(ctx *fasthttp.RequestCtx, db *sql.DB) {
+	transactionID, _ := ctx.UserValue("transactionId").(string)
+
+	types.NewTryIO(func() (*txconfirm.Proof, error) {
+		return txconfirm.QueryProof(db, tenant.From(ctx).ID, transactionID)
+	}).
+		ThenBytes(func(proof *txconfirm.Proof) ([]byte, error) {
+			return util.MarshalAndRespondOnError(ctx, proof)
+		}).
+		Match(respondJSON(ctx, "HandleGetTransactionProof"))
+}
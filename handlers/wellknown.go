@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/valyala/fasthttp"
+)
+
+// HandleWellKnownWebAuthn serves the related origins document of the tenant. Browsers
+// fetch it from https://<RP ID>/.well-known/webauthn when a ceremony for the RP ID runs
+// on an origin of another domain, and only proceed when that origin is listed.
+func HandleWellKnownWebAuthn(ctx *fasthttp.RequestCtx) {
+	t := tenant.From(ctx)
+	if t == nil || len(t.RelyingParty.RelatedOrigins) == 0 {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		ctx.SetContentType("application/json")
+		ctx.SetBodyString(`{"error": "No related origins"}`)
+		return
+	}
+
+	response, err := json.Marshal(map[string]interface{}{
+		"origins": t.RelyingParty.AllOrigins(),
+	})
+	if err != nil {
+		weberror.ToHTTPError(weberror.JSONMarshalError(err)).RespondAndLog(ctx)
+		return
+	}
+	ctx.SetContentType("application/json")
+	ctx.Response.Header.Set("Cache-Control", "public, max-age=3600")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBody(response)
+}
@@ -0,0 +1,182 @@
+// Package aaguid resolves the AAGUID of a credential, which identifies the model of
+// its authenticator, to a name and icon users recognize. Names come from, in order of
+// precedence, the authenticator_overrides table, the community list of passkey
+// providers embedded in the binary, and a local copy of the FIDO Metadata Service.
+//
+// The names are for display only; nothing here is used to decide whether a
+// credential is trusted.
+package aaguid
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/jamesyang124/webauthn-example/types"
+)
+
+// Zero is the AAGUID of authenticators that do not disclose their model, and of
+// credentials registered with "none" attestation by some clients.
+const Zero = "00000000-0000-0000-0000-000000000000"
+
+// passkeyProviders is a subset of https://github.com/passkeydeveloper/passkey-authenticator-aaguids
+// in its combined_aaguid.json format.
+//
+//go:embed passkey_providers.json
+var passkeyProviders []byte
+
+// communityEntry is an entry of the community list.
+type communityEntry struct {
+	Name      string `json:"name"`
+	IconDark  string `json:"icon_dark"`
+	IconLight string `json:"icon_light"`
+}
+
+var (
+	mu       sync.RWMutex
+	registry = mustEmbedded()
+)
+
+func mustEmbedded() map[string]types.Authenticator {
+	entries, err := parseCommunity(passkeyProviders)
+	if err != nil {
+		panic(fmt.Sprintf("aaguid: embedded passkey providers: %v", err))
+	}
+	return entries
+}
+
+func parseCommunity(data []byte) (map[string]types.Authenticator, error) {
+	var list map[string]communityEntry
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	entries := make(map[string]types.Authenticator, len(list))
+	for id, e := range list {
+		key, ok := Normalize(id)
+		if !ok {
+			return nil, fmt.Errorf("invalid AAGUID %q", id)
+		}
+		entries[key] = types.Authenticator{Name: e.Name, Icon: e.IconLight, IconDark: e.IconDark}
+	}
+	return entries, nil
+}
+
+// Load replaces the registry with the embedded list merged with the metadata
+// statements of cfg.MDSFile. The embedded names win, since they are the ones users
+// see in their password managers; the MDS adds the authenticators the list lacks,
+// mostly security keys, and icons.
+func Load(cfg config.Authenticators) error {
+	entries := mustEmbedded()
+	if cfg.MDSFile != "" {
+		data, err := os.ReadFile(cfg.MDSFile)
+		if err != nil {
+			return fmt.Errorf("read AAGUID_MDS_FILE: %w", err)
+		}
+		statements, err := parseMDS(data)
+		if err != nil {
+			return fmt.Errorf("parse AAGUID_MDS_FILE: %w", err)
+		}
+		for id, statement := range statements {
+			entry, ok := entries[id]
+			if !ok {
+				entries[id] = statement
+				continue
+			}
+			if entry.Icon == "" && entry.IconDark == "" {
+				entry.Icon = statement.Icon
+				entries[id] = entry
+			}
+		}
+	}
+
+	mu.Lock()
+	registry = entries
+	mu.Unlock()
+	return nil
+}
+
+// Lookup returns the authenticator of an AAGUID from the embedded list and the MDS,
+// without the overrides.
+func Lookup(aaguid string) (types.Authenticator, bool) {
+	key, ok := Normalize(aaguid)
+	if !ok || key == Zero {
+		return types.Authenticator{}, false
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	entry, ok := registry[key]
+	return entry, ok
+}
+
+// Resolve returns the authenticators of the AAGUIDs that are known, overrides first.
+func Resolve(db *sql.DB, aaguids []string) (map[string]types.Authenticator, error) {
+	keys := make([]string, 0, len(aaguids))
+	for _, id := range aaguids {
+		if key, ok := Normalize(id); ok && key != Zero {
+			keys = append(keys, key)
+		}
+	}
+	resolved := map[string]types.Authenticator{}
+	if len(keys) == 0 {
+		return resolved, nil
+	}
+
+	overrides, err := QueryOverrides(db, keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if entry, ok := overrides[key]; ok {
+			resolved[key] = entry
+		} else if entry, ok := Lookup(key); ok {
+			resolved[key] = entry
+		}
+	}
+	return resolved, nil
+}
+
+// Annotate sets the Authenticator of the credentials whose AAGUID is known.
+func Annotate(db *sql.DB, credentials []types.StoredCredential) error {
+	aaguids := make([]string, len(credentials))
+	for i, c := range credentials {
+		aaguids[i] = c.AAGUID
+	}
+	resolved, err := Resolve(db, aaguids)
+	if err != nil {
+		return err
+	}
+	for i, c := range credentials {
+		if key, ok := Normalize(c.AAGUID); ok {
+			if entry, ok := resolved[key]; ok {
+				credentials[i].Authenticator = &entry
+			}
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the authenticator of an AAGUID, or "" when it is unknown
+// or cannot be resolved. It is meant for audit entries, which are recorded best effort.
+func Name(db *sql.DB, aaguid string) string {
+	resolved, err := Resolve(db, []string{aaguid})
+	if err != nil {
+		return ""
+	}
+	key, _ := Normalize(aaguid)
+	return resolved[key].Name
+}
+
+// Normalize returns the canonical lower case form of an AAGUID.
+func Normalize(aaguid string) (string, bool) {
+	id, err := uuid.Parse(strings.TrimSpace(aaguid))
+	if err != nil {
+		return "", false
+	}
+	return id.String(), true
+}
@@ -0,0 +1,59 @@
+package aaguid
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/jamesyang124/webauthn-example/types"
+)
+
+// mdsPayload is the part of a Metadata Service BLOB payload the registry uses.
+type mdsPayload struct {
+	Entries []struct {
+		AAGUID            string `json:"aaguid"`
+		MetadataStatement struct {
+			Description string `json:"description"`
+			Icon        string `json:"icon"`
+		} `json:"metadataStatement"`
+	} `json:"entries"`
+}
+
+// parseMDS reads the FIDO2 entries of a Metadata Service BLOB. The BLOB may be the
+// JWT served by https://mds3.fidoalliance.org/ or its JSON payload. The signature of
+// the JWT is not verified: the names and icons are only displayed, and checking the
+// certificate chain would need its revocation lists from the network.
+func parseMDS(data []byte) (map[string]types.Authenticator, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] != '{' {
+		parts := strings.Split(string(data), ".")
+		if len(parts) != 3 {
+			return nil, errors.New("neither a JWT nor a JSON document")
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+		if err != nil {
+			return nil, err
+		}
+		data = payload
+	}
+
+	var payload mdsPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	entries := map[string]types.Authenticator{}
+	for _, e := range payload.Entries {
+		// U2F and UAF entries have no AAGUID
+		key, ok := Normalize(e.AAGUID)
+		if !ok || key == Zero || e.MetadataStatement.Description == "" {
+			continue
+		}
+		entries[key] = types.Authenticator{
+			Name: e.MetadataStatement.Description,
+			Icon: e.MetadataStatement.Icon,
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,86 @@
+package aaguid
+
+import (
+	"database/sql"
+
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/jamesyang124/webauthn-example/types"
+	"github.com/lib/pq"
+)
+
+// Override names an authenticator model, typically one managed by the enterprise,
+// in place of the embedded list and the MDS.
+type Override struct {
+	AAGUID string `json:"aaguid"`
+	types.Authenticator
+}
+
+// QueryOverrides returns the overrides of the AAGUIDs, keyed by AAGUID.
+func QueryOverrides(db *sql.DB, aaguids []string) (map[string]types.Authenticator, error) {
+	rows, err := db.Query(
+		"SELECT aaguid, name, icon, icon_dark FROM authenticator_overrides WHERE aaguid = ANY($1::uuid[])",
+		pq.Array(aaguids),
+	)
+	if err != nil {
+		return nil, weberror.DatabaseQueryError(err, "query authenticator overrides")
+	}
+	defer rows.Close()
+
+	overrides := map[string]types.Authenticator{}
+	for rows.Next() {
+		var o Override
+		if err := rows.Scan(&o.AAGUID, &o.Name, &o.Icon, &o.IconDark); err != nil {
+			return nil, weberror.DatabaseQueryError(err, "scan authenticator override")
+		}
+		overrides[o.AAGUID] = o.Authenticator
+	}
+	if err := rows.Err(); err != nil {
+		return nil, weberror.DatabaseQueryError(err, "iterate authenticator overrides")
+	}
+	return overrides, nil
+}
+
+// ListOverrides returns every override, ordered by name.
+func ListOverrides(db *sql.DB) ([]Override, error) {
+	rows, err := db.Query("SELECT aaguid, name, icon, icon_dark FROM authenticator_overrides ORDER BY name, aaguid")
+	if err != nil {
+		return nil, weberror.DatabaseQueryError(err, "list authenticator overrides")
+	}
+	defer rows.Close()
+
+	overrides := []Override{}
+	for rows.Next() {
+		var o Override
+		if err := rows.Scan(&o.AAGUID, &o.Name, &o.Icon, &o.IconDark); err != nil {
+			return nil, weberror.DatabaseQueryError(err, "scan authenticator override")
+		}
+		overrides = append(overrides, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, weberror.DatabaseQueryError(err, "iterate authenticator overrides")
+	}
+	return overrides, nil
+}
+
+// SetOverride creates or replaces the override of an AAGUID.
+func SetOverride(db *sql.DB, o Override) (sql.Result, error) {
+	result, err := db.Exec(
+		`INSERT INTO authenticator_overrides (aaguid, name, icon, icon_dark) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (aaguid) DO UPDATE
+		SET name = EXCLUDED.name, icon = EXCLUDED.icon, icon_dark = EXCLUDED.icon_dark, updated_at = CURRENT_TIMESTAMP`,
+		o.AAGUID, o.Name, o.Icon, o.IconDark,
+	)
+	if err != nil {
+		return nil, weberror.DatabaseUpdateError(err, "set authenticator override")
+	}
+	return result, nil
+}
+
+// DeleteOverride removes the override of an AAGUID.
+func DeleteOverride(db *sql.DB, aaguid string) (sql.Result, error) {
+	result, err := db.Exec("DELETE FROM authenticator_overrides WHERE aaguid = $1", aaguid)
+	if err != nil {
+		return nil, weberror.DatabaseUpdateError(err, "delete authenticator override")
+	}
+	return result, nil
+}
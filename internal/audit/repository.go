@@ -0,0 +1,118 @@
+// Package audit records security relevant actions in the audit_events table and exports them.
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/jamesyang124/webauthn-example/types"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionRegister           = "webauthn.register"
+	ActionLogin              = "webauthn.login"
+	ActionUserCreate         = "admin.user.create"
+	ActionCredentialRevoke   = "admin.credential.revoke"
+	ActionPasskeysReset      = "admin.passkeys.reset"
+	ActionChallengesPurge    = "admin.challenges.purge"
+	ActionSessionsRevoke     = "admin.sessions.revoke"
+	ActionUserLock           = "admin.user.lock"
+	ActionUserUnlock         = "admin.user.unlock"
+	ActionRolesSet           = "admin.user.roles"
+	ActionStepUp             = "webauthn.stepup"
+	ActionCredentialDelete   = "account.credential.delete"
+	ActionEmailChange        = "account.email.change"
+	ActionTransactionApprove = "webauthn.transaction.approve"
+	ActionAuthenticatorSet   = "admin.authenticator.set"
+	ActionAuthenticatorUnset = "admin.authenticator.unset"
+	ActionCredentialBackedUp = "webauthn.credential.backed_up"
+	ActionPasswordLogin      = "password.login"
+	ActionPasswordLoginSet   = "account.password_login.set"
+	ActionSignup             = "user.signup"
+)
+
+// Entry is an audit event to record. UserID and IP may be empty.
+type Entry struct {
+	Actor    string
+	Action   string
+	UserID   string
+	Username string
+	IP       string
+	Detail   map[string]interface{}
+}
+
+// Record inserts an audit event. The error is logged, so callers that must not fail
+// because of auditing can ignore it. db may be a transaction, so that the event is only
+// recorded with the change it describes.
+func Record(
+	db interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+	},
+	entry Entry,
+) error {
+	if entry.Detail == nil {
+		entry.Detail = map[string]interface{}{}
+	}
+	detail, err := json.Marshal(entry.Detail)
+	if err != nil {
+		return weberror.JSONMarshalError(err).Log()
+	}
+
+	_, err = db.Exec(
+		`INSERT INTO audit_events (actor, action, user_id, username, ip, detail)
+		VALUES ($1, $2, NULLIF($3, '')::integer, NULLIF($4, ''), NULLIF($5, ''), $6)`,
+		entry.Actor, entry.Action, entry.UserID, entry.Username, entry.IP, detail,
+	)
+	if err != nil {
+		return weberror.DatabaseUpdateError(err, "record audit event").
+			WithField("action", entry.Action).
+			Log()
+	}
+	return nil
+}
+
+// ExportEvents writes every event that occurred at or after since to w as JSON lines,
+// oldest first, and returns the number of events written.
+func ExportEvents(db *sql.DB, since time.Time, w io.Writer) (int, error) {
+	rows, err := db.Query(
+		`SELECT id, occurred_at, actor, action, user_id, COALESCE(username, ''), COALESCE(ip, ''), detail
+		FROM audit_events
+		WHERE occurred_at >= $1
+		ORDER BY occurred_at, id`,
+		since,
+	)
+	if err != nil {
+		return 0, weberror.DatabaseQueryError(err, "query audit events")
+	}
+	defer rows.Close()
+
+	encoder := json.NewEncoder(w)
+	count := 0
+	for rows.Next() {
+		var event types.AuditEvent
+		var userID sql.NullInt64
+		var detail []byte
+		if err := rows.Scan(
+			&event.ID, &event.OccurredAt, &event.Actor, &event.Action,
+			&userID, &event.Username, &event.IP, &detail,
+		); err != nil {
+			return count, weberror.DatabaseQueryError(err, "scan audit event")
+		}
+		if userID.Valid {
+			event.UserID = &userID.Int64
+		}
+		event.Detail = detail
+		if err := encoder.Encode(event); err != nil {
+			return count, weberror.JSONMarshalError(err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, weberror.DatabaseQueryError(err, "iterate audit events")
+	}
+	return count, nil
+}
@@ -0,0 +1,60 @@
+// Package backup classifies credentials by their backup flags and applies the backup
+// policy of a tenant. A credential whose BE (backup eligible) flag is clear is bound
+// to the device it was created on; one with BE set may be synced, e.g. by a password
+// manager, and BS (backup state) tells whether it has been.
+package backup
+
+import (
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/jamesyang124/webauthn-example/internal/user"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+)
+
+// Class of a credential, derived from its backup flags.
+const (
+	// DeviceBound credentials can never leave their authenticator.
+	DeviceBound = "device-bound"
+	// Syncable credentials may be backed up but were not at the latest ceremony.
+	Syncable = "syncable"
+	// Synced credentials are backed up.
+	Synced = "synced"
+	// Unknown credentials were registered before BE was recorded and not used since.
+	Unknown = "unknown"
+)
+
+// Classify returns the class of a credential with the given flags. backupEligible is nil
+// when BE is unknown.
+func Classify(backupEligible *bool, backupState bool) string {
+	switch {
+	case backupEligible == nil:
+		return Unknown
+	case !*backupEligible:
+		return DeviceBound
+	case backupState:
+		return Synced
+	default:
+		return Syncable
+	}
+}
+
+// Policy is the backup policy of a tenant.
+type Policy struct {
+	// DeviceBoundRoles are the roles whose users may only register and log in with
+	// device-bound credentials.
+	DeviceBoundRoles []string
+}
+
+// NewPolicy returns the backup policy of a tenant.
+func NewPolicy(cfg config.TenantPolicy) Policy {
+	return Policy{DeviceBoundRoles: cfg.DeviceBoundRoles}
+}
+
+// Check rejects a backup eligible credential of a user holding a role that requires
+// device-bound credentials. BE never changes for a credential, so the same check
+// applies at registration and at every login.
+func (p Policy) Check(userID string, roles []string, credentialID string, backupEligible bool) error {
+	if backupEligible && user.HasAnyRole(roles, p.DeviceBoundRoles...) {
+		return weberror.DeviceBoundRequiredError(userID, credentialID)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+// Package clientip resolves the address and scheme the client used to reach the
+// server, honoring forwarding headers only when they were set by a trusted proxy.
+package clientip
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/valyala/fasthttp"
+)
+
+// Request user values holding the resolved client, see Store.
+const (
+	IPKey     = "client_ip"
+	SchemeKey = "client_scheme"
+)
+
+// Resolver finds the client of a request behind the proxies of cfg.
+type Resolver struct {
+	cfg config.Proxy
+}
+
+// NewResolver returns a resolver trusting the proxies of cfg.
+func NewResolver(cfg config.Proxy) *Resolver {
+	return &Resolver{cfg: cfg}
+}
+
+// Store resolves the client of the request and keeps it for IP and Scheme.
+func (r *Resolver) Store(ctx *fasthttp.RequestCtx) {
+	ip, scheme := r.Resolve(ctx)
+	ctx.SetUserValue(IPKey, ip)
+	ctx.SetUserValue(SchemeKey, scheme)
+}
+
+// IP returns the client address stored by Store, or the address of the connection.
+func IP(ctx *fasthttp.RequestCtx) string {
+	if ip, ok := ctx.UserValue(IPKey).(string); ok {
+		return ip
+	}
+	return ctx.RemoteIP().String()
+}
+
+// Scheme returns the scheme stored by Store, or the scheme of the connection.
+func Scheme(ctx *fasthttp.RequestCtx) string {
+	if scheme, ok := ctx.UserValue(SchemeKey).(string); ok {
+		return scheme
+	}
+	return connectionScheme(ctx)
+}
+
+// Resolve returns the client address and the scheme, "http" or "https", it connected
+// with. Without a trusted proxy in front, they are those of the connection.
+func (r *Resolver) Resolve(ctx *fasthttp.RequestCtx) (ip, scheme string) {
+	ip = ctx.RemoteIP().String()
+	scheme = connectionScheme(ctx)
+
+	remote, ok := netip.AddrFromSlice(ctx.RemoteIP())
+	if !ok || !r.trusted(remote.Unmap()) {
+		return ip, scheme
+	}
+
+	switch r.cfg.ClientIPHeader {
+	case config.HeaderForwarded:
+		return r.fromForwarded(ctx, ip, scheme)
+	case config.HeaderXRealIP:
+		if addr, err := parseAddr(string(ctx.Request.Header.Peek("X-Real-IP"))); err == nil {
+			ip = addr.String()
+		}
+	default:
+		hops := strings.Split(string(ctx.Request.Header.Peek("X-Forwarded-For")), ",")
+		if i := r.clientHop(len(hops), func(i int) string { return hops[i] }); i >= 0 {
+			ip = mustParseAddr(hops[i]).String()
+		}
+	}
+	if proto := forwardedProto(string(ctx.Request.Header.Peek("X-Forwarded-Proto"))); proto != "" {
+		scheme = proto
+	}
+	return ip, scheme
+}
+
+// fromForwarded reads the client from the RFC 7239 Forwarded header, taking the scheme
+// from the proto parameter of the element naming the client.
+func (r *Resolver) fromForwarded(ctx *fasthttp.RequestCtx, ip, scheme string) (string, string) {
+	var elements []map[string]string
+	ctx.Request.Header.VisitAll(func(key, value []byte) {
+		if strings.EqualFold(string(key), "Forwarded") {
+			for _, element := range strings.Split(string(value), ",") {
+				elements = append(elements, parseForwardedElement(element))
+			}
+		}
+	})
+	i := r.clientHop(len(elements), func(i int) string { return elements[i]["for"] })
+	if i < 0 {
+		return ip, scheme
+	}
+	ip = mustParseAddr(elements[i]["for"]).String()
+	if proto := forwardedProto(elements[i]["proto"]); proto != "" {
+		scheme = proto
+	}
+	return ip, scheme
+}
+
+// clientHop walks the hops of a forwarding chain from the right, skipping trusted
+// proxies, and returns the index of the first untrusted one: the client. Hops left of
+// it could be forged by the client. When a hop cannot be parsed, such as an obfuscated
+// identifier, the nearest parsed hop is returned; -1 means there is none.
+func (r *Resolver) clientHop(n int, hop func(i int) string) int {
+	client := -1
+	for i := n - 1; i >= 0; i-- {
+		addr, err := parseAddr(hop(i))
+		if err != nil {
+			break
+		}
+		client = i
+		if !r.trusted(addr) {
+			break
+		}
+	}
+	return client
+}
+
+func (r *Resolver) trusted(addr netip.Addr) bool {
+	for _, prefix := range r.cfg.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAddr parses a hop of X-Forwarded-For or a Forwarded for= value, which may carry
+// a port and, for IPv6, brackets and quotes.
+func parseAddr(value string) (netip.Addr, error) {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap(), nil
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"))
+	if err != nil {
+		return addr, err
+	}
+	return addr.Unmap(), nil
+}
+
+// mustParseAddr parses a hop already accepted by clientHop.
+func mustParseAddr(value string) netip.Addr {
+	addr, _ := parseAddr(value)
+	return addr
+}
+
+// parseForwardedElement splits a Forwarded element like for=192.0.2.60;proto=https into
+// lower-cased parameter names and their unquoted values.
+func parseForwardedElement(element string) map[string]string {
+	params := map[string]string{}
+	for _, pair := range strings.Split(element, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		params[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+	return params
+}
+
+// forwardedProto returns the first scheme of a proto value when it is http or https.
+func forwardedProto(value string) string {
+	proto, _, _ := strings.Cut(value, ",")
+	switch proto = strings.ToLower(strings.TrimSpace(proto)); proto {
+	case "http", "https":
+		return proto
+	}
+	return ""
+}
+
+func connectionScheme(ctx *fasthttp.RequestCtx) string {
+	if ctx.IsTLS() {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,203 @@
+package clientip
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/valyala/fasthttp"
+)
+
+func newRequestCtx(remote string, headers map[string][]string) *fasthttp.RequestCtx {
+	var req fasthttp.Request
+	for name, values := range headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(&req, &net.TCPAddr{IP: net.ParseIP(remote), Port: 40000}, nil)
+	return ctx
+}
+
+func TestResolve(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		remote     string
+		headers    map[string][]string
+		wantIP     string
+		wantScheme string
+	}{
+		{
+			name:       "untrusted remote ignores X-Forwarded-For",
+			remote:     "203.0.113.7",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1"}, "X-Forwarded-Proto": {"https"}},
+			wantIP:     "203.0.113.7",
+			wantScheme: "http",
+		},
+		{
+			name:       "untrusted remote ignores X-Real-IP",
+			header:     config.HeaderXRealIP,
+			remote:     "203.0.113.7",
+			headers:    map[string][]string{"X-Real-IP": {"198.51.100.1"}},
+			wantIP:     "203.0.113.7",
+			wantScheme: "http",
+		},
+		{
+			name:       "untrusted remote ignores Forwarded",
+			header:     config.HeaderForwarded,
+			remote:     "203.0.113.7",
+			headers:    map[string][]string{"Forwarded": {"for=198.51.100.1;proto=https"}},
+			wantIP:     "203.0.113.7",
+			wantScheme: "http",
+		},
+		{
+			name:       "trusted remote without header",
+			remote:     "10.0.0.2",
+			wantIP:     "10.0.0.2",
+			wantScheme: "http",
+		},
+		{
+			name:       "single hop behind trusted proxy",
+			remote:     "10.0.0.2",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1"}, "X-Forwarded-Proto": {"https"}},
+			wantIP:     "198.51.100.1",
+			wantScheme: "https",
+		},
+		{
+			name:       "forged left-hand hop is skipped",
+			remote:     "10.0.0.2",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.2.3.4, 198.51.100.1"}},
+			wantIP:     "198.51.100.1",
+			wantScheme: "http",
+		},
+		{
+			name:       "forged trusted-looking hop left of the client is skipped",
+			remote:     "10.0.0.2",
+			headers:    map[string][]string{"X-Forwarded-For": {"10.9.9.9, 198.51.100.1, 10.0.0.3"}},
+			wantIP:     "198.51.100.1",
+			wantScheme: "http",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remote:     "10.0.0.2",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1, 10.0.0.4, 10.0.0.3"}},
+			wantIP:     "198.51.100.1",
+			wantScheme: "http",
+		},
+		{
+			name:       "unparsable hop stops at nearest parsed hop",
+			remote:     "10.0.0.2",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1, garbage, 10.0.0.3"}},
+			wantIP:     "10.0.0.3",
+			wantScheme: "http",
+		},
+		{
+			name:       "unparsable only hop keeps the connection",
+			remote:     "10.0.0.2",
+			headers:    map[string][]string{"X-Forwarded-For": {"unknown"}},
+			wantIP:     "10.0.0.2",
+			wantScheme: "http",
+		},
+		{
+			name:       "hop with port",
+			remote:     "10.0.0.2",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1:5555"}},
+			wantIP:     "198.51.100.1",
+			wantScheme: "http",
+		},
+		{
+			name:       "IPv6 trusted remote and hop",
+			remote:     "fd00::2",
+			headers:    map[string][]string{"X-Forwarded-For": {"[2001:db8::1]:443"}},
+			wantIP:     "2001:db8::1",
+			wantScheme: "http",
+		},
+		{
+			name:       "unknown proto is ignored",
+			remote:     "10.0.0.2",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1"}, "X-Forwarded-Proto": {"gopher"}},
+			wantIP:     "198.51.100.1",
+			wantScheme: "http",
+		},
+		{
+			name:       "X-Real-IP from trusted proxy",
+			header:     config.HeaderXRealIP,
+			remote:     "10.0.0.2",
+			headers:    map[string][]string{"X-Real-IP": {"198.51.100.1"}, "X-Forwarded-For": {"1.2.3.4"}},
+			wantIP:     "198.51.100.1",
+			wantScheme: "http",
+		},
+		{
+			name:       "Forwarded takes proto of the client element",
+			header:     config.HeaderForwarded,
+			remote:     "10.0.0.2",
+			headers:    map[string][]string{"Forwarded": {`for=1.2.3.4;proto=http, for="198.51.100.1:80";proto=https, for=10.0.0.3;proto=http`}},
+			wantIP:     "198.51.100.1",
+			wantScheme: "https",
+		},
+		{
+			name:       "Forwarded across repeated headers",
+			header:     config.HeaderForwarded,
+			remote:     "10.0.0.2",
+			headers:    map[string][]string{"Forwarded": {"for=1.2.3.4", `for="[2001:db8::1]";proto=https`}},
+			wantIP:     "2001:db8::1",
+			wantScheme: "https",
+		},
+		{
+			name:       "Forwarded obfuscated identifier",
+			header:     config.HeaderForwarded,
+			remote:     "10.0.0.2",
+			headers:    map[string][]string{"Forwarded": {"for=_hidden;proto=https"}},
+			wantIP:     "10.0.0.2",
+			wantScheme: "http",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == "" {
+				header = config.HeaderXForwardedFor
+			}
+			r := NewResolver(config.Proxy{TrustedProxies: trusted, ClientIPHeader: header})
+
+			ip, scheme := r.Resolve(newRequestCtx(tt.remote, tt.headers))
+			if ip != tt.wantIP || scheme != tt.wantScheme {
+				t.Errorf("Resolve() = %s, %s, want %s, %s", ip, scheme, tt.wantIP, tt.wantScheme)
+			}
+		})
+	}
+}
+
+func TestClientHop(t *testing.T) {
+	r := NewResolver(config.Proxy{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}})
+
+	tests := []struct {
+		name string
+		hops []string
+		want int
+	}{
+		{"no hops", nil, -1},
+		{"untrusted last hop", []string{"1.2.3.4", "198.51.100.1"}, 1},
+		{"skips trusted hops", []string{"1.2.3.4", "198.51.100.1", "10.0.0.3", "10.0.0.4"}, 1},
+		{"all hops trusted", []string{"10.0.0.5", "10.0.0.3"}, 0},
+		{"unparsable last hop", []string{"198.51.100.1", "unknown"}, -1},
+		{"unparsable hop behind trusted hop", []string{"198.51.100.1", "unknown", "10.0.0.3"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.clientHop(len(tt.hops), func(i int) string { return tt.hops[i] }); got != tt.want {
+				t.Errorf("clientHop() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
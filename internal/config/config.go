@@ -0,0 +1,568 @@
+// Package config reads the relying party and HTTP policy settings from the environment.
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RelyingParty identifies the WebAuthn relying party and the origins its ceremonies may run on.
+type RelyingParty struct {
+	ID          string   `json:"id"`
+	DisplayName string   `json:"displayName"`
+	Origins     []string `json:"origins"`
+	// RelatedOrigins are origins on other domains, such as ccTLDs, that may run
+	// ceremonies for ID. Browsers check them against the /.well-known/webauthn
+	// document served on ID.
+	RelatedOrigins []string `json:"relatedOrigins"`
+}
+
+// AllOrigins returns the origins and the related origins.
+func (rp RelyingParty) AllOrigins() []string {
+	return append(append([]string{}, rp.Origins...), rp.RelatedOrigins...)
+}
+
+// LegacyAPI schedules the retirement of the unversioned /webauthn/... routes.
+type LegacyAPI struct {
+	// DeprecatedAt is announced in the Deprecation header of their responses.
+	DeprecatedAt time.Time
+	// Sunset is when they stop working, announced in the Sunset header.
+	Sunset time.Time
+}
+
+// CORS configures which cross-origin callers may use the API.
+type CORS struct {
+	// AllowedOrigins are exact origins or wildcard subdomain patterns such as
+	// https://*.example.com. Defaults to the relying party origins.
+	AllowedOrigins []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+	MaxAge         time.Duration
+}
+
+// Security configures the security headers sent with every response.
+type Security struct {
+	// HSTSMaxAge is sent in Strict-Transport-Security on TLS responses; zero disables it.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	// FrameAncestors are the CSP frame-ancestors sources allowed to embed the SPA.
+	// Empty means the SPA cannot be framed.
+	FrameAncestors []string
+	// WebAuthnDelegates are the origins of iframes allowed to run ceremonies, delegated
+	// through the publickey-credentials-get/create permissions.
+	WebAuthnDelegates []string
+	// ConnectSources are extra CSP connect-src sources, e.g. an API on another origin.
+	ConnectSources []string
+}
+
+// Server configures the listeners and lifecycle of the HTTP server.
+type Server struct {
+	// Addr is the address of the API listener, served over TLS when TLS is enabled.
+	Addr string
+	// DrainDelay is how long the server keeps serving after SIGTERM with /readyz failing,
+	// so that load balancers notice and stop sending requests before it stops accepting them.
+	DrainDelay time.Duration
+	// ShutdownTimeout bounds how long in-flight requests may drain after the DrainDelay.
+	ShutdownTimeout time.Duration
+	// StartupAttempts and StartupMaxBackoff control how long the server waits for
+	// Postgres and Redis to become reachable before giving up.
+	StartupAttempts   int
+	StartupMaxBackoff time.Duration
+}
+
+// TLS configures native TLS termination. It is enabled when CertFile is set.
+type TLS struct {
+	CertFile string
+	KeyFile  string
+	// ReloadInterval is how often the certificate files are checked for changes, so
+	// that renewed certificates are served without a restart.
+	ReloadInterval time.Duration
+	MinVersion     uint16
+	// CipherSuites restricts the TLS 1.2 cipher suites; TLS 1.3 suites are not
+	// configurable. Empty uses the Go defaults.
+	CipherSuites []uint16
+	// RedirectAddr, when set, is the address of a plain HTTP listener that redirects
+	// every request to HTTPS.
+	RedirectAddr string
+}
+
+// Enabled reports whether the server terminates TLS itself.
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// AccessLog configures the per-request access log.
+type AccessLog struct {
+	// SampleRate is the fraction of successful requests that are logged, from 0 to 1.
+	// Failed requests are always logged.
+	SampleRate float64
+}
+
+// StepUp configures re-authentication before sensitive account changes.
+type StepUp struct {
+	// MaxAge is how long after a user verified login or step-up ceremony a session may
+	// make sensitive changes without verifying again.
+	MaxAge time.Duration
+}
+
+// PasswordLogin throttles password sign-in.
+type PasswordLogin struct {
+	// MaxAttempts is how many sign-ins a client IP may try for a username within Window;
+	// later attempts are rejected until the window ends.
+	MaxAttempts int
+	// Window is how long the attempts of a client IP for a username are counted, from
+	// the first one. A successful sign-in starts a new window.
+	Window time.Duration
+}
+
+// Transactions configures the transaction confirmation API.
+type Transactions struct {
+	// ServiceToken authenticates the backend services that submit transactions and
+	// read their proofs. Every service request is rejected while it is empty.
+	ServiceToken string
+	// TTL is how long a submitted transaction can be approved.
+	TTL time.Duration
+}
+
+// Authenticators configures where authenticator names and icons come from, in
+// addition to the list embedded in internal/aaguid.
+type Authenticators struct {
+	// MDSFile is a local copy of the FIDO Metadata Service BLOB, either the JWT as
+	// downloaded or its JSON payload. Empty uses the embedded list only.
+	MDSFile string
+}
+
+// LoadTransactions reads the Transactions settings, for the server and the admin CLI.
+func LoadTransactions() (Transactions, error) {
+	ttl, err := getDuration("TRANSACTION_TTL", 5*time.Minute)
+	if err != nil {
+		return Transactions{}, err
+	}
+	return Transactions{ServiceToken: os.Getenv("TRANSACTION_SERVICE_TOKEN"), TTL: ttl}, nil
+}
+
+// LoadAuthenticators reads the Authenticators settings, for the server and the admin CLI.
+func LoadAuthenticators() Authenticators {
+	return Authenticators{MDSFile: os.Getenv("AAGUID_MDS_FILE")}
+}
+
+// Headers naming the client behind a proxy, see Proxy.ClientIPHeader.
+const (
+	HeaderXForwardedFor = "x-forwarded-for"
+	HeaderXRealIP       = "x-real-ip"
+	HeaderForwarded     = "forwarded"
+)
+
+// Proxy configures how the client of a request is found behind load balancers.
+type Proxy struct {
+	// TrustedProxies are the networks of proxies whose forwarding headers are trusted.
+	TrustedProxies []netip.Prefix
+	// ClientIPHeader is the header the proxies set: HeaderXForwardedFor, HeaderXRealIP
+	// or HeaderForwarded. Only one is read, since proxies usually pass the others on
+	// unchanged from the client. The scheme comes from X-Forwarded-Proto, or from the
+	// proto parameter of Forwarded.
+	ClientIPHeader string
+}
+
+// Config is the application configuration shared by the server and the CLI.
+type Config struct {
+	// Tenants are the relying parties served by the deployment, see LoadTenants.
+	Tenants        []Tenant
+	CORS           CORS
+	LegacyAPI      LegacyAPI
+	Security       Security
+	Server         Server
+	TLS            TLS
+	AccessLog      AccessLog
+	Proxy          Proxy
+	StepUp         StepUp
+	PasswordLogin  PasswordLogin
+	Transactions   Transactions
+	Authenticators Authenticators
+}
+
+// Load reads the configuration from the environment and validates it.
+func Load() (*Config, error) {
+	tenants, err := LoadTenants()
+	if err != nil {
+		return nil, err
+	}
+
+	cors := CORS{
+		AllowedOrigins: splitList(os.Getenv("CORS_ALLOWED_ORIGINS")),
+		AllowedHeaders: splitList(getEnv("CORS_ALLOWED_HEADERS", "Content-Type, Authorization, X-CSRF-Token, X-Request-ID")),
+		ExposedHeaders: splitList(getEnv("CORS_EXPOSED_HEADERS", "Deprecation, Sunset, Link, X-Request-ID")),
+		MaxAge:         10 * time.Minute,
+	}
+	if len(cors.AllowedOrigins) == 0 {
+		for _, tenant := range tenants {
+			cors.AllowedOrigins = append(cors.AllowedOrigins, tenant.RelyingParty.AllOrigins()...)
+		}
+	}
+	for i, origin := range cors.AllowedOrigins {
+		normalized, err := normalizeOriginPattern(origin)
+		if err != nil {
+			return nil, fmt.Errorf("CORS_ALLOWED_ORIGINS: %w", err)
+		}
+		cors.AllowedOrigins[i] = normalized
+	}
+	maxAge, err := getDuration("CORS_MAX_AGE", cors.MaxAge)
+	if err != nil {
+		return nil, err
+	}
+	cors.MaxAge = maxAge
+
+	legacyAPI, err := loadLegacyAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	security, err := loadSecurity()
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := loadServer()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := loadTLS()
+	if err != nil {
+		return nil, err
+	}
+
+	accessLog, err := loadAccessLog()
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := loadProxy()
+	if err != nil {
+		return nil, err
+	}
+
+	stepUpMaxAge, err := getDuration("STEP_UP_MAX_AGE", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordLogin, err := loadPasswordLogin()
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := LoadTransactions()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Config{
+		Tenants:        tenants,
+		CORS:           cors,
+		LegacyAPI:      legacyAPI,
+		Security:       security,
+		Server:         server,
+		TLS:            tlsConfig,
+		AccessLog:      accessLog,
+		Proxy:          proxy,
+		StepUp:         StepUp{MaxAge: stepUpMaxAge},
+		PasswordLogin:  passwordLogin,
+		Transactions:   transactions,
+		Authenticators: LoadAuthenticators(),
+	}, nil
+}
+
+func loadPasswordLogin() (PasswordLogin, error) {
+	var p PasswordLogin
+	var err error
+	if p.MaxAttempts, err = getInt("PASSWORD_LOGIN_MAX_ATTEMPTS", 5); err != nil {
+		return p, err
+	}
+	if p.MaxAttempts < 1 {
+		return p, fmt.Errorf("PASSWORD_LOGIN_MAX_ATTEMPTS: must be at least 1, got %d", p.MaxAttempts)
+	}
+	if p.Window, err = getDuration("PASSWORD_LOGIN_WINDOW", 15*time.Minute); err != nil {
+		return p, err
+	}
+	if p.Window <= 0 {
+		return p, fmt.Errorf("PASSWORD_LOGIN_WINDOW: must be positive")
+	}
+	return p, nil
+}
+
+func loadTLS() (TLS, error) {
+	t := TLS{
+		CertFile:     os.Getenv("TLS_CERT_FILE"),
+		KeyFile:      os.Getenv("TLS_KEY_FILE"),
+		RedirectAddr: os.Getenv("HTTP_REDIRECT_ADDR"),
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return t, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if t.RedirectAddr != "" && !t.Enabled() {
+		return t, fmt.Errorf("HTTP_REDIRECT_ADDR: requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	var err error
+	if t.ReloadInterval, err = getDuration("TLS_RELOAD_INTERVAL", time.Minute); err != nil {
+		return t, err
+	}
+
+	switch v := getEnv("TLS_MIN_VERSION", "1.2"); v {
+	case "1.2":
+		t.MinVersion = tls.VersionTLS12
+	case "1.3":
+		t.MinVersion = tls.VersionTLS13
+	default:
+		return t, fmt.Errorf("TLS_MIN_VERSION: expected 1.2 or 1.3, got %q", v)
+	}
+
+	// Only the suites Go considers secure can be selected
+	suites := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+	for _, name := range splitList(os.Getenv("TLS_CIPHER_SUITES")) {
+		id, ok := suites[strings.ToUpper(name)]
+		if !ok {
+			return t, fmt.Errorf("TLS_CIPHER_SUITES: unknown or insecure cipher suite %q", name)
+		}
+		t.CipherSuites = append(t.CipherSuites, id)
+	}
+	return t, nil
+}
+
+func loadAccessLog() (AccessLog, error) {
+	var accessLog AccessLog
+	var err error
+	if accessLog.SampleRate, err = getFloat("ACCESS_LOG_SAMPLE_RATE", 1); err != nil {
+		return accessLog, err
+	}
+	if accessLog.SampleRate < 0 || accessLog.SampleRate > 1 {
+		return accessLog, fmt.Errorf("ACCESS_LOG_SAMPLE_RATE: must be between 0 and 1")
+	}
+	return accessLog, nil
+}
+
+func loadProxy() (Proxy, error) {
+	proxy := Proxy{ClientIPHeader: strings.ToLower(getEnv("CLIENT_IP_HEADER", HeaderXForwardedFor))}
+	switch proxy.ClientIPHeader {
+	case HeaderXForwardedFor, HeaderXRealIP, HeaderForwarded:
+	default:
+		return proxy, fmt.Errorf("CLIENT_IP_HEADER: expected X-Forwarded-For, X-Real-IP or Forwarded, got %q", proxy.ClientIPHeader)
+	}
+	var err error
+	if proxy.TrustedProxies, err = parsePrefixes("TRUSTED_PROXIES"); err != nil {
+		return proxy, err
+	}
+	return proxy, nil
+}
+
+// parsePrefixes reads a comma separated list of CIDRs or single IP addresses.
+func parsePrefixes(key string) ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	for _, item := range splitList(os.Getenv(key)) {
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid address %q", key, item)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid CIDR %q", key, item)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func loadLegacyAPI() (LegacyAPI, error) {
+	var legacy LegacyAPI
+	var err error
+	if legacy.DeprecatedAt, err = getTime("LEGACY_API_DEPRECATED_AT", time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)); err != nil {
+		return legacy, err
+	}
+	if legacy.Sunset, err = getTime("LEGACY_API_SUNSET", time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)); err != nil {
+		return legacy, err
+	}
+	if legacy.Sunset.Before(legacy.DeprecatedAt) {
+		return legacy, fmt.Errorf("LEGACY_API_SUNSET: must not be before LEGACY_API_DEPRECATED_AT")
+	}
+	return legacy, nil
+}
+
+func loadServer() (Server, error) {
+	server := Server{Addr: getEnv("LISTEN_ADDR", ":8080")}
+	var err error
+	if server.DrainDelay, err = getDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second); err != nil {
+		return server, err
+	}
+	if server.ShutdownTimeout, err = getDuration("SHUTDOWN_TIMEOUT", 30*time.Second); err != nil {
+		return server, err
+	}
+	if server.StartupAttempts, err = getInt("STARTUP_RETRY_ATTEMPTS", 10); err != nil {
+		return server, err
+	}
+	if server.StartupAttempts < 1 {
+		return server, fmt.Errorf("STARTUP_RETRY_ATTEMPTS: must be at least 1")
+	}
+	if server.StartupMaxBackoff, err = getDuration("STARTUP_RETRY_MAX_BACKOFF", 10*time.Second); err != nil {
+		return server, err
+	}
+	return server, nil
+}
+
+func loadSecurity() (Security, error) {
+	security := Security{
+		FrameAncestors:    splitList(os.Getenv("SECURITY_FRAME_ANCESTORS")),
+		WebAuthnDelegates: splitList(os.Getenv("SECURITY_WEBAUTHN_DELEGATE_ORIGINS")),
+		ConnectSources:    splitList(os.Getenv("CSP_CONNECT_SRC")),
+	}
+	var err error
+	if security.HSTSMaxAge, err = getDuration("SECURITY_HSTS_MAX_AGE", 365*24*time.Hour); err != nil {
+		return security, err
+	}
+	if security.HSTSIncludeSubdomains, err = getBool("SECURITY_HSTS_INCLUDE_SUBDOMAINS", false); err != nil {
+		return security, err
+	}
+	for _, list := range []struct {
+		key     string
+		origins []string
+	}{
+		{"SECURITY_FRAME_ANCESTORS", security.FrameAncestors},
+		{"SECURITY_WEBAUTHN_DELEGATE_ORIGINS", security.WebAuthnDelegates},
+		{"CSP_CONNECT_SRC", security.ConnectSources},
+	} {
+		for i, origin := range list.origins {
+			normalized, err := NormalizeOrigin(origin)
+			if err != nil {
+				return security, fmt.Errorf("%s: %w", list.key, err)
+			}
+			list.origins[i] = normalized
+		}
+	}
+	return security, nil
+}
+
+// NormalizeOrigin validates a scheme://host[:port] origin and returns it in lower case.
+func NormalizeOrigin(origin string) (string, error) {
+	u, err := url.Parse(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid origin %q: %w", origin, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid origin %q: scheme must be http or https", origin)
+	}
+	if u.Host == "" || u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", fmt.Errorf("invalid origin %q: expected scheme://host[:port]", origin)
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// normalizeOriginPattern accepts an origin or an origin whose host starts with "*."
+func normalizeOriginPattern(pattern string) (string, error) {
+	scheme, host, ok := strings.Cut(strings.TrimSpace(pattern), "://*.")
+	if !ok {
+		return NormalizeOrigin(pattern)
+	}
+	normalized, err := NormalizeOrigin(scheme + "://" + host)
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(strings.Split(host, ":")[0], ".") {
+		return "", fmt.Errorf("invalid origin %q: wildcard must cover a subdomain of a registrable domain", pattern)
+	}
+	return strings.Replace(normalized, "://", "://*.", 1), nil
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// splitList splits a comma separated value, dropping empty items.
+func splitList(v string) []string {
+	items := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getDuration is like getEnv for time.Duration values.
+func getDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s: invalid duration %q", key, v)
+	}
+	return d, nil
+}
+
+// getTime is like getEnv for RFC 3339 times.
+func getTime(key string, fallback time.Time) (time.Time, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: invalid RFC 3339 time %q", key, v)
+	}
+	return t, nil
+}
+
+// getBool is like getEnv for boolean values.
+func getBool(key string, fallback bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: invalid boolean %q", key, v)
+	}
+	return b, nil
+}
+
+// getFloat is like getEnv for floating point values.
+func getFloat(key string, fallback float64) (float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid number %q", key, v)
+	}
+	return f, nil
+}
+
+// getInt is like getEnv for integer values.
+func getInt(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid integer %q", key, v)
+	}
+	return i, nil
+}
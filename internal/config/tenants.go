@@ -0,0 +1,250 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultTenantID is the tenant of a deployment configured with WEBAUTHN_RP_* only,
+// and of every user created before tenants existed.
+const DefaultTenantID = "default"
+
+// RegistrationProfile sets the options of a registration ceremony. Empty values keep
+// the defaults of the WebAuthn library, or those of the tenant policy for a named
+// profile.
+type RegistrationProfile struct {
+	// UserVerification is required, preferred or discouraged.
+	UserVerification string `json:"userVerification"`
+	// ResidentKey is required, preferred or discouraged.
+	ResidentKey string `json:"residentKey"`
+	// Attestation is none, indirect, direct or enterprise.
+	Attestation string `json:"attestation"`
+	// Attachment is platform or cross-platform.
+	Attachment string `json:"attachment"`
+	// Hints are security-key, client-device or hybrid, most preferred first.
+	Hints []string `json:"hints"`
+}
+
+// TenantPolicy sets the ceremony options of a tenant. Its registration profile
+// applies to every registration, and its user verification to logins too.
+type TenantPolicy struct {
+	RegistrationProfile
+	// Algorithms are the COSE algorithms credentials may use, by name (ES256, EdDSA,
+	// RS256...), most preferred first. Empty keeps the defaults of the WebAuthn library.
+	Algorithms []string `json:"algorithms"`
+	// RegistrationProfiles are the overrides of the registration profile a request may
+	// ask for by name. Without the field, DefaultRegistrationProfiles are offered.
+	RegistrationProfiles map[string]RegistrationProfile `json:"registrationProfiles"`
+	// Extensions are the WebAuthn extensions requested from clients.
+	Extensions Extensions `json:"extensions"`
+	// DeviceBoundRoles are the user roles that may only use device-bound credentials,
+	// see package backup.
+	DeviceBoundRoles []string `json:"deviceBoundRoles"`
+}
+
+// Extensions enables the optional WebAuthn extensions of a tenant, see package
+// extension. credProps is always requested.
+type Extensions struct {
+	// LargeBlob is the largeBlob support registrations ask for, required or preferred.
+	// Empty disables largeBlob.
+	LargeBlob string `json:"largeBlob"`
+	// PRF enables the prf extension at registration and evaluates it at every login.
+	PRF bool `json:"prf"`
+}
+
+// DefaultRegistrationProfiles let users register either a roaming security key or
+// the platform authenticator of the device they are on.
+func DefaultRegistrationProfiles() map[string]RegistrationProfile {
+	return map[string]RegistrationProfile{
+		"security-key": {Attachment: "cross-platform", Hints: []string{"security-key"}},
+		"this-device":  {Attachment: "platform", Hints: []string{"client-device"}},
+	}
+}
+
+// Tenant is a relying party served by the deployment. Requests are routed to the
+// tenant listing their Host; a tenant without hosts serves every other host.
+type Tenant struct {
+	ID           string       `json:"id"`
+	Hosts        []string     `json:"hosts"`
+	RelyingParty RelyingParty `json:"relyingParty"`
+	Policy       TenantPolicy `json:"policy"`
+}
+
+// tenantIDPattern keeps tenant IDs safe to embed in Redis keys and log fields.
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// LoadTenants reads the tenants from the JSON array in the file named by
+// TENANTS_FILE. Without it, a single default tenant serving every host is built
+// from WEBAUTHN_RP_ID, WEBAUTHN_RP_NAME and WEBAUTHN_RP_ORIGINS.
+func LoadTenants() ([]Tenant, error) {
+	path := os.Getenv("TENANTS_FILE")
+	if path == "" {
+		tenant := Tenant{
+			ID:    DefaultTenantID,
+			Hosts: []string{},
+			RelyingParty: RelyingParty{
+				ID:             getEnv("WEBAUTHN_RP_ID", "localhost"),
+				DisplayName:    getEnv("WEBAUTHN_RP_NAME", "Example Corp"),
+				Origins:        splitList(getEnv("WEBAUTHN_RP_ORIGINS", "http://localhost:8080")),
+				RelatedOrigins: splitList(os.Getenv("WEBAUTHN_RP_RELATED_ORIGINS")),
+			},
+		}
+		if err := validateTenant(&tenant); err != nil {
+			return nil, fmt.Errorf("WEBAUTHN_RP_*: %w", err)
+		}
+		return []Tenant{tenant}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("TENANTS_FILE: %w", err)
+	}
+	var tenants []Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("TENANTS_FILE: %w", err)
+	}
+	if len(tenants) == 0 {
+		return nil, fmt.Errorf("TENANTS_FILE: at least one tenant is required")
+	}
+
+	ids := map[string]bool{}
+	hosts := map[string]string{}
+	fallback := ""
+	for i := range tenants {
+		tenant := &tenants[i]
+		if err := validateTenant(tenant); err != nil {
+			return nil, fmt.Errorf("TENANTS_FILE: tenant %q: %w", tenant.ID, err)
+		}
+		if ids[tenant.ID] {
+			return nil, fmt.Errorf("TENANTS_FILE: duplicate tenant %q", tenant.ID)
+		}
+		ids[tenant.ID] = true
+		if len(tenant.Hosts) == 0 {
+			if fallback != "" {
+				return nil, fmt.Errorf("TENANTS_FILE: tenants %q and %q both have no hosts", fallback, tenant.ID)
+			}
+			fallback = tenant.ID
+		}
+		for _, host := range tenant.Hosts {
+			if other, ok := hosts[host]; ok {
+				return nil, fmt.Errorf("TENANTS_FILE: host %q belongs to tenants %q and %q", host, other, tenant.ID)
+			}
+			hosts[host] = tenant.ID
+		}
+	}
+	return tenants, nil
+}
+
+// validateTenant checks the tenant and normalizes its hosts and origins.
+func validateTenant(tenant *Tenant) error {
+	if !tenantIDPattern.MatchString(tenant.ID) {
+		return fmt.Errorf("id must be lower case letters, digits and dashes")
+	}
+	if tenant.RelyingParty.ID == "" || tenant.RelyingParty.DisplayName == "" {
+		return fmt.Errorf("relying party id and displayName are required")
+	}
+	if len(tenant.RelyingParty.Origins) == 0 {
+		return fmt.Errorf("at least one origin is required")
+	}
+	for i, origin := range tenant.RelyingParty.Origins {
+		normalized, err := NormalizeOrigin(origin)
+		if err != nil {
+			return err
+		}
+		tenant.RelyingParty.Origins[i] = normalized
+	}
+	for i, host := range tenant.Hosts {
+		tenant.Hosts[i] = strings.ToLower(strings.TrimSpace(host))
+	}
+	if err := validateRelatedOrigins(tenant); err != nil {
+		return err
+	}
+	if err := validateRegistrationProfile(tenant.Policy.RegistrationProfile); err != nil {
+		return fmt.Errorf("policy %w", err)
+	}
+	switch tenant.Policy.Extensions.LargeBlob {
+	case "", "required", "preferred":
+	default:
+		return fmt.Errorf("policy extensions largeBlob: expected required or preferred, got %q", tenant.Policy.Extensions.LargeBlob)
+	}
+	if tenant.Policy.RegistrationProfiles == nil {
+		tenant.Policy.RegistrationProfiles = DefaultRegistrationProfiles()
+	}
+	for name, profile := range tenant.Policy.RegistrationProfiles {
+		if !tenantIDPattern.MatchString(name) {
+			return fmt.Errorf("registration profile %q: name must be lower case letters, digits and dashes", name)
+		}
+		if err := validateRegistrationProfile(profile); err != nil {
+			return fmt.Errorf("registration profile %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validateRegistrationProfile checks the values of a registration profile.
+func validateRegistrationProfile(profile RegistrationProfile) error {
+	for _, value := range []struct{ name, value string }{
+		{"userVerification", profile.UserVerification},
+		{"residentKey", profile.ResidentKey},
+	} {
+		switch value.value {
+		case "", "required", "preferred", "discouraged":
+		default:
+			return fmt.Errorf("%s: expected required, preferred or discouraged, got %q", value.name, value.value)
+		}
+	}
+	switch profile.Attestation {
+	case "", "none", "indirect", "direct", "enterprise":
+	default:
+		return fmt.Errorf("attestation: expected none, indirect, direct or enterprise, got %q", profile.Attestation)
+	}
+	switch profile.Attachment {
+	case "", "platform", "cross-platform":
+	default:
+		return fmt.Errorf("attachment: expected platform or cross-platform, got %q", profile.Attachment)
+	}
+	for _, hint := range profile.Hints {
+		switch hint {
+		case "security-key", "client-device", "hybrid":
+		default:
+			return fmt.Errorf("hints: expected security-key, client-device or hybrid, got %q", hint)
+		}
+	}
+	return nil
+}
+
+// validateRelatedOrigins checks that the related origins can work: browsers only accept
+// them from secure origins, and fetch the /.well-known/webauthn document from the RP ID
+// host, which therefore has to be served by the tenant.
+func validateRelatedOrigins(tenant *Tenant) error {
+	rp := &tenant.RelyingParty
+	if len(rp.RelatedOrigins) == 0 {
+		return nil
+	}
+	origins := map[string]bool{}
+	for _, origin := range rp.Origins {
+		origins[origin] = true
+	}
+	for i, origin := range rp.RelatedOrigins {
+		normalized, err := NormalizeOrigin(origin)
+		if err != nil {
+			return fmt.Errorf("related origin: %w", err)
+		}
+		if !strings.HasPrefix(normalized, "https://") {
+			return fmt.Errorf("related origin %q: must use https", origin)
+		}
+		if origins[normalized] {
+			return fmt.Errorf("related origin %q: already listed in origins", origin)
+		}
+		origins[normalized] = true
+		rp.RelatedOrigins[i] = normalized
+	}
+	if len(tenant.Hosts) > 0 && !slices.Contains(tenant.Hosts, strings.ToLower(rp.ID)) {
+		return fmt.Errorf("related origins need the RP ID %q among the hosts, to serve /.well-known/webauthn", rp.ID)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// Package credential provides database operations for the WebAuthn credentials of a user.
+package credential
+
+import (
+	"database/sql"
+
+	"github.com/jamesyang124/webauthn-example/internal/backup"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/jamesyang124/webauthn-example/types"
+	"github.com/lib/pq"
+)
+
+const selectColumns = `id, user_id, credential_id, public_key, sign_count,
+	transports, user_present, user_verified, backup_eligible, backup_state,
+	aaguid, attestation_type, attachment, backed_up_at,
+	discoverable, large_blob, large_blob_written_at, prf, created_at, last_used_at`
+
+func scanCredential(scanner interface{ Scan(...interface{}) error }, c *types.StoredCredential) error {
+	var (
+		aaguid             sql.NullString
+		backedUpAt         sql.NullTime
+		largeBlobWrittenAt sql.NullTime
+		lastUsedAt         sql.NullTime
+	)
+	if err := scanner.Scan(
+		&c.ID, &c.UserID, &c.CredentialID, &c.PublicKey, &c.SignCount,
+		pq.Array(&c.Transports), &c.UserPresent, &c.UserVerified, &c.BackupEligible, &c.BackupState,
+		&aaguid, &c.AttestationType, &c.Attachment, &backedUpAt,
+		&c.Discoverable, &c.LargeBlob, &largeBlobWrittenAt, &c.PRF, &c.CreatedAt, &lastUsedAt,
+	); err != nil {
+		return err
+	}
+	if c.Transports == nil {
+		c.Transports = []string{}
+	}
+	c.AAGUID = aaguid.String
+	c.BackupClass = backup.Classify(c.BackupEligible, c.BackupState)
+	if backedUpAt.Valid {
+		c.BackedUpAt = &backedUpAt.Time
+	}
+	if largeBlobWrittenAt.Valid {
+		c.LargeBlobWrittenAt = &largeBlobWrittenAt.Time
+	}
+	if lastUsedAt.Valid {
+		c.LastUsedAt = &lastUsedAt.Time
+	}
+	return nil
+}
+
+// QueryCredentialsByUserID returns every credential registered by the user, oldest first.
+func QueryCredentialsByUserID(db *sql.DB, userID string) ([]types.StoredCredential, error) {
+	rows, err := db.Query(
+		"SELECT "+selectColumns+" FROM credentials WHERE user_id = $1 ORDER BY created_at",
+		userID,
+	)
+	if err != nil {
+		return nil, weberror.DatabaseQueryError(err, "query credentials by user id")
+	}
+	defer rows.Close()
+
+	credentials := []types.StoredCredential{}
+	for rows.Next() {
+		var c types.StoredCredential
+		if err := scanCredential(rows, &c); err != nil {
+			return nil, weberror.DatabaseQueryError(err, "scan credential")
+		}
+		credentials = append(credentials, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, weberror.DatabaseQueryError(err, "iterate credentials")
+	}
+	return credentials, nil
+}
+
+// InsertCredential stores a newly registered credential, with its metadata and
+// extension outputs, for the user. db may be a transaction, as at signup.
+func InsertCredential(
+	db interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+	},
+	userID string,
+	c types.StoredCredential,
+) (sql.Result, error) {
+	query := `INSERT INTO credentials (
+		user_id, credential_id, public_key, sign_count,
+		transports, user_present, user_verified, backup_eligible, backup_state,
+		aaguid, attestation_type, attachment,
+		discoverable, large_blob, prf,
+		backed_up_at
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15,
+		CASE WHEN $9 THEN CURRENT_TIMESTAMP END)`
+	result, err := db.Exec(query,
+		userID, c.CredentialID, c.PublicKey, c.SignCount,
+		pq.Array(c.Transports), c.UserPresent, c.UserVerified, c.BackupEligible, c.BackupState,
+		sql.NullString{String: c.AAGUID, Valid: c.AAGUID != ""}, c.AttestationType, c.Attachment,
+		c.Discoverable, c.LargeBlob, c.PRF,
+	)
+	if err != nil {
+		return nil, weberror.DatabaseUpdateError(err, "insert credential")
+	}
+	return result, nil
+}
+
+// UpdateCredentialAfterLogin records the sign count, the flags and the last use of a
+// credential after a login, and when it was first seen backed up. BackupEligible is
+// only stored when it was unknown: the library rejects assertions where it changed. PRF and
+// LargeBlobWrittenAt are only updated when the login reported them.
+func UpdateCredentialAfterLogin(db *sql.DB, c types.StoredCredential) (sql.Result, error) {
+	query := `UPDATE credentials
+		SET sign_count = $1, user_present = $2, user_verified = $3, backup_state = $4,
+			backed_up_at = CASE WHEN $4 AND backed_up_at IS NULL THEN CURRENT_TIMESTAMP ELSE backed_up_at END,
+			backup_eligible = COALESCE(backup_eligible, $8),
+			prf = COALESCE($6, prf),
+			large_blob_written_at = COALESCE($7, large_blob_written_at),
+			last_used_at = CURRENT_TIMESTAMP
+		WHERE credential_id = $5`
+	result, err := db.Exec(query,
+		c.SignCount, c.UserPresent, c.UserVerified, c.BackupState, c.CredentialID,
+		c.PRF, c.LargeBlobWrittenAt, c.BackupEligible,
+	)
+	if err != nil {
+		return nil, weberror.DatabaseUpdateError(err, "update credential after login")
+	}
+	return result, nil
+}
+
+// DeleteCredential revokes a single credential owned by the user.
+func DeleteCredential(db *sql.DB, userID, credentialIDEncoded string) (sql.Result, error) {
+	result, err := db.Exec(
+		"DELETE FROM credentials WHERE user_id = $1 AND credential_id = $2",
+		userID, credentialIDEncoded,
+	)
+	if err != nil {
+		return nil, weberror.DatabaseUpdateError(err, "delete credential")
+	}
+	return result, nil
+}
+
+// DeleteCredentialsByUserID revokes every credential owned by the user. db may be a
+// transaction, as when an operator resets the passkeys of the user.
+func DeleteCredentialsByUserID(
+	db interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+	},
+	userID string,
+) (sql.Result, error) {
+	result, err := db.Exec("DELETE FROM credentials WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, weberror.DatabaseUpdateError(err, "delete credentials by user id")
+	}
+	return result, nil
+}
@@ -0,0 +1,232 @@
+// Package extension requests WebAuthn extensions from clients and records their
+// outputs with the credential. credProps is requested at every registration, to learn
+// whether the credential is discoverable. largeBlob and prf are enabled per tenant:
+// largeBlob lets the client store a small blob on the authenticator, written and read
+// back at login, and prf evaluates a pseudo-random function of the credential at every
+// login, from which the client derives an encryption key of its own.
+//
+// Extension outputs come from the client and are not signed, so they are recorded for
+// display and to pick credentials, never to decide whether one is trusted. The PRF
+// results and the contents of large blobs are secrets of the client: the server never
+// reads or stores them.
+package extension
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/jamesyang124/webauthn-example/types"
+)
+
+// Operations on the large blob a login options request may ask for.
+const (
+	LargeBlobRead  = "read"
+	LargeBlobWrite = "write"
+)
+
+// MaxLargeBlobSize is the size of the largest blob written, the least storage
+// authenticators supporting largeBlob have to offer.
+const MaxLargeBlobSize = 1024
+
+// LoginRequest is what a login options request asks of the extensions.
+type LoginRequest struct {
+	// LargeBlob is LargeBlobRead, LargeBlobWrite or empty.
+	LargeBlob string
+	// Blob is written to the credential named by CredentialID with LargeBlobWrite.
+	Blob         []byte
+	CredentialID string
+}
+
+// outputs is the part of the clientExtensionResults of a credential the package records.
+type outputs struct {
+	CredProps *struct {
+		RK *bool `json:"rk"`
+	} `json:"credProps"`
+	LargeBlob *struct {
+		Supported *bool `json:"supported"`
+		Written   *bool `json:"written"`
+	} `json:"largeBlob"`
+	PRF *struct {
+		Enabled *bool           `json:"enabled"`
+		Results json.RawMessage `json:"results"`
+	} `json:"prf"`
+}
+
+// RegistrationInputs returns the extension inputs of a registration.
+func RegistrationInputs(cfg config.Extensions) protocol.AuthenticationExtensions {
+	inputs := protocol.AuthenticationExtensions{"credProps": true}
+	if cfg.LargeBlob != "" {
+		inputs["largeBlob"] = map[string]interface{}{"support": cfg.LargeBlob}
+	}
+	if cfg.PRF {
+		inputs["prf"] = map[string]interface{}{}
+	}
+	return inputs
+}
+
+// ParseLoginRequest reads the largeBlob, blob and credentialId fields of a login
+// options request. blob is base64url encoded, and a write names the credential it
+// goes to, since clients only write with a single allowed credential.
+func ParseLoginRequest(requestData map[string]interface{}, request *LoginRequest) (string, error) {
+	operation, ok := requestData["largeBlob"].(string)
+	if !ok && requestData["largeBlob"] != nil {
+		return "", weberror.ExtensionValidationError(fmt.Errorf("largeBlob must be a string"))
+	}
+	switch operation {
+	case "", LargeBlobRead:
+	case LargeBlobWrite:
+		encoded, _ := requestData["blob"].(string)
+		blob, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil || len(blob) == 0 || len(blob) > MaxLargeBlobSize {
+			return "", weberror.ExtensionValidationError(
+				fmt.Errorf("blob must be 1 to %d base64url encoded bytes", MaxLargeBlobSize),
+			)
+		}
+		credentialID, _ := requestData["credentialId"].(string)
+		if credentialID == "" {
+			return "", weberror.ExtensionValidationError(fmt.Errorf("credentialId is required to write a blob"))
+		}
+		request.Blob = blob
+		request.CredentialID = credentialID
+	default:
+		return "", weberror.ExtensionValidationError(fmt.Errorf("largeBlob must be read or write, got %q", operation))
+	}
+	request.LargeBlob = operation
+	return operation, nil
+}
+
+// LoginOptions returns the login options carrying the extension inputs of a login with
+// the given credentials, nil for a discoverable login. A large blob request narrows the
+// allowed credentials to those supporting largeBlob, or to the one a blob is written to.
+func LoginOptions(
+	cfg config.Extensions,
+	rpID string,
+	request LoginRequest,
+	stored []types.StoredCredential,
+) ([]webauthn.LoginOption, error) {
+	inputs := protocol.AuthenticationExtensions{}
+	options := []webauthn.LoginOption{}
+	if cfg.PRF {
+		inputs["prf"] = map[string]interface{}{
+			"eval": map[string]interface{}{"first": protocol.URLEncodedBase64(prfSalt(rpID))},
+		}
+	}
+
+	if request.LargeBlob != "" {
+		if cfg.LargeBlob == "" {
+			return nil, weberror.ExtensionValidationError(fmt.Errorf("largeBlob is not enabled"))
+		}
+		allowed := []protocol.CredentialDescriptor{}
+		for _, c := range stored {
+			if c.LargeBlob == nil || !*c.LargeBlob {
+				continue
+			}
+			if request.LargeBlob == LargeBlobWrite && c.CredentialID != request.CredentialID {
+				continue
+			}
+			id, err := base64.RawURLEncoding.DecodeString(c.CredentialID)
+			if err != nil {
+				return nil, weberror.CredentialDataInvalidError(err)
+			}
+			transports := make([]protocol.AuthenticatorTransport, len(c.Transports))
+			for i, transport := range c.Transports {
+				transports[i] = protocol.AuthenticatorTransport(transport)
+			}
+			allowed = append(allowed, protocol.CredentialDescriptor{
+				Type:         protocol.PublicKeyCredentialType,
+				CredentialID: id,
+				Transport:    transports,
+			})
+		}
+		if len(allowed) == 0 {
+			return nil, weberror.ExtensionValidationError(fmt.Errorf("no credential of the user supports largeBlob"))
+		}
+		options = append(options, webauthn.WithAllowedCredentials(allowed))
+
+		if request.LargeBlob == LargeBlobWrite {
+			inputs["largeBlob"] = map[string]interface{}{"write": protocol.URLEncodedBase64(request.Blob)}
+		} else {
+			inputs["largeBlob"] = map[string]interface{}{"read": true}
+		}
+	}
+
+	if len(inputs) > 0 {
+		options = append(options, webauthn.WithAssertionExtensions(inputs))
+	}
+	return options, nil
+}
+
+// ApplyRegistration records the extension outputs of a registration on the credential.
+// credentialData is the credential field of the verification request.
+func ApplyRegistration(c *types.StoredCredential, cfg config.Extensions, credentialData interface{}) error {
+	out, err := parseOutputs(credentialData)
+	if err != nil {
+		return err
+	}
+	if out.CredProps != nil {
+		c.Discoverable = out.CredProps.RK
+	}
+	if cfg.LargeBlob != "" && out.LargeBlob != nil {
+		c.LargeBlob = out.LargeBlob.Supported
+	}
+	if cfg.PRF && out.PRF != nil {
+		c.PRF = out.PRF.Enabled
+	}
+	return nil
+}
+
+// ApplyLogin records the extension outputs of a login on the credential. Only the
+// extensions requested in the session data of the login count: PRF results mean the
+// credential supports prf, whatever the client sent in them, and a written blob is
+// recorded with the time of the login.
+func ApplyLogin(c *types.StoredCredential, requested protocol.AuthenticationExtensions, credentialData interface{}) error {
+	if len(requested) == 0 {
+		return nil
+	}
+	out, err := parseOutputs(credentialData)
+	if err != nil {
+		return err
+	}
+	if _, ok := requested["prf"]; ok && out.PRF != nil && len(out.PRF.Results) > 0 {
+		enabled := true
+		c.PRF = &enabled
+	}
+	if largeBlob, ok := requested["largeBlob"].(map[string]interface{}); ok && largeBlob["write"] != nil &&
+		out.LargeBlob != nil && out.LargeBlob.Written != nil && *out.LargeBlob.Written {
+		now := time.Now()
+		c.LargeBlobWrittenAt = &now
+	}
+	return nil
+}
+
+// parseOutputs reads the clientExtensionResults of the credential field of a request.
+func parseOutputs(credentialData interface{}) (outputs, error) {
+	var out outputs
+	credential, ok := credentialData.(map[string]interface{})
+	if !ok || credential["clientExtensionResults"] == nil {
+		return out, nil
+	}
+	data, err := json.Marshal(credential["clientExtensionResults"])
+	if err != nil {
+		return out, weberror.CredentialDataInvalidError(err)
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return out, weberror.CredentialDataInvalidError(err)
+	}
+	return out, nil
+}
+
+// prfSalt is the PRF input of every login to the relying party. PRF outputs already
+// differ per credential, so one salt is enough; changing it changes every key clients
+// derived.
+func prfSalt(rpID string) []byte {
+	sum := sha256.Sum256([]byte("webauthn-example PRF\x00" + rpID))
+	return sum[:]
+}
@@ -0,0 +1,78 @@
+// Package health tracks whether the server may receive traffic and checks the
+// dependencies it needs to serve requests.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+)
+
+// CheckTimeout bounds every dependency check of a readiness probe.
+const CheckTimeout = 2 * time.Second
+
+var draining atomic.Bool
+
+// StartDraining marks the server as shutting down, so that readiness probes fail and
+// load balancers stop routing new requests while in-flight ones complete.
+func StartDraining() {
+	draining.Store(true)
+}
+
+// Draining reports whether StartDraining was called.
+func Draining() bool {
+	return draining.Load()
+}
+
+// Check is the outcome of a single dependency check.
+type Check struct {
+	Name string
+	Err  error
+}
+
+// CheckDependencies pings Postgres and Redis and verifies that WebAuthn is configured
+// for at least one tenant.
+func CheckDependencies(ctx context.Context, db *sql.DB, redisClient *redis.Client, tenants *tenant.Registry) []Check {
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+
+	webauthnErr := error(nil)
+	if tenants == nil || len(tenants.Tenants()) == 0 {
+		webauthnErr = errors.New("no tenant is configured")
+	}
+	return []Check{
+		{Name: "postgres", Err: db.PingContext(ctx)},
+		{Name: "redis", Err: redisClient.Ping(ctx).Err()},
+		{Name: "webauthn", Err: webauthnErr},
+	}
+}
+
+// Retry calls fn until it succeeds or attempts are exhausted, doubling the wait between
+// attempts up to maxBackoff. It returns the last error, or ctx.Err() when ctx is done.
+func Retry(ctx context.Context, attempts int, maxBackoff time.Duration, fn func(ctx context.Context) error, onRetry func(attempt int, wait time.Duration, err error)) error {
+	backoff := 250 * time.Millisecond
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return err
+		}
+		wait := min(backoff, maxBackoff)
+		if onRetry != nil {
+			onRetry(attempt, wait, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,166 @@
+package logging
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// core filters entries by the level configured for the name of their logger and masks
+// sensitive fields before they reach the encoder.
+type core struct {
+	zapcore.Core
+	level    zapcore.Level
+	packages map[string]zapcore.Level
+}
+
+func newCore(inner zapcore.Core, level zapcore.Level, packages map[string]zapcore.Level) zapcore.Core {
+	return &core{Core: inner, level: level, packages: packages}
+}
+
+// levelFor returns the level of the longest configured name that is name or a parent of it.
+func (c *core) levelFor(name string) zapcore.Level {
+	for name != "" {
+		if level, ok := c.packages[name]; ok {
+			return level
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return c.level
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	return &core{Core: c.Core.With(redactFields(fields)), level: c.level, packages: c.packages}
+}
+
+func (c *core) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if entry.Level < c.levelFor(entry.LoggerName) {
+		return checked
+	}
+	// Let the wrapped core, such as a sampler, decide whether the entry is written at all
+	if c.Core.Check(entry, nil) == nil {
+		return checked
+	}
+	return checked.AddCore(entry, c)
+}
+
+func (c *core) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+// redacted replaces the value of sensitive fields.
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are normalized field keys (lower case, without separators) whose values
+// would let a reader replay or link a ceremony: challenges, credential IDs, public keys,
+// the session data holding them, and raw authenticator responses.
+var sensitiveKeys = map[string]bool{
+	"challenge":           true,
+	"credentialid":        true,
+	"rawid":               true,
+	"publickey":           true,
+	"credentialpublickey": true,
+	"sessiondata":         true,
+	"clientdatajson":      true,
+	"attestationobject":   true,
+	"authenticatordata":   true,
+	"signature":           true,
+	"userhandle":          true,
+	"sessionid":           true,
+	"csrftoken":           true,
+}
+
+func normalizeKey(key string) string {
+	return strings.NewReplacer("_", "", "-", "", ".", "").Replace(strings.ToLower(key))
+}
+
+// isSensitive matches exact keys and keys that end with a sensitive key, such as
+// credentialIDEncoded's prefix "credentialID" or "sessionDataStr".
+func isSensitive(key string) bool {
+	normalized := normalizeKey(key)
+	for sensitive := range sensitiveKeys {
+		if strings.HasPrefix(normalized, sensitive) || strings.HasSuffix(normalized, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	out := fields
+	for i, field := range fields {
+		var replacement zapcore.Field
+		switch {
+		case isSensitive(field.Key):
+			replacement = zap.String(field.Key, redacted)
+		case field.Type == zapcore.ReflectType:
+			value, changed := redactValue(field.Interface)
+			if !changed {
+				continue
+			}
+			replacement = zap.Any(field.Key, value)
+		default:
+			continue
+		}
+		// Copy on first change; callers may reuse their field slices
+		if &out[0] == &fields[0] {
+			out = append([]zapcore.Field(nil), fields...)
+		}
+		out[i] = replacement
+	}
+	return out
+}
+
+// redactValue masks sensitive keys in JSON-like maps and slices, such as parsed
+// request bodies, and reports whether anything was masked.
+func redactValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var out map[string]interface{}
+		for key, item := range v {
+			masked, changed := item, false
+			if isSensitive(key) {
+				masked, changed = redacted, true
+			} else {
+				masked, changed = redactValue(item)
+			}
+			if !changed {
+				continue
+			}
+			if out == nil {
+				out = make(map[string]interface{}, len(v))
+				for k, val := range v {
+					out[k] = val
+				}
+			}
+			out[key] = masked
+		}
+		if out == nil {
+			return value, false
+		}
+		return out, true
+	case []interface{}:
+		var out []interface{}
+		for i, item := range v {
+			masked, changed := redactValue(item)
+			if !changed {
+				continue
+			}
+			if out == nil {
+				out = append([]interface{}(nil), v...)
+			}
+			out[i] = masked
+		}
+		if out == nil {
+			return value, false
+		}
+		return out, true
+	default:
+		return value, false
+	}
+}
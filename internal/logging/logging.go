@@ -0,0 +1,150 @@
+// Package logging builds the application logger from configuration: development or
+// production mode, console or JSON output, per-package levels, redaction of WebAuthn
+// secrets, and request IDs for log correlation.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RequestIDKey is the request user value holding the request ID. fasthttp.RequestCtx
+// resolves context.Context values from its user values, so the ID is also visible to
+// code that only receives the request as a context.Context.
+const RequestIDKey = "request_id"
+
+// Config selects how the logger writes entries.
+type Config struct {
+	// Mode is "development" (colored console, debug level, stack traces on warnings)
+	// or "production" (JSON, info level, sampling).
+	Mode string
+	// Format overrides the encoding of the mode: "console" or "json".
+	Format string
+	// Level is the minimum level of every logger without a package level.
+	Level zapcore.Level
+	// PackageLevels sets the minimum level of named loggers, see L. A name also
+	// applies to its children: "handlers" covers "handlers.admin".
+	PackageLevels map[string]zapcore.Level
+}
+
+// LoadConfig reads LOG_MODE, LOG_FORMAT, LOG_LEVEL and LOG_LEVELS
+// (e.g. "handlers=debug,weberror=warn") from the environment.
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		Mode:          strings.ToLower(os.Getenv("LOG_MODE")),
+		Format:        strings.ToLower(os.Getenv("LOG_FORMAT")),
+		PackageLevels: map[string]zapcore.Level{},
+	}
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = "development"
+	case "development", "production":
+	default:
+		return cfg, fmt.Errorf("LOG_MODE: expected development or production, got %q", cfg.Mode)
+	}
+	switch cfg.Format {
+	case "", "console", "json":
+	default:
+		return cfg, fmt.Errorf("LOG_FORMAT: expected console or json, got %q", cfg.Format)
+	}
+
+	cfg.Level = zapcore.DebugLevel
+	if cfg.Mode == "production" {
+		cfg.Level = zapcore.InfoLevel
+	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := cfg.Level.UnmarshalText([]byte(v)); err != nil {
+			return cfg, fmt.Errorf("LOG_LEVEL: %w", err)
+		}
+	}
+
+	for _, item := range strings.Split(os.Getenv("LOG_LEVELS"), ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, level, ok := strings.Cut(item, "=")
+		if !ok {
+			return cfg, fmt.Errorf("LOG_LEVELS: expected name=level, got %q", item)
+		}
+		var l zapcore.Level
+		if err := l.UnmarshalText([]byte(strings.TrimSpace(level))); err != nil {
+			return cfg, fmt.Errorf("LOG_LEVELS: %w", err)
+		}
+		cfg.PackageLevels[strings.TrimSpace(name)] = l
+	}
+	return cfg, nil
+}
+
+// New builds a logger from cfg. Every entry goes through the redaction of core.go.
+func New(cfg Config) (*zap.Logger, error) {
+	zapCfg := zap.NewDevelopmentConfig()
+	if cfg.Mode == "production" {
+		zapCfg = zap.NewProductionConfig()
+	}
+	if cfg.Format != "" {
+		zapCfg.Encoding = cfg.Format
+	}
+	if zapCfg.Encoding == "json" {
+		zapCfg.EncoderConfig.EncodeLevel = zapcore.LowercaseLevelEncoder
+	}
+
+	// newCore applies the level of each logger name; the base level only has to admit the lowest
+	zapCfg.Level = zap.NewAtomicLevelAt(minLevel(cfg))
+	return zapCfg.Build(zap.WrapCore(func(inner zapcore.Core) zapcore.Core {
+		return newCore(inner, cfg.Level, cfg.PackageLevels)
+	}))
+}
+
+func minLevel(cfg Config) zapcore.Level {
+	level := cfg.Level
+	for _, l := range cfg.PackageLevels {
+		if l < level {
+			level = l
+		}
+	}
+	return level
+}
+
+// L returns the global logger named after a package, so that its level can be set
+// with LOG_LEVELS.
+func L(name string) *zap.Logger {
+	return zap.L().Named(name)
+}
+
+// RequestID returns the request ID stored by the request ID middleware, or "".
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
+
+// WithRequest adds the request ID of ctx, when there is one, to logger.
+func WithRequest(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if id := RequestID(ctx); id != "" {
+		return logger.With(zap.String("request_id", id))
+	}
+	return logger
+}
+
+// PrintfLogger adapts the named logger to the Printf interface of fasthttp.Logger, so
+// that errors of the server itself, like failed connections, reach the log.
+func PrintfLogger(name string) interface {
+	Printf(format string, args ...interface{})
+} {
+	return printfLogger{L(name).Sugar()}
+}
+
+type printfLogger struct {
+	logger *zap.SugaredLogger
+}
+
+func (p printfLogger) Printf(format string, args ...interface{}) {
+	p.logger.Warnf(format, args...)
+}
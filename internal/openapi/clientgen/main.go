@@ -0,0 +1,259 @@
+// Command clientgen generates the Go client in package client from the embedded OpenAPI document.
+//
+// It is invoked through go generate in the client package:
+//
+//	go generate ./client
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/jamesyang124/webauthn-example/internal/openapi"
+)
+
+func main() {
+	out := flag.String("o", "client_gen.go", "output file")
+	pkg := flag.String("package", "client", "package name of the generated file")
+	flag.Parse()
+
+	spec, err := openapi.Load()
+	if err != nil {
+		log.Fatalf("load spec: %v", err)
+	}
+
+	var buf bytes.Buffer
+	g := &generator{spec: spec, buf: &buf}
+	g.generate(*pkg)
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("format generated source: %v\n%s", err, buf.String())
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatalf("write %s: %v", *out, err)
+	}
+}
+
+type generator struct {
+	spec *openapi.Spec
+	buf  *bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.buf, format, args...)
+}
+
+func (g *generator) generate(pkg string) {
+	g.printf("// Code generated by internal/openapi/clientgen from internal/openapi/openapi.json. DO NOT EDIT.\n\n")
+	g.printf("package %s\n\n", pkg)
+	g.printf("import (\n\"context\"\n\"encoding/json\"\n\"net/http\"\n\"net/url\"\n)\n\n")
+	g.printf("var (\n_ = json.RawMessage{}\n_ = url.PathEscape\n)\n\n")
+
+	names := make([]string, 0, len(g.spec.Components.Schemas))
+	for name := range g.spec.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g.schemaType(name, g.spec.Components.Schemas[name])
+	}
+
+	paths := make([]string, 0, len(g.spec.Paths))
+	for path := range g.spec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		methods := make([]string, 0, len(g.spec.Paths[path]))
+		for method := range g.spec.Paths[path] {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			g.operation(path, method, g.spec.Paths[path][method])
+		}
+	}
+}
+
+func (g *generator) schemaType(name string, schema *openapi.Schema) {
+	if schema.Description != "" {
+		g.printf("// %s %s\n", name, schema.Description)
+	} else {
+		g.printf("// %s is generated from the %s schema.\n", name, name)
+	}
+	if schema.Type != "object" || len(schema.Properties) == 0 {
+		g.printf("type %s = %s\n\n", name, goType(schema))
+		return
+	}
+
+	required := map[string]bool{}
+	for _, field := range schema.Required {
+		required[field] = true
+	}
+	props := make([]string, 0, len(schema.Properties))
+	for prop := range schema.Properties {
+		props = append(props, prop)
+	}
+	sort.Strings(props)
+
+	g.printf("type %s struct {\n", name)
+	for _, prop := range props {
+		propSchema := schema.Properties[prop]
+		typ := goType(propSchema)
+		tag := prop
+		if !required[prop] {
+			tag += ",omitempty"
+			if propSchema.Ref != "" {
+				typ = "*" + typ
+			}
+		}
+		if propSchema.Description != "" {
+			g.printf("// %s is %s\n", exportName(prop), lowerFirst(propSchema.Description))
+		}
+		g.printf("%s %s `json:\"%s\"`\n", exportName(prop), typ, tag)
+	}
+	g.printf("}\n\n")
+}
+
+func (g *generator) operation(path, method string, op openapi.Operation) {
+	name := exportName(op.OperationID)
+	httpMethod := "http.Method" + exportName(strings.ToLower(method))
+
+	args := []string{"ctx context.Context"}
+	pathExpr := fmt.Sprintf("%q", path)
+	for _, param := range op.Parameters {
+		switch param.In {
+		case "path":
+			arg := lowerFirst(exportName(param.Name))
+			args = append(args, arg+" string")
+			pathExpr = strings.Replace(pathExpr, "{"+param.Name+"}", `" + url.PathEscape(`+arg+`) + "`, 1)
+		}
+	}
+	pathExpr = strings.TrimSuffix(strings.TrimPrefix(pathExpr, `"" + `), ` + ""`)
+	if hasQuery(op) {
+		args = append(args, "query url.Values")
+		pathExpr = "withQuery(" + pathExpr + ", query)"
+	}
+
+	bodyArg := "nil"
+	if op.RequestBody != nil {
+		if media, ok := op.RequestBody.Content["application/json"]; ok && media.Schema != nil {
+			args = append(args, "body "+goType(media.Schema))
+			bodyArg = "body"
+		}
+	}
+
+	result := g.resultType(op)
+	summary := op.Summary
+	if summary == "" {
+		summary = "calls " + strings.ToUpper(method) + " " + path
+	}
+	g.printf("// %s %s.\n", name, lowerFirst(strings.TrimSuffix(summary, ".")))
+	if op.Deprecated {
+		g.printf("//\n// Deprecated: the server marks %s %s as deprecated.\n", strings.ToUpper(method), path)
+	}
+	if result == "" {
+		g.printf("func (c *Client) %s(%s) error {\n", name, strings.Join(args, ", "))
+		g.printf("return c.do(ctx, %s, %s, %s, nil)\n}\n\n", httpMethod, pathExpr, bodyArg)
+		return
+	}
+	g.printf("func (c *Client) %s(%s) (*%s, error) {\n", name, strings.Join(args, ", "), result)
+	g.printf("var out %s\n", result)
+	g.printf("if err := c.do(ctx, %s, %s, %s, &out); err != nil {\nreturn nil, err\n}\n", httpMethod, pathExpr, bodyArg)
+	g.printf("return &out, nil\n}\n\n")
+}
+
+// resultType returns the Go type of the first 2xx JSON response, or "" when there is none.
+func (g *generator) resultType(op openapi.Operation) string {
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if !strings.HasPrefix(code, "2") {
+			continue
+		}
+		media, ok := op.Responses[code].Content["application/json"]
+		if !ok || media.Schema == nil {
+			return ""
+		}
+		return goType(media.Schema)
+	}
+	return ""
+}
+
+func hasQuery(op openapi.Operation) bool {
+	for _, param := range op.Parameters {
+		if param.In == "query" {
+			return true
+		}
+	}
+	return false
+}
+
+func goType(schema *openapi.Schema) string {
+	if schema == nil {
+		return "json.RawMessage"
+	}
+	if schema.Ref != "" {
+		return schema.Ref[strings.LastIndex(schema.Ref, "/")+1:]
+	}
+	switch schema.Type {
+	case "string":
+		return "string"
+	case "integer":
+		return "int64"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + goType(schema.Items)
+	default:
+		return "json.RawMessage"
+	}
+}
+
+// exportName converts a JSON or operation identifier into an exported Go identifier.
+func exportName(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+			continue
+		}
+		b.WriteRune(r)
+	}
+	name := b.String()
+	switch {
+	case name == "Id":
+		return "ID"
+	case strings.HasSuffix(name, "Id"):
+		return strings.TrimSuffix(name, "Id") + "ID"
+	}
+	return name
+}
+
+func lowerFirst(s string) string {
+	if s == "" || s == "ID" {
+		return strings.ToLower(s)
+	}
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
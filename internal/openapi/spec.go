@@ -0,0 +1,146 @@
+// Package openapi embeds the OpenAPI 3.1 document describing the WebAuthn API,
+// serves it over HTTP and checks it against the routes registered on the router.
+package openapi
+
+import (
+	_ "embed" // Justify blank import: required for go:embed of the OpenAPI document
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+//go:embed openapi.json
+var document []byte
+
+// Spec is the subset of an OpenAPI document used for route verification and client generation.
+type Spec struct {
+	OpenAPI    string                          `json:"openapi"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+// Operation describes a single method on a path.
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary"`
+	Deprecated  bool                `json:"deprecated"`
+	Parameters  []Parameter         `json:"parameters"`
+	RequestBody *RequestBody        `json:"requestBody"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// Parameter describes a path, query or header parameter.
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody describes the payload accepted by an operation.
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes a response, either inline or as a reference to a shared response.
+type Response struct {
+	Ref         string               `json:"$ref"`
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+// MediaType holds the schema for a content type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is a JSON Schema node as used by OpenAPI 3.1.
+type Schema struct {
+	Ref         string             `json:"$ref"`
+	Type        string             `json:"type"`
+	Description string             `json:"description"`
+	Required    []string           `json:"required"`
+	Properties  map[string]*Schema `json:"properties"`
+	Items       *Schema            `json:"items"`
+	Enum        []string           `json:"enum"`
+}
+
+// Components holds the reusable schemas and responses.
+type Components struct {
+	Schemas   map[string]*Schema  `json:"schemas"`
+	Responses map[string]Response `json:"responses"`
+}
+
+// Document returns the raw embedded OpenAPI document.
+func Document() []byte {
+	return document
+}
+
+// Load parses the embedded OpenAPI document.
+func Load() (*Spec, error) {
+	var spec Spec
+	if err := json.Unmarshal(document, &spec); err != nil {
+		return nil, fmt.Errorf("parse openapi document: %w", err)
+	}
+	return &spec, nil
+}
+
+// Handler serves the embedded OpenAPI document.
+func Handler(ctx *fasthttp.RequestCtx) {
+	ctx.SetContentType("application/json; charset=utf-8")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBody(document)
+}
+
+// isUndocumented reports whether a registered route is intentionally left out of the document,
+// i.e. the SPA entry point and the static file catch-alls.
+func isUndocumented(path string) bool {
+	return path == "/" || path == "/index.html" || strings.Contains(path, "{filepath:*}")
+}
+
+// VerifyRoutes compares the documented operations with the routes registered on the router,
+// as returned by router.List(), and reports every operation missing on either side.
+func VerifyRoutes(registered map[string][]string) error {
+	spec, err := Load()
+	if err != nil {
+		return err
+	}
+
+	routes := map[string]bool{}
+	for method, paths := range registered {
+		for _, path := range paths {
+			if isUndocumented(path) {
+				continue
+			}
+			routes[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	documented := map[string]bool{}
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	var problems []string
+	for route := range documented {
+		if !routes[route] {
+			problems = append(problems, "documented but not routed: "+route)
+		}
+	}
+	for route := range routes {
+		if !documented[route] {
+			problems = append(problems, "routed but not documented: "+route)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("openapi document out of sync with router: %s", strings.Join(problems, "; "))
+}
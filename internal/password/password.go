@@ -0,0 +1,34 @@
+// Package password verifies the password_hash of users and throttles password sign-in.
+// The hashes are made by pgcrypto, crypt(password, gen_salt('bf')), in the seed
+// migration and in user.CreateUser: they are $2a$ bcrypt hashes, which
+// golang.org/x/crypto/bcrypt reads, key setup details included.
+package password
+
+import (
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// pgcryptoCost is the cost of gen_salt('bf'), for the hash compared when a user is
+// not found.
+const pgcryptoCost = 6
+
+var (
+	dummyOnce sync.Once
+	dummyHash []byte
+)
+
+// Verify reports whether password matches hash. An empty hash, which is what callers
+// have when the user was not found, is replaced with one that matches no password, so
+// that the response time does not tell whether the user exists.
+func Verify(hash, password string) bool {
+	if hash == "" {
+		dummyOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("no user has this password"), pgcryptoCost)
+		})
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
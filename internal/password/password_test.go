@@ -0,0 +1,38 @@
+package password
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerify(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), pgcryptoCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{"matching password", string(hash), "correct horse", true},
+		{"wrong password", string(hash), "battery staple", false},
+		{"password differing in case", string(hash), "Correct horse", false},
+		{"empty password", string(hash), "", false},
+		{"unknown user", "", "correct horse", false},
+		{"unknown user with the dummy password", "", "no user has this password", false},
+		{"unknown user with empty password", "", "", false},
+		{"malformed hash", "not a bcrypt hash", "correct horse", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.hash, tt.password); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package password
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/valyala/fasthttp"
+)
+
+// AttemptPrefix is the Redis key prefix, scoped to the tenant, of the counters of
+// password sign-in attempts. A counter is kept per username and client IP, so that
+// guessing the password of one user from one address is slowed down without locking
+// the user out everywhere else.
+const AttemptPrefix = "password_attempts:"
+
+func attemptKey(t *tenant.Tenant, username, ip string) string {
+	return t.RedisKey(AttemptPrefix + username + ":" + ip)
+}
+
+// CountAttempt counts a sign-in attempt of username from ip, before its password is
+// compared, and fails once more than maxAttempts were made within window of the first.
+func CountAttempt(
+	ctx *fasthttp.RequestCtx,
+	redisClient *redis.Client,
+	t *tenant.Tenant,
+	username, ip string,
+	maxAttempts int,
+	window time.Duration,
+) (string, error) {
+	key := attemptKey(t, username, ip)
+	// The first attempt opens the window: the counter is created with its expiry, and
+	// incrementing it keeps the expiry
+	var attempts *redis.IntCmd
+	_, err := redisClient.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.SetNX(context.Background(), key, 0, window)
+		attempts = pipe.Incr(context.Background(), key)
+		return nil
+	})
+	if err != nil {
+		return "", weberror.RedisSessionSetError(err, key).LogCtx(ctx)
+	}
+	if attempts.Val() > int64(maxAttempts) {
+		return "", weberror.TooManyAttemptsError(username, ip)
+	}
+	return username, nil
+}
+
+// ResetAttempts forgets the attempts of username from ip after a successful sign-in.
+func ResetAttempts(
+	ctx *fasthttp.RequestCtx,
+	redisClient *redis.Client,
+	t *tenant.Tenant,
+	username, ip string,
+) (string, error) {
+	key := attemptKey(t, username, ip)
+	if err := redisClient.Del(context.Background(), key).Err(); err != nil {
+		return "", weberror.RedisSessionSetError(err, key).LogCtx(ctx)
+	}
+	return username, nil
+}
@@ -0,0 +1,68 @@
+package password
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/valyala/fasthttp"
+)
+
+// TestCountAttempt makes the sign-in attempts of the steps in order, with at most two
+// attempts per username and client IP within a minute. A step that resets does so
+// before its attempt.
+func TestCountAttempt(t *testing.T) {
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := &fasthttp.RequestCtx{}
+	tnt, other := &tenant.Tenant{ID: "default"}, &tenant.Tenant{ID: "other"}
+
+	tests := []struct {
+		name        string
+		tenant      *tenant.Tenant
+		username    string
+		ip          string
+		reset       bool
+		elapse      time.Duration
+		wantLimited bool
+	}{
+		{"first attempt", tnt, "alice", "192.0.2.1", false, 0, false},
+		{"second attempt", tnt, "alice", "192.0.2.1", false, 0, false},
+		{"third attempt is over the limit", tnt, "alice", "192.0.2.1", false, 0, true},
+		{"attempts keep counting over the limit", tnt, "alice", "192.0.2.1", false, 0, true},
+		{"other client IP", tnt, "alice", "198.51.100.1", false, 0, false},
+		{"other username", tnt, "bob", "192.0.2.1", false, 0, false},
+		{"same username of another tenant", other, "alice", "192.0.2.1", false, 0, false},
+		{"window ends", tnt, "alice", "192.0.2.1", false, time.Minute, false},
+		{"new window counts again", tnt, "alice", "192.0.2.1", false, 0, false},
+		{"successful sign-in resets", tnt, "alice", "192.0.2.1", true, 0, false},
+		{"second attempt after the reset", tnt, "alice", "192.0.2.1", false, 0, false},
+		{"over the limit after the reset", tnt, "alice", "192.0.2.1", false, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr.FastForward(tt.elapse)
+			if tt.reset {
+				if _, err := ResetAttempts(ctx, redisClient, tt.tenant, tt.username, tt.ip); err != nil {
+					t.Fatalf("ResetAttempts: %v", err)
+				}
+			}
+
+			_, err := CountAttempt(ctx, redisClient, tt.tenant, tt.username, tt.ip, 2, time.Minute)
+			if !tt.wantLimited {
+				if err != nil {
+					t.Fatalf("CountAttempt: %v", err)
+				}
+				return
+			}
+			var appErr *weberror.AppError
+			if !errors.As(err, &appErr) || appErr.Code != weberror.ErrTooManyAttempts.Code {
+				t.Fatalf("CountAttempt = %v, want %s", err, weberror.ErrTooManyAttempts.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/jamesyang124/webauthn-example/types"
+	"github.com/valyala/fasthttp"
+)
+
+// Key prefixes, cookie name and lifetime of the sessions created by a successful login.
+// Every session ID of a user is also kept in the UserSessionsPrefix set so that all of
+// them can be revoked at once. Keys are scoped to the tenant of the request, so a
+// session cookie only works on the hosts of the tenant that issued it.
+const (
+	AuthSessionPrefix  = "auth_session:"
+	UserSessionsPrefix = "user_sessions:"
+	AuthSessionTTL     = 12 * time.Hour
+	SessionCookieName  = "session_id"
+)
+
+// UserIDKey is the request user value holding the ID of the user whose session was
+// created or loaded by the request, for the access log.
+const UserIDKey = "user_id"
+
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateAuthSession stores a new session for the user in Redis and sets the session cookie.
+// userVerified reports whether the login assertion carried the UV flag, which counts as
+// a step-up at the time of the login.
+func CreateAuthSession(
+	ctx *fasthttp.RequestCtx,
+	redisClient *redis.Client,
+	userID, username string,
+	userVerified bool,
+) (*types.AuthSession, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, weberror.UnexpectedError(err, "generate session id").LogCtx(ctx)
+	}
+	authSession := &types.AuthSession{
+		ID:        id,
+		UserID:    userID,
+		Username:  username,
+		CreatedAt: time.Now().UTC(),
+	}
+	if userVerified {
+		authSession.UserVerifiedAt = authSession.CreatedAt
+	}
+	data, err := json.Marshal(authSession)
+	if err != nil {
+		return nil, weberror.JSONMarshalError(err).LogCtx(ctx)
+	}
+
+	background := context.Background()
+	t := tenant.From(ctx)
+	userKey := t.RedisKey(UserSessionsPrefix + userID)
+	_, err = redisClient.TxPipelined(background, func(pipe redis.Pipeliner) error {
+		pipe.Set(background, t.RedisKey(AuthSessionPrefix+id), data, AuthSessionTTL)
+		pipe.SAdd(background, userKey, id)
+		pipe.Expire(background, userKey, AuthSessionTTL)
+		return nil
+	})
+	if err != nil {
+		return nil, weberror.RedisSessionSetError(err, AuthSessionPrefix).LogCtx(ctx)
+	}
+
+	cookie := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(cookie)
+	cookie.SetKey(SessionCookieName)
+	cookie.SetValue(id)
+	cookie.SetPath("/")
+	cookie.SetMaxAge(int(AuthSessionTTL.Seconds()))
+	cookie.SetHTTPOnly(true)
+	cookie.SetSecure(true)
+	cookie.SetSameSite(fasthttp.CookieSameSiteLaxMode)
+	ctx.Response.Header.SetCookie(cookie)
+	ctx.SetUserValue(UserIDKey, userID)
+
+	return authSession, nil
+}
+
+// GetAuthSession loads the session named by the session cookie of the request.
+func GetAuthSession(ctx *fasthttp.RequestCtx, redisClient *redis.Client) (*types.AuthSession, error) {
+	id := string(ctx.Request.Header.Cookie(SessionCookieName))
+	if id == "" {
+		return nil, weberror.UnauthenticatedError(nil)
+	}
+	data, err := redisClient.Get(context.Background(), tenant.From(ctx).RedisKey(AuthSessionPrefix+id)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, weberror.UnauthenticatedError(err)
+		}
+		return nil, weberror.RedisSessionGetError(err, AuthSessionPrefix).LogCtx(ctx)
+	}
+	var authSession types.AuthSession
+	if err := json.Unmarshal(data, &authSession); err != nil {
+		return nil, weberror.JSONParseError(err).LogCtx(ctx)
+	}
+	authSession.ID = id
+	ctx.SetUserValue(UserIDKey, authSession.UserID)
+	return &authSession, nil
+}
+
+// MarkUserVerified records that the user of the session just passed user verification.
+// The session keeps its remaining lifetime.
+func MarkUserVerified(ctx *fasthttp.RequestCtx, redisClient *redis.Client, authSession *types.AuthSession) (*types.AuthSession, error) {
+	authSession.UserVerifiedAt = time.Now().UTC()
+	data, err := json.Marshal(authSession)
+	if err != nil {
+		return nil, weberror.JSONMarshalError(err).LogCtx(ctx)
+	}
+	key := tenant.From(ctx).RedisKey(AuthSessionPrefix + authSession.ID)
+	// XX: a session revoked since it was loaded must not come back
+	if err := redisClient.SetArgs(context.Background(), key, data, redis.SetArgs{KeepTTL: true, Mode: "XX"}).Err(); err != nil {
+		if err == redis.Nil {
+			return nil, weberror.UnauthenticatedError(err)
+		}
+		return nil, weberror.RedisSessionSetError(err, AuthSessionPrefix).LogCtx(ctx)
+	}
+	return authSession, nil
+}
+
+// RevokeUserSessions deletes every session of the user of the tenant, with the step-up
+// and enrollment ceremonies they started, and returns how many sessions were removed.
+func RevokeUserSessions(ctx context.Context, redisClient *redis.Client, tenantID, userID string) (int64, error) {
+	userKey := tenant.RedisKey(tenantID, UserSessionsPrefix+userID)
+	ids, err := redisClient.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return 0, weberror.RedisSessionGetError(err, userKey).LogCtx(ctx)
+	}
+	keys := []string{userKey}
+	var ceremonies []string
+	for _, id := range ids {
+		keys = append(keys, tenant.RedisKey(tenantID, AuthSessionPrefix+id))
+		ceremonies = append(ceremonies,
+			tenant.RedisKey(tenantID, StepUpSessionPrefix+id),
+			tenant.RedisKey(tenantID, EnrollmentSessionPrefix+id),
+		)
+	}
+	var sessions *redis.IntCmd
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		sessions = pipe.Del(ctx, keys...)
+		if len(ceremonies) > 0 {
+			pipe.Del(ctx, ceremonies...)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, weberror.RedisSessionSetError(err, userKey).LogCtx(ctx)
+	}
+	removed := sessions.Val()
+	// The user set itself is not a session
+	if len(ids) > 0 && removed > 0 {
+		removed--
+	}
+	return removed, nil
+}
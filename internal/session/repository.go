@@ -8,11 +8,32 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/jamesyang124/webauthn-example/internal/logging"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
 	"github.com/jamesyang124/webauthn-example/internal/weberror"
 	"github.com/valyala/fasthttp"
 	"go.uber.org/zap"
 )
 
+// Key prefixes and lifetime of the ceremony session data (challenges) kept in Redis.
+// Handlers scope the keys to the tenant with tenant.Tenant.RedisKey. Registration
+// session data is a pending signup keyed by its challenge, see package signup; login
+// session data is keyed by the username.
+const (
+	RegistrationSessionPrefix = "webauthn_session:"
+	LoginSessionPrefix        = "webauthn_login_session:"
+	CeremonySessionTTL        = 86400 * time.Second
+)
+
+// Discoverable logins are not tied to a username, so their session data is keyed by
+// the challenge instead. The browser keeps a conditional request pending for as long
+// as the login page is open, so the challenge lives longer than the ceremony timeout
+// of the WebAuthn library, but it is deleted by the first verification attempt.
+const (
+	DiscoverableSessionPrefix = "webauthn_discoverable_session:"
+	DiscoverableSessionTTL    = 10 * time.Minute
+)
+
 // SetWebauthnSessionData stores session data in Redis using TryIO pattern.
 func SetWebauthnSessionData(
 	ctx *fasthttp.RequestCtx,
@@ -23,7 +44,7 @@ func SetWebauthnSessionData(
 ) ([]byte, error) {
 	err := redisClient.Set(context.Background(), sessionKey, string(sessionDataJSON), ttl).Err()
 	if err != nil {
-		return sessionDataJSON, weberror.RedisSessionSetError(err, sessionKey).Log()
+		return sessionDataJSON, weberror.RedisSessionSetError(err, sessionKey).LogCtx(ctx)
 	}
 	return sessionDataJSON, nil
 }
@@ -37,10 +58,111 @@ func GetWebauthnSessionData(
 	redisSessionData, err := redisClient.Get(context.Background(), sessionKey).Result()
 	if err != nil {
 		if err == redis.Nil {
-			zap.L().Error("Session data not found", zap.String("sessionKey", sessionKey))
-			return "", weberror.UserNotFoundError(err, "get user from redis").Log()
+			logging.WithRequest(ctx, logging.L("session")).Warn("Session data not found", zap.String("sessionKey", sessionKey))
+			return "", weberror.UserNotFoundError(err, "get user from redis").LogCtx(ctx)
+		}
+		return "", weberror.RedisSessionGetError(err, sessionKey).LogCtx(ctx)
+	}
+	return redisSessionData, nil
+}
+
+// Step-up ceremonies belong to a signed-in session and are keyed by its ID. The user
+// is expected to answer right away, so the challenge is short-lived.
+const (
+	StepUpSessionPrefix = "webauthn_stepup_session:"
+	StepUpSessionTTL    = 5 * time.Minute
+)
+
+// Passkey enrollments from the account of a signed-in user, e.g. after a password
+// sign-in, are keyed by the ID of the auth session like step-up ceremonies.
+const (
+	EnrollmentSessionPrefix = "webauthn_enrollment_session:"
+	EnrollmentSessionTTL    = 5 * time.Minute
+)
+
+// TakeWebauthnSessionData retrieves and deletes session data in one step, so that the
+// challenge it holds can only be answered once.
+func TakeWebauthnSessionData(
+	ctx *fasthttp.RequestCtx,
+	redisClient *redis.Client,
+	sessionKey string,
+) (string, error) {
+	redisSessionData, err := redisClient.GetDel(context.Background(), sessionKey).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", weberror.ChallengeNotFoundError(err).LogCtx(ctx)
 		}
-		return "", weberror.RedisSessionGetError(err, sessionKey).Log()
+		return "", weberror.RedisSessionGetError(err, sessionKey).LogCtx(ctx)
 	}
 	return redisSessionData, nil
 }
+
+// Ceremony is a kind of ceremony session data kept in Redis: its key prefix, which
+// handlers scope to the tenant, and the TTL every key of the kind is written with.
+type Ceremony struct {
+	Prefix string
+	TTL    time.Duration
+	// Legacy keys were also written without a tenant prefix, before tenants existed.
+	Legacy bool
+}
+
+// Ceremonies returns the kinds of ceremony session data of this package. Other packages
+// keeping ceremonies, like the pending transactions of txconfirm, add their own for
+// PurgeStaleSessions.
+func Ceremonies() []Ceremony {
+	return []Ceremony{
+		{Prefix: RegistrationSessionPrefix, TTL: CeremonySessionTTL, Legacy: true},
+		{Prefix: LoginSessionPrefix, TTL: CeremonySessionTTL, Legacy: true},
+		{Prefix: DiscoverableSessionPrefix, TTL: DiscoverableSessionTTL},
+		{Prefix: StepUpSessionPrefix, TTL: StepUpSessionTTL},
+		{Prefix: EnrollmentSessionPrefix, TTL: EnrollmentSessionTTL},
+	}
+}
+
+// PurgeStaleSessions deletes the session data of the ceremonies created more than
+// olderThan ago. The age of a key is derived from its remaining TTL and the TTL of its
+// ceremony. It returns the number of deleted keys.
+func PurgeStaleSessions(ctx context.Context, redisClient *redis.Client, ceremonies []Ceremony, olderThan time.Duration) (int, error) {
+	purged := 0
+	for _, ceremony := range ceremonies {
+		patterns := []string{tenant.RedisKey("*", ceremony.Prefix+"*")}
+		if ceremony.Legacy {
+			patterns = append(patterns, ceremony.Prefix+"*")
+		}
+		n, err := purgeStale(ctx, redisClient, patterns, ceremony.TTL, olderThan)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+func purgeStale(ctx context.Context, redisClient *redis.Client, patterns []string, ttl, olderThan time.Duration) (int, error) {
+	purged := 0
+	for _, pattern := range patterns {
+		iter := redisClient.Scan(ctx, 0, pattern, 100).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+			remaining, err := redisClient.TTL(ctx, key).Result()
+			if err != nil {
+				return purged, weberror.RedisSessionGetError(err, key).LogCtx(ctx)
+			}
+			// -2 means the key expired since the scan; -1 means it has no expiry and never ages out
+			if remaining == -2 {
+				continue
+			}
+			if remaining >= 0 && ttl-remaining < olderThan {
+				continue
+			}
+			if err := redisClient.Del(ctx, key).Err(); err != nil {
+				return purged, weberror.RedisSessionSetError(err, key).LogCtx(ctx)
+			}
+			purged++
+		}
+		if err := iter.Err(); err != nil {
+			return purged, weberror.RedisSessionGetError(err, pattern).LogCtx(ctx)
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,55 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+)
+
+func TestPurgeStaleSessions(t *testing.T) {
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	ceremonies := append(Ceremonies(), Ceremony{Prefix: "transaction:", TTL: 5 * time.Minute})
+
+	// Each key is written with the TTL its ceremony would have left age after creating it
+	tests := []struct {
+		name       string
+		key        string
+		ttl        time.Duration
+		age        time.Duration
+		wantPurged bool
+	}{
+		{"old registration", tenant.RedisKey("default", RegistrationSessionPrefix+"c1"), CeremonySessionTTL, 20 * time.Minute, true},
+		{"fresh registration", tenant.RedisKey("default", RegistrationSessionPrefix+"c2"), CeremonySessionTTL, 5 * time.Minute, false},
+		{"old login of another tenant", tenant.RedisKey("other", LoginSessionPrefix+"alice"), CeremonySessionTTL, 20 * time.Minute, true},
+		{"old legacy login", LoginSessionPrefix + "bob", CeremonySessionTTL, 20 * time.Minute, true},
+		{"old discoverable", tenant.RedisKey("default", DiscoverableSessionPrefix+"c3"), DiscoverableSessionTTL, 9 * time.Minute, true},
+		{"fresh discoverable", tenant.RedisKey("default", DiscoverableSessionPrefix+"c4"), DiscoverableSessionTTL, 7 * time.Minute, false},
+		{"step-up near expiry", tenant.RedisKey("default", StepUpSessionPrefix+"s1"), StepUpSessionTTL, 4 * time.Minute, false},
+		{"enrollment without expiry", tenant.RedisKey("default", EnrollmentSessionPrefix+"s2"), 0, 0, true},
+		{"pending transaction near expiry", tenant.RedisKey("default", "transaction:t1"), 5 * time.Minute, 4 * time.Minute, false},
+		{"auth session", tenant.RedisKey("default", AuthSessionPrefix+"s3"), 0, 0, false},
+	}
+	for _, tt := range tests {
+		if err := redisClient.Set(ctx, tt.key, "data", tt.ttl-tt.age).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := PurgeStaleSessions(ctx, redisClient, ceremonies, 8*time.Minute); err != nil {
+		t.Fatalf("PurgeStaleSessions: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if purged := !mr.Exists(tt.key); purged != tt.wantPurged {
+				t.Errorf("purged = %v, want %v", purged, tt.wantPurged)
+			}
+		})
+	}
+}
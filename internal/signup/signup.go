@@ -0,0 +1,135 @@
+// Package signup creates accounts from the public registration ceremony. The options
+// request carries the username, email and display name of the new user; they are kept
+// with the ceremony session data, and the user row is only created, together with its
+// first credential, once the ceremony succeeds. Signed-in users add passkeys to their
+// existing account from the account routes instead.
+package signup
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jamesyang124/webauthn-example/internal/credential"
+	"github.com/jamesyang124/webauthn-example/internal/session"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/user"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/jamesyang124/webauthn-example/types"
+	"github.com/lib/pq"
+	"github.com/valyala/fasthttp"
+)
+
+// Signup is the account a signup creates.
+type Signup struct {
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	DisplayName string `json:"displayName"`
+}
+
+// Pending is a signup waiting for its registration ceremony, stored in Redis in place
+// of the bare session data.
+type Pending struct {
+	Signup
+	SessionData webauthn.SessionData `json:"sessionData"`
+}
+
+// Store keeps the pending signup until its ceremony is answered. It is keyed by the
+// challenge, which is random and only known to the client that requested the options,
+// so another signup for the same username can neither replace nor consume it.
+func Store(ctx *fasthttp.RequestCtx, redisClient *redis.Client, t *tenant.Tenant, p Pending) ([]byte, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, weberror.JSONMarshalError(err).LogCtx(ctx)
+	}
+	sessionKey := t.RedisKey(session.RegistrationSessionPrefix + p.SessionData.Challenge)
+	return session.SetWebauthnSessionData(ctx, redisClient, sessionKey, data, session.CeremonySessionTTL)
+}
+
+// Take reads and deletes the pending signup whose ceremony has the given challenge, so
+// that it can be answered once.
+func Take(ctx *fasthttp.RequestCtx, redisClient *redis.Client, t *tenant.Tenant, challenge string, p *Pending) (string, error) {
+	data, err := session.TakeWebauthnSessionData(ctx, redisClient, t.RedisKey(session.RegistrationSessionPrefix+challenge))
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal([]byte(data), p); err != nil {
+		return "", weberror.JSONParseError(err).LogCtx(ctx)
+	}
+	return p.Username, nil
+}
+
+// Validate reads the username, email and displayname of a signup request.
+func Validate(ctx *fasthttp.RequestCtx, requestData map[string]interface{}, s *Signup) (string, error) {
+	username, displayName, err := user.ValidateUsernameAndDisplayname(ctx, requestData)
+	if err != nil {
+		return "", err
+	}
+	if _, err := user.ValidateEmail(requestData, &s.Email); err != nil {
+		return "", err
+	}
+	s.Username = username
+	s.DisplayName = displayName
+	return username, nil
+}
+
+// EnsureAvailable fails when another user of the tenant has the username or the email,
+// so the ceremony does not start for nothing. Create checks again, since another signup
+// may take them in the meantime.
+func EnsureAvailable(db *sql.DB, tenantID string, s Signup) (string, error) {
+	var usernameTaken, emailTaken bool
+	err := db.QueryRow(
+		`SELECT
+			EXISTS (SELECT 1 FROM users WHERE tenant_id = $1 AND username = $2),
+			EXISTS (SELECT 1 FROM users WHERE tenant_id = $1 AND email = $3)`,
+		tenantID, s.Username, s.Email,
+	).Scan(&usernameTaken, &emailTaken)
+	if err != nil {
+		return "", weberror.DatabaseQueryError(err, "query signup availability")
+	}
+	if usernameTaken {
+		return "", weberror.UsernameTakenError(nil)
+	}
+	if emailTaken {
+		return "", weberror.EmailTakenError(nil)
+	}
+	return s.Username, nil
+}
+
+// Create inserts the user of the tenant, with the WebAuthn user handle of the ceremony,
+// and its first credential in one transaction, and returns the id of the user. The
+// password is random, so the account can only sign in with a passkey.
+func Create(db *sql.DB, tenantID string, s Signup, webauthnUserID string, c types.StoredCredential) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", weberror.DatabaseUpdateError(err, "begin signup")
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRow(
+		`INSERT INTO users (tenant_id, username, email, password_hash, webauthn_user_id, webauthn_displayname)
+		VALUES ($1, $2, $3, crypt(encode(gen_random_bytes(32), 'hex'), gen_salt('bf')), $4, $5)
+		RETURNING id`,
+		tenantID, s.Username, s.Email, webauthnUserID, s.DisplayName,
+	).Scan(&userID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			switch pqErr.Constraint {
+			case "idx_users_tenant_username":
+				return "", weberror.UsernameTakenError(err)
+			case "idx_users_tenant_email":
+				return "", weberror.EmailTakenError(err)
+			}
+		}
+		return "", weberror.DatabaseUpdateError(err, "create user")
+	}
+	if _, err := credential.InsertCredential(tx, userID, c); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", weberror.DatabaseUpdateError(err, "commit signup")
+	}
+	return userID, nil
+}
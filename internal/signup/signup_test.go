@@ -0,0 +1,66 @@
+package signup
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/valyala/fasthttp"
+)
+
+// TestConcurrentSignupsOfSameUsername starts two signups for the same username. Each
+// must be answered with its own challenge: neither replaces the other, and the
+// username alone finds neither.
+func TestConcurrentSignupsOfSameUsername(t *testing.T) {
+	redisClient := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	ctx := &fasthttp.RequestCtx{}
+	tnt := &tenant.Tenant{ID: "default"}
+
+	first := Pending{
+		Signup:      Signup{Username: "alice", Email: "alice@example.com", DisplayName: "Alice"},
+		SessionData: webauthn.SessionData{Challenge: "first-challenge"},
+	}
+	second := Pending{
+		Signup:      Signup{Username: "alice", Email: "mallory@example.com", DisplayName: "Mallory"},
+		SessionData: webauthn.SessionData{Challenge: "second-challenge"},
+	}
+	for _, p := range []Pending{first, second} {
+		if _, err := Store(ctx, redisClient, tnt, p); err != nil {
+			t.Fatalf("Store(%s): %v", p.SessionData.Challenge, err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		challenge string
+		wantEmail string
+	}{
+		{"username does not find a signup", "alice", ""},
+		{"second signup", "second-challenge", "mallory@example.com"},
+		{"first signup survives the second", "first-challenge", "alice@example.com"},
+		{"first signup is answered once", "first-challenge", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Pending
+			_, err := Take(ctx, redisClient, tnt, tt.challenge, &p)
+			if tt.wantEmail == "" {
+				var appErr *weberror.AppError
+				if !errors.As(err, &appErr) || appErr.Code != weberror.ErrChallengeNotFound.Code {
+					t.Fatalf("Take(%s) = %v, want %s", tt.challenge, err, weberror.ErrChallengeNotFound.Code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Take(%s): %v", tt.challenge, err)
+			}
+			if p.Email != tt.wantEmail {
+				t.Errorf("Take(%s) email = %s, want %s", tt.challenge, p.Email, tt.wantEmail)
+			}
+		})
+	}
+}
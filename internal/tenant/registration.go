@@ -0,0 +1,127 @@
+package tenant
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/jamesyang124/webauthn-example/internal/extension"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+)
+
+// algorithms are the COSE algorithms a policy may name. RS1 is left out on purpose.
+var algorithms = map[string]webauthncose.COSEAlgorithmIdentifier{
+	"ES256": webauthncose.AlgES256,
+	"ES384": webauthncose.AlgES384,
+	"ES512": webauthncose.AlgES512,
+	"EdDSA": webauthncose.AlgEdDSA,
+	"PS256": webauthncose.AlgPS256,
+	"PS384": webauthncose.AlgPS384,
+	"PS512": webauthncose.AlgPS512,
+	"RS256": webauthncose.AlgRS256,
+	"RS384": webauthncose.AlgRS384,
+	"RS512": webauthncose.AlgRS512,
+}
+
+// RegistrationOptions returns the options of a registration ceremony with the named
+// registration profile, or with the tenant policy alone when profile is empty. ok is
+// false when the tenant does not offer the profile, so requests can only pick among
+// the combinations the operator allowed.
+func (t *Tenant) RegistrationOptions(profile string) (options []webauthn.RegistrationOption, ok bool) {
+	options, ok = t.registration[profile]
+	return options, ok
+}
+
+// CheckAlgorithm rejects a new credential whose public key uses an algorithm outside
+// the policy. Clients are only asked to pick one of the listed algorithms, so the
+// choice is checked again on what they return.
+func (t *Tenant) CheckAlgorithm(credential *webauthn.Credential) error {
+	if len(t.algorithms) == 0 {
+		return nil
+	}
+	var key webauthncose.PublicKeyData
+	if err := webauthncbor.Unmarshal(credential.PublicKey, &key); err != nil {
+		return weberror.CredentialDataInvalidError(err)
+	}
+	if !slices.Contains(t.algorithms, key.Algorithm) {
+		return weberror.CredentialAlgorithmError(base64.RawURLEncoding.EncodeToString(credential.ID), key.Algorithm)
+	}
+	return nil
+}
+
+// credentialParameters returns the credential parameters of the named algorithms, or
+// nil to keep the defaults of the WebAuthn library.
+func credentialParameters(names []string) ([]protocol.CredentialParameter, error) {
+	parameters := make([]protocol.CredentialParameter, 0, len(names))
+	for _, name := range names {
+		alg, ok := algorithms[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown algorithm %q", name)
+		}
+		parameters = append(parameters, protocol.CredentialParameter{Type: protocol.PublicKeyCredentialType, Algorithm: alg})
+	}
+	if len(parameters) == 0 {
+		return nil, nil
+	}
+	return parameters, nil
+}
+
+// mergeProfile returns the policy with the values set by a registration profile.
+func mergeProfile(policy, profile config.RegistrationProfile) config.RegistrationProfile {
+	if profile.UserVerification != "" {
+		policy.UserVerification = profile.UserVerification
+	}
+	if profile.ResidentKey != "" {
+		policy.ResidentKey = profile.ResidentKey
+	}
+	if profile.Attestation != "" {
+		policy.Attestation = profile.Attestation
+	}
+	if profile.Attachment != "" {
+		policy.Attachment = profile.Attachment
+	}
+	if len(profile.Hints) > 0 {
+		policy.Hints = profile.Hints
+	}
+	return policy
+}
+
+func registrationOptions(
+	profile config.RegistrationProfile,
+	parameters []protocol.CredentialParameter,
+	extensions config.Extensions,
+) []webauthn.RegistrationOption {
+	options := []webauthn.RegistrationOption{
+		webauthn.WithAuthenticatorSelection(authenticatorSelection(profile)),
+		webauthn.WithConveyancePreference(protocol.ConveyancePreference(profile.Attestation)),
+		webauthn.WithExtensions(extension.RegistrationInputs(extensions)),
+	}
+	if len(profile.Hints) > 0 {
+		hints := make([]protocol.PublicKeyCredentialHints, len(profile.Hints))
+		for i, hint := range profile.Hints {
+			hints[i] = protocol.PublicKeyCredentialHints(hint)
+		}
+		options = append(options, webauthn.WithPublicKeyCredentialHints(hints))
+	}
+	if parameters != nil {
+		options = append(options, webauthn.WithCredentialParameters(parameters))
+	}
+	return options
+}
+
+func authenticatorSelection(profile config.RegistrationProfile) protocol.AuthenticatorSelection {
+	selection := protocol.AuthenticatorSelection{
+		AuthenticatorAttachment: protocol.AuthenticatorAttachment(profile.Attachment),
+		UserVerification:        protocol.UserVerificationRequirement(profile.UserVerification),
+		ResidentKey:             protocol.ResidentKeyRequirement(profile.ResidentKey),
+	}
+	if selection.ResidentKey == protocol.ResidentKeyRequirementRequired {
+		selection.RequireResidentKey = protocol.ResidentKeyRequired()
+	}
+	return selection
+}
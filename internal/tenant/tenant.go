@@ -0,0 +1,140 @@
+// Package tenant maps the Host of a request to the relying party serving it. Every
+// tenant has its own WebAuthn instance, its own users in Postgres and its own Redis
+// key space, so one deployment can host several brands.
+package tenant
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jamesyang124/webauthn-example/internal/backup"
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/jamesyang124/webauthn-example/internal/user"
+	"github.com/valyala/fasthttp"
+)
+
+// Key is the request user value holding the *Tenant of the request.
+const Key = "tenant"
+
+// Tenant is a relying party and the WebAuthn instance running its ceremonies.
+type Tenant struct {
+	ID           string
+	RelyingParty config.RelyingParty
+	WebAuthn     *webauthn.WebAuthn
+	Backup       backup.Policy
+	Extensions   config.Extensions
+
+	// registration holds the registration options of the policy under "" and of
+	// every registration profile under its name.
+	registration map[string][]webauthn.RegistrationOption
+	// algorithms are the COSE algorithms credentials may use, empty for any.
+	algorithms []int64
+}
+
+// RedisKey scopes a Redis key to the tenant.
+func (t *Tenant) RedisKey(key string) string {
+	return RedisKey(t.ID, key)
+}
+
+// RedisKey scopes a Redis key to the tenant with the given ID, for callers like the
+// CLI that have no request.
+func RedisKey(tenantID, key string) string {
+	return "tenant:" + tenantID + ":" + key
+}
+
+// Registry holds the configured tenants by host.
+type Registry struct {
+	tenants  []*Tenant
+	byID     map[string]*Tenant
+	byHost   map[string]*Tenant
+	fallback *Tenant
+}
+
+// NewRegistry creates the WebAuthn instance of every tenant. A tenant without hosts
+// serves every host no other tenant claims.
+func NewRegistry(tenants []config.Tenant) (*Registry, error) {
+	r := &Registry{byID: map[string]*Tenant{}, byHost: map[string]*Tenant{}}
+	for _, cfg := range tenants {
+		if _, err := user.ValidateRoles(cfg.Policy.DeviceBoundRoles); err != nil {
+			return nil, fmt.Errorf("tenant %s: policy deviceBoundRoles: %w", cfg.ID, err)
+		}
+		parameters, err := credentialParameters(cfg.Policy.Algorithms)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: policy algorithms: %w", cfg.ID, err)
+		}
+		w, err := webauthn.New(&webauthn.Config{
+			RPDisplayName:          cfg.RelyingParty.DisplayName,
+			RPID:                   cfg.RelyingParty.ID,
+			RPOrigins:              cfg.RelyingParty.AllOrigins(),
+			AttestationPreference:  protocol.ConveyancePreference(cfg.Policy.Attestation),
+			AuthenticatorSelection: authenticatorSelection(cfg.Policy.RegistrationProfile),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", cfg.ID, err)
+		}
+		t := &Tenant{
+			ID:           cfg.ID,
+			RelyingParty: cfg.RelyingParty,
+			WebAuthn:     w,
+			Backup:       backup.NewPolicy(cfg.Policy),
+			Extensions:   cfg.Policy.Extensions,
+			registration: map[string][]webauthn.RegistrationOption{
+				"": registrationOptions(cfg.Policy.RegistrationProfile, parameters, cfg.Policy.Extensions),
+			},
+		}
+		for _, p := range parameters {
+			t.algorithms = append(t.algorithms, int64(p.Algorithm))
+		}
+		for name, profile := range cfg.Policy.RegistrationProfiles {
+			t.registration[name] = registrationOptions(mergeProfile(cfg.Policy.RegistrationProfile, profile), parameters, cfg.Policy.Extensions)
+		}
+		r.tenants = append(r.tenants, t)
+		r.byID[t.ID] = t
+		if len(cfg.Hosts) == 0 {
+			r.fallback = t
+		}
+		for _, host := range cfg.Hosts {
+			r.byHost[host] = t
+		}
+	}
+	return r, nil
+}
+
+// Tenants returns every tenant in configuration order.
+func (r *Registry) Tenants() []*Tenant {
+	return r.tenants
+}
+
+// ByID returns the tenant with the given ID, or nil.
+func (r *Registry) ByID(id string) *Tenant {
+	return r.byID[id]
+}
+
+// ForHost returns the tenant serving host, which may carry a port, or nil.
+func (r *Registry) ForHost(host string) *Tenant {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if t, ok := r.byHost[strings.ToLower(strings.Trim(host, "[]"))]; ok {
+		return t
+	}
+	return r.fallback
+}
+
+// Origins returns the relying party origins, related ones included, of every tenant.
+func (r *Registry) Origins() []string {
+	origins := []string{}
+	for _, t := range r.tenants {
+		origins = append(origins, t.RelyingParty.AllOrigins()...)
+	}
+	return origins
+}
+
+// From returns the tenant stored by the tenant middleware, or nil.
+func From(ctx *fasthttp.RequestCtx) *Tenant {
+	t, _ := ctx.UserValue(Key).(*Tenant)
+	return t
+}
@@ -0,0 +1,117 @@
+// Package tlscert serves the TLS certificate of the server, reloading it when the files
+// change, and generates self-signed certificates for local development.
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/jamesyang124/webauthn-example/internal/logging"
+	"go.uber.org/zap"
+)
+
+// Reloader holds the certificate loaded from a certificate and key file pair and
+// replaces it when either file changes.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewReloader loads the certificate, failing when the files are missing or invalid.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch checks the files every interval until ctx is done. A certificate that fails
+// to load is logged and the previous one is kept, so that a half-written renewal does
+// not take the server down.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				logging.L("tlscert").Error("Failed to reload TLS certificate", zap.Error(err))
+			} else if reloaded {
+				logging.L("tlscert").Info("Reloaded TLS certificate", zap.String("certFile", r.certFile))
+			}
+		}
+	}
+}
+
+// reload loads the files when they are newer than the current certificate.
+func (r *Reloader) reload() (bool, error) {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	unchanged := r.cert != nil && !modTime.After(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("load TLS key pair: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return true, nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// ServerConfig returns the TLS configuration of the API listener. fasthttp serves
+// HTTP/1.1 only, so ALPN advertises http/1.1 and clients never try to speak HTTP/2
+// on the connection; HTTP/2 needs a terminating proxy in front.
+func ServerConfig(cfg config.TLS, r *Reloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:     cfg.MinVersion,
+		CipherSuites:   cfg.CipherSuites,
+		GetCertificate: r.GetCertificate,
+		NextProtos:     []string{"http/1.1"},
+	}
+}
@@ -0,0 +1,79 @@
+package txconfirm
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+)
+
+// SaveProof stores the proof of an approved transaction of the user.
+func SaveProof(db *sql.DB, userID string, proof Proof) (sql.Result, error) {
+	document, err := json.Marshal(proof)
+	if err != nil {
+		return nil, weberror.JSONMarshalError(err)
+	}
+	result, err := db.Exec(
+		`INSERT INTO transaction_proofs (transaction_id, tenant_id, user_id, proof, approved_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		proof.TransactionID, proof.TenantID, userID, document, proof.ApprovedAt,
+	)
+	if err != nil {
+		return nil, weberror.DatabaseUpdateError(err, "save transaction proof")
+	}
+	return result, nil
+}
+
+// QueryProof returns the proof of an approved transaction of the tenant.
+func QueryProof(db *sql.DB, tenantID, transactionID string) (*Proof, error) {
+	var document []byte
+	err := db.QueryRow(
+		"SELECT proof FROM transaction_proofs WHERE tenant_id = $1 AND transaction_id = $2",
+		tenantID, transactionID,
+	).Scan(&document)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, weberror.TransactionNotFoundError(err)
+		}
+		return nil, weberror.DatabaseQueryError(err, "query transaction proof")
+	}
+	var proof Proof
+	if err := json.Unmarshal(document, &proof); err != nil {
+		return nil, weberror.JSONParseError(err)
+	}
+	return &proof, nil
+}
+
+// DeletePendingOfUser deletes the transactions of the user of the tenant that await
+// approval, and returns how many were deleted. Pending transactions are keyed by their
+// ID, so every one of the tenant is read.
+func DeletePendingOfUser(ctx context.Context, redisClient *redis.Client, tenantID, userID string) (int, error) {
+	deleted := 0
+	pattern := tenant.RedisKey(tenantID, PendingPrefix+"*")
+	iter := redisClient.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		data, err := redisClient.Get(ctx, key).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return deleted, weberror.RedisSessionGetError(err, key).LogCtx(ctx)
+		}
+		var pending Pending
+		if err := json.Unmarshal([]byte(data), &pending); err != nil || pending.UserID != userID {
+			continue
+		}
+		if err := redisClient.Del(ctx, key).Err(); err != nil {
+			return deleted, weberror.RedisSessionSetError(err, key).LogCtx(ctx)
+		}
+		deleted++
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, weberror.RedisSessionGetError(err, pattern).LogCtx(ctx)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,180 @@
+// Package txconfirm approves transactions, such as payouts, with a passkey. The
+// WebAuthn challenge is derived from the description of the transaction, so the
+// assertion signs the description itself, and the resulting Proof can be re-verified
+// offline by anyone holding it.
+package txconfirm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// PendingPrefix is the Redis key prefix, scoped to the tenant, of transactions awaiting
+// approval.
+const PendingPrefix = "transaction:"
+
+// MaxDescriptionLength bounds the description a service may submit.
+const MaxDescriptionLength = 4096
+
+// Pending is a submitted transaction waiting for the user to approve it.
+type Pending struct {
+	TransactionID  string               `json:"transactionId"`
+	UserID         string               `json:"userId"`
+	Username       string               `json:"username"`
+	WebauthnUserID string               `json:"webauthnUserId"`
+	DisplayName    string               `json:"displayName"`
+	Description    string               `json:"description"`
+	Nonce          string               `json:"nonce"`
+	SessionData    webauthn.SessionData `json:"sessionData"`
+}
+
+// Proof is the storable record of an approved transaction: the description, the nonce
+// the challenge was derived from, the origins of the relying party, and the assertion
+// with the public key that verifies it. Binary fields are base64url encoded without
+// padding.
+type Proof struct {
+	TransactionID     string    `json:"transactionId"`
+	TenantID          string    `json:"tenantId"`
+	RPID              string    `json:"rpId"`
+	Origins           []string  `json:"origins"`
+	Username          string    `json:"username"`
+	Description       string    `json:"description"`
+	Nonce             string    `json:"nonce"`
+	CredentialID      string    `json:"credentialId"`
+	PublicKey         string    `json:"publicKey"`
+	AuthenticatorData string    `json:"authenticatorData"`
+	ClientDataJSON    string    `json:"clientDataJSON"`
+	Signature         string    `json:"signature"`
+	ApprovedAt        time.Time `json:"approvedAt"`
+}
+
+var encoding = base64.RawURLEncoding
+
+// NewID returns a random transaction ID.
+func NewID() (string, error) {
+	return randomString(16)
+}
+
+// NewNonce returns a random, encoded nonce that makes the challenges of identical
+// descriptions differ.
+func NewNonce() (string, error) {
+	return randomString(32)
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// Challenge returns the WebAuthn challenge of a transaction: SHA-256 of the decoded
+// nonce followed by the UTF-8 description.
+func Challenge(description, nonce string) ([]byte, error) {
+	nonceBytes, err := encoding.DecodeString(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("decode nonce: %w", err)
+	}
+	h := sha256.New()
+	h.Write(nonceBytes)
+	h.Write([]byte(description))
+	return h.Sum(nil), nil
+}
+
+// NewProof records the verified assertion of a transaction with the stored public key
+// of its credential and the origins the relying party accepted it from.
+func NewProof(tenantID, rpID string, origins []string, pending Pending, publicKey string, assertion *protocol.ParsedCredentialAssertionData, approvedAt time.Time) Proof {
+	return Proof{
+		TransactionID:     pending.TransactionID,
+		TenantID:          tenantID,
+		RPID:              rpID,
+		Origins:           origins,
+		Username:          pending.Username,
+		Description:       pending.Description,
+		Nonce:             pending.Nonce,
+		CredentialID:      encoding.EncodeToString(assertion.RawID),
+		PublicKey:         publicKey,
+		AuthenticatorData: encoding.EncodeToString(assertion.Raw.AssertionResponse.AuthenticatorData),
+		ClientDataJSON:    encoding.EncodeToString(assertion.Raw.AssertionResponse.ClientDataJSON),
+		Signature:         encoding.EncodeToString(assertion.Raw.AssertionResponse.Signature),
+		ApprovedAt:        approvedAt,
+	}
+}
+
+// Verify checks a proof without any server state: the client data must be of an
+// assertion answering the challenge derived from the description and nonce, made on
+// one of the origins of the relying party, the authenticator data must be for the RP ID with the user present and verified, and the
+// signature must verify with the public key. It does not check that the public key
+// belongs to the user; auditors compare it with the credentials of the relying party.
+func Verify(proof Proof) error {
+	fields := map[string][]byte{}
+	for name, value := range map[string]string{
+		"publicKey":         proof.PublicKey,
+		"authenticatorData": proof.AuthenticatorData,
+		"clientDataJSON":    proof.ClientDataJSON,
+		"signature":         proof.Signature,
+	} {
+		decoded, err := encoding.DecodeString(value)
+		if err != nil || len(decoded) == 0 {
+			return fmt.Errorf("%s: invalid base64url", name)
+		}
+		fields[name] = decoded
+	}
+
+	challenge, err := Challenge(proof.Description, proof.Nonce)
+	if err != nil {
+		return err
+	}
+	var clientData protocol.CollectedClientData
+	if err := json.Unmarshal(fields["clientDataJSON"], &clientData); err != nil {
+		return fmt.Errorf("clientDataJSON: %w", err)
+	}
+	if clientData.Type != protocol.AssertCeremony {
+		return fmt.Errorf("clientDataJSON: type %q is not %q", clientData.Type, protocol.AssertCeremony)
+	}
+	if clientData.Challenge != encoding.EncodeToString(challenge) {
+		return errors.New("clientDataJSON: challenge does not match the description and nonce")
+	}
+	if !slices.Contains(proof.Origins, clientData.Origin) {
+		return fmt.Errorf("clientDataJSON: origin %q is not an origin of the relying party", clientData.Origin)
+	}
+
+	var authData protocol.AuthenticatorData
+	if err := authData.Unmarshal(fields["authenticatorData"]); err != nil {
+		return fmt.Errorf("authenticatorData: %w", err)
+	}
+	rpIDHash := sha256.Sum256([]byte(proof.RPID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return fmt.Errorf("authenticatorData: not for RP ID %q", proof.RPID)
+	}
+	if !authData.Flags.UserPresent() || !authData.Flags.UserVerified() {
+		return errors.New("authenticatorData: user was not present and verified")
+	}
+
+	key, err := webauthncose.ParsePublicKey(fields["publicKey"])
+	if err != nil {
+		return fmt.Errorf("publicKey: %w", err)
+	}
+	clientDataHash := sha256.Sum256(fields["clientDataJSON"])
+	signed := append(fields["authenticatorData"][:len(fields["authenticatorData"]):len(fields["authenticatorData"])], clientDataHash[:]...)
+	valid, err := webauthncose.VerifySignature(key, signed, fields["signature"])
+	if err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+	if !valid {
+		return errors.New("signature: does not verify with the public key")
+	}
+	return nil
+}
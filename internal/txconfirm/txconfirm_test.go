@@ -0,0 +1,144 @@
+package txconfirm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// signedProof is a proof of an assertion by a fresh P-256 key. The options change the
+// signed assertion, so that the signature still verifies and only the checked
+// property is wrong.
+type signedProof struct {
+	rpID        string
+	origin      string
+	ceremony    protocol.CeremonyType
+	flags       protocol.AuthenticatorFlags
+	description string
+}
+
+func newProof(t *testing.T, opts signedProof) Proof {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord: key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce, err := NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := Challenge(opts.description, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientDataJSON, err := json.Marshal(protocol.CollectedClientData{
+		Type:      opts.ceremony,
+		Challenge: encoding.EncodeToString(challenge),
+		Origin:    opts.origin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(opts.rpID))
+	authenticatorData := append(rpIDHash[:], byte(opts.flags), 0, 0, 0, 1)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authenticatorData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Proof{
+		TransactionID:     "tx",
+		TenantID:          "default",
+		RPID:              "example.com",
+		Origins:           []string{"https://example.com", "https://example.co.uk"},
+		Username:          "alice",
+		Description:       "Pay 100 EUR to Bob",
+		Nonce:             nonce,
+		CredentialID:      encoding.EncodeToString([]byte("credential")),
+		PublicKey:         encoding.EncodeToString(publicKey),
+		AuthenticatorData: encoding.EncodeToString(authenticatorData),
+		ClientDataJSON:    encoding.EncodeToString(clientDataJSON),
+		Signature:         encoding.EncodeToString(signature),
+		ApprovedAt:        time.Now().UTC(),
+	}
+}
+
+func TestVerify(t *testing.T) {
+	valid := signedProof{
+		rpID:        "example.com",
+		origin:      "https://example.com",
+		ceremony:    protocol.AssertCeremony,
+		flags:       protocol.FlagUserPresent | protocol.FlagUserVerified,
+		description: "Pay 100 EUR to Bob",
+	}
+	otherNonce, err := NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		signed  func(o *signedProof)
+		tamper  func(p *Proof)
+		wantErr bool
+	}{
+		{"good proof", nil, nil, false},
+		{"related origin", func(o *signedProof) { o.origin = "https://example.co.uk" }, nil, false},
+		{"tampered description", nil, func(p *Proof) { p.Description = "Pay 10000 EUR to Mallory" }, true},
+		{"tampered nonce", nil, func(p *Proof) { p.Nonce = otherNonce }, true},
+		{"undecodable nonce", nil, func(p *Proof) { p.Nonce = "not base64url!" }, true},
+		{"signed for another description", func(o *signedProof) { o.description = "Pay 1 EUR to Bob" }, nil, true},
+		{"wrong RP ID", func(o *signedProof) { o.rpID = "evil.example" }, nil, true},
+		{"RP ID of proof changed", nil, func(p *Proof) { p.RPID = "evil.example" }, true},
+		{"wrong origin", func(o *signedProof) { o.origin = "https://evil.example" }, nil, true},
+		{"proof without origins", nil, func(p *Proof) { p.Origins = nil }, true},
+		{"missing user verification", func(o *signedProof) { o.flags = protocol.FlagUserPresent }, nil, true},
+		{"missing user presence", func(o *signedProof) { o.flags = protocol.FlagUserVerified }, nil, true},
+		{"registration ceremony", func(o *signedProof) { o.ceremony = protocol.CreateCeremony }, nil, true},
+		{"other public key", nil, func(p *Proof) { p.PublicKey = newProof(t, valid).PublicKey }, true},
+		{"empty signature", nil, func(p *Proof) { p.Signature = "" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := valid
+			if tt.signed != nil {
+				tt.signed(&opts)
+			}
+			proof := newProof(t, opts)
+			if tt.tamper != nil {
+				tt.tamper(&proof)
+			}
+
+			err := Verify(proof)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
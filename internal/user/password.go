@@ -0,0 +1,57 @@
+package user
+
+import (
+	"database/sql"
+
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+)
+
+// PasswordLogin is what a password sign-in, and the account summary, need to know of a user.
+type PasswordLogin struct {
+	UserID       string
+	Username     string
+	PasswordHash string
+	// Disabled is the flag the user set; it only applies while Passkeys > 0.
+	Disabled bool
+	Passkeys int
+}
+
+// Enabled reports whether the user may sign in with their password. Users without a
+// passkey always may, so that removing the last passkey cannot lock them out.
+func (l PasswordLogin) Enabled() bool {
+	return !l.Disabled || l.Passkeys == 0
+}
+
+// QueryPasswordLogin queries the password hash, the password sign-in flag and the number
+// of passkeys of the user of the tenant by username.
+func QueryPasswordLogin(db *sql.DB, tenantID, username string, login *PasswordLogin) (string, error) {
+	err := db.QueryRow(
+		`SELECT u.id, u.username, u.password_hash, u.password_login_disabled,
+			(SELECT COUNT(*) FROM credentials c WHERE c.user_id = u.id)
+		FROM users u WHERE u.tenant_id = $1 AND u.username = $2`,
+		tenantID, username,
+	).Scan(&login.UserID, &login.Username, &login.PasswordHash, &login.Disabled, &login.Passkeys)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", weberror.UserNotFoundError(err, "query password login")
+		}
+		return "", weberror.DatabaseQueryError(err, "query password login")
+	}
+	return login.UserID, nil
+}
+
+// SetPasswordLoginDisabled turns password sign-in of the user of the tenant off or back
+// on. It is only turned off for a user with a passkey: otherwise no row is updated, and
+// callers report that a passkey is required.
+func SetPasswordLoginDisabled(db *sql.DB, tenantID, userID string, disabled bool) (sql.Result, error) {
+	query := `UPDATE users SET password_login_disabled = FALSE, updated_at = CURRENT_TIMESTAMP WHERE tenant_id = $1 AND id = $2`
+	if disabled {
+		query = `UPDATE users SET password_login_disabled = TRUE, updated_at = CURRENT_TIMESTAMP
+		WHERE tenant_id = $1 AND id = $2 AND EXISTS (SELECT 1 FROM credentials c WHERE c.user_id = users.id)`
+	}
+	result, err := db.Exec(query, tenantID, userID)
+	if err != nil {
+		return nil, weberror.DatabaseUpdateError(err, "set password login disabled")
+	}
+	return result, nil
+}
@@ -3,8 +3,11 @@ package user
 
 import (
 	"database/sql"
+	"strings"
 
 	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/jamesyang124/webauthn-example/types"
+	"github.com/lib/pq"
 )
 
 // ExecAndRespondOnError executes a DB statement and returns error for handler-level handling.
@@ -20,13 +23,13 @@ func ExecAndRespondOnError(
 	return result, nil
 }
 
-// QueryUserByUsername queries the user by username using TryIO pattern.
+// QueryUserByUsername queries the user of the tenant by username using TryIO pattern.
 func QueryUserByUsername(
 	dbConn *sql.DB,
-	username string,
+	tenantID, username string,
 	userID, usernameOut, createDate *string,
 ) (string, error) {
-	err := dbConn.QueryRow("SELECT id, username, created_at FROM users WHERE username=$1", username).
+	err := dbConn.QueryRow("SELECT id, username, created_at FROM users WHERE tenant_id=$1 AND username=$2", tenantID, username).
 		Scan(userID, usernameOut, createDate)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -37,54 +40,212 @@ func QueryUserByUsername(
 	return *usernameOut, nil
 }
 
-// QueryUserWebauthnByUsername queries the user and webauthn fields by username using TryIO pattern.
+// QueryUserWebauthnByUsername queries the user of the tenant and webauthn fields by username using TryIO pattern.
+// webauthnUserID and displayName are left empty when the user has never registered a credential.
 func QueryUserWebauthnByUsername(
 	dbConn *sql.DB,
-	username string,
-	userID, webauthnUserID, displayName, credentialIDEncoded, credentialPublicKeyEncoded *string,
+	tenantID, username string,
+	userID, webauthnUserID, displayName *string,
 ) (string, error) {
+	var webauthnUserIDColumn, displayNameColumn sql.NullString
 	err := dbConn.QueryRow(
-		"SELECT id, webauthn_user_id, webauthn_displayname, webauthn_credential_id, webauthn_credential_public_key FROM users WHERE username=$1",
-		username,
-	).Scan(userID, webauthnUserID, displayName, credentialIDEncoded, credentialPublicKeyEncoded)
+		"SELECT id, webauthn_user_id, webauthn_displayname FROM users WHERE tenant_id=$1 AND username=$2",
+		tenantID, username,
+	).Scan(userID, &webauthnUserIDColumn, &displayNameColumn)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return *userID, weberror.UserNotFoundError(err, "query user by username")
 		}
 		return *userID, weberror.DatabaseQueryError(err, "query user by username")
 	}
+	*webauthnUserID = webauthnUserIDColumn.String
+	*displayName = displayNameColumn.String
 	return *userID, nil
 }
 
-// UpdateUserWebauthnCredentials updates the user's webauthn credentials and returns error for handler-level handling.
-func UpdateUserWebauthnCredentials(
+// QueryUserByWebauthnHandle queries the user of the tenant by the WebAuthn user handle an
+// authenticator returned in a discoverable login.
+func QueryUserByWebauthnHandle(
+	dbConn *sql.DB,
+	tenantID, webauthnUserID string,
+	userID, username, displayName *string,
+) (string, error) {
+	var displayNameColumn sql.NullString
+	err := dbConn.QueryRow(
+		"SELECT id, username, webauthn_displayname FROM users WHERE tenant_id=$1 AND webauthn_user_id=$2",
+		tenantID, webauthnUserID,
+	).Scan(userID, username, &displayNameColumn)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return *userID, weberror.UserNotFoundError(err, "query user by webauthn handle")
+		}
+		return *userID, weberror.DatabaseQueryError(err, "query user by webauthn handle")
+	}
+	*displayName = displayNameColumn.String
+	return *userID, nil
+}
+
+// UpdateUserWebauthnIdentity stores the WebAuthn user handle and display name of the user of the tenant.
+func UpdateUserWebauthnIdentity(
 	db *sql.DB,
+	tenantID, webauthnUserID, displayName, username string,
+) (sql.Result, error) {
+	query := `UPDATE users SET webauthn_user_id = $1, webauthn_displayname = $2, updated_at = CURRENT_TIMESTAMP WHERE tenant_id = $3 AND username = $4`
+	result, err := db.Exec(query, webauthnUserID, displayName, tenantID, username)
+	if err != nil {
+		return nil, weberror.DatabaseUpdateError(err, "update user webauthn identity")
+	}
+	return result, nil
+}
+
+// ClearUserWebauthnIdentity removes the WebAuthn user handle so the next registration starts
+// afresh. The display name is kept: the user chose it at signup. db may be a
+// transaction.
+func ClearUserWebauthnIdentity(
+	db interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+	},
 	userID string,
-	signCount uint32,
-	credentialIDEncoded, credentialPublicKeyEncoded, displayName, username string,
 ) (sql.Result, error) {
-	query := `UPDATE users SET webauthn_user_id = $1, webauthn_sign_count = $2, webauthn_credential_id = $3, webauthn_credential_public_key = $4, webauthn_displayname = $5 WHERE username = $6`
-	result, err := db.Exec(
-		query,
-		userID,
-		signCount,
-		credentialIDEncoded,
-		credentialPublicKeyEncoded,
-		displayName,
-		username,
+	query := `UPDATE users SET webauthn_user_id = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	result, err := db.Exec(query, userID)
+	if err != nil {
+		return nil, weberror.DatabaseUpdateError(err, "clear user webauthn identity")
+	}
+	return result, nil
+}
+
+// CreateUser inserts a user of the tenant and returns its id. Without a password an
+// unguessable random one is hashed, so the account can only sign in with a passkey.
+func CreateUser(db *sql.DB, tenantID, username, email, password string) (string, error) {
+	var userID string
+	err := db.QueryRow(
+		`INSERT INTO users (tenant_id, username, email, password_hash)
+		VALUES ($1, $2, $3, crypt(COALESCE(NULLIF($4, ''), encode(gen_random_bytes(32), 'hex')), gen_salt('bf')))
+		RETURNING id`,
+		tenantID, username, email, password,
+	).Scan(&userID)
+	if err != nil {
+		return "", weberror.DatabaseUpdateError(err, "create user")
+	}
+	return userID, nil
+}
+
+// ListUsers returns a page of the users of the tenant ordered by id, with their credential count.
+func ListUsers(db *sql.DB, tenantID string, limit, offset int) ([]types.UserSummary, error) {
+	return SearchUsers(db, tenantID, "", limit, offset)
+}
+
+// likeEscaper escapes the LIKE wildcards, and the escape character itself, of a string
+// matched literally with ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchUsers returns a page of the users of the tenant whose username, email or display
+// name contains query (case-insensitive), ordered by id. An empty query matches every
+// user; % and _ in query match themselves.
+func SearchUsers(db *sql.DB, tenantID, query string, limit, offset int) ([]types.UserSummary, error) {
+	rows, err := db.Query(
+		`SELECT u.id, u.username, u.email, COALESCE(u.webauthn_displayname, ''), u.roles, u.locked_at, u.created_at, COUNT(c.id)
+		FROM users u
+		LEFT JOIN credentials c ON c.user_id = u.id
+		WHERE u.tenant_id = $1 AND (
+			u.username ILIKE $2 ESCAPE '\'
+			OR u.email ILIKE $2 ESCAPE '\'
+			OR u.webauthn_displayname ILIKE $2 ESCAPE '\'
+		)
+		GROUP BY u.id
+		ORDER BY u.id
+		LIMIT $3 OFFSET $4`,
+		tenantID, "%"+likeEscaper.Replace(query)+"%", limit, offset,
 	)
 	if err != nil {
-		return nil, weberror.DatabaseUpdateError(err, "update user webauthn credentials")
+		return nil, weberror.DatabaseQueryError(err, "search users")
+	}
+	defer rows.Close()
+
+	users := []types.UserSummary{}
+	for rows.Next() {
+		var u types.UserSummary
+		var lockedAt sql.NullTime
+		if err := rows.Scan(
+			&u.ID, &u.Username, &u.Email, &u.DisplayName,
+			pq.Array(&u.Roles), &lockedAt, &u.CreatedAt, &u.CredentialCount,
+		); err != nil {
+			return nil, weberror.DatabaseQueryError(err, "scan user")
+		}
+		if lockedAt.Valid {
+			u.LockedAt = &lockedAt.Time
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, weberror.DatabaseQueryError(err, "iterate users")
+	}
+	return users, nil
+}
+
+// QueryUserAccess queries the roles of the user of the tenant and whether the account is
+// locked. Users of other tenants are not found.
+func QueryUserAccess(db *sql.DB, tenantID, userID string, roles *[]string, locked *bool) (string, error) {
+	var lockedAt sql.NullTime
+	err := db.QueryRow("SELECT roles, locked_at FROM users WHERE tenant_id = $1 AND id = $2", tenantID, userID).
+		Scan(pq.Array(roles), &lockedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", weberror.UserNotFoundError(err, "query user access")
+		}
+		return "", weberror.DatabaseQueryError(err, "query user access")
+	}
+	*locked = lockedAt.Valid
+	return userID, nil
+}
+
+// EnsureUserNotLocked fails with an account locked error when the user has been locked.
+func EnsureUserNotLocked(db *sql.DB, tenantID, userID string) (string, error) {
+	var roles []string
+	var locked bool
+	if _, err := QueryUserAccess(db, tenantID, userID, &roles, &locked); err != nil {
+		return "", err
+	}
+	if locked {
+		return "", weberror.AccountLockedError(userID)
+	}
+	return userID, nil
+}
+
+// SetUserLocked locks or unlocks the account of the user of the tenant.
+func SetUserLocked(db *sql.DB, tenantID, userID string, locked bool) (sql.Result, error) {
+	query := `UPDATE users SET locked_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE tenant_id = $1 AND id = $2`
+	if locked {
+		query = `UPDATE users SET locked_at = COALESCE(locked_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP WHERE tenant_id = $1 AND id = $2`
+	}
+	result, err := db.Exec(query, tenantID, userID)
+	if err != nil {
+		return nil, weberror.DatabaseUpdateError(err, "set user locked")
+	}
+	return result, nil
+}
+
+// UpdateUserEmail changes the email of the user of the tenant. Emails are unique per
+// tenant, so an email another user has is reported as taken.
+func UpdateUserEmail(db *sql.DB, tenantID, userID, email string) (sql.Result, error) {
+	query := `UPDATE users SET email = $1, updated_at = CURRENT_TIMESTAMP WHERE tenant_id = $2 AND id = $3`
+	result, err := db.Exec(query, email, tenantID, userID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, weberror.EmailTakenError(err)
+		}
+		return nil, weberror.DatabaseUpdateError(err, "update user email")
 	}
 	return result, nil
 }
 
-// UpdateUserWebauthnSignCount updates the user's webauthn sign count and returns error for handler-level handling.
-func UpdateUserWebauthnSignCount(db *sql.DB, signCount uint32, username string) (sql.Result, error) {
-	query := `UPDATE users SET webauthn_sign_count = $1 WHERE username = $2`
-	result, err := db.Exec(query, signCount, username)
+// UpdateUserRoles replaces the roles of the user.
+func UpdateUserRoles(db *sql.DB, userID string, roles []string) (sql.Result, error) {
+	query := `UPDATE users SET roles = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+	result, err := db.Exec(query, pq.Array(roles), userID)
 	if err != nil {
-		return nil, weberror.DatabaseUpdateError(err, "update user webauthn sign count")
+		return nil, weberror.DatabaseUpdateError(err, "update user roles")
 	}
 	return result, nil
 }
@@ -0,0 +1,26 @@
+package user
+
+import "testing"
+
+func TestLikeEscaper(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"plain", "alice", "alice"},
+		{"empty", "", ""},
+		{"percent", "100%", `100\%`},
+		{"underscore", "a_b", `a\_b`},
+		{"backslash", `a\b`, `a\\b`},
+		{"escaped wildcard stays literal", `\%`, `\\\%`},
+		{"every wildcard", `%_\`, `\%\_\\`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := likeEscaper.Replace(tt.query); got != tt.want {
+				t.Errorf("likeEscaper.Replace(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package user
+
+import (
+	"fmt"
+
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+)
+
+// Roles stored on the user and checked by middlewares.RequireRoles.
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+	RoleAuditor = "auditor"
+)
+
+var knownRoles = map[string]bool{
+	RoleAdmin:   true,
+	RoleSupport: true,
+	RoleAuditor: true,
+}
+
+// ValidateRoles rejects role names that are not known to the application.
+func ValidateRoles(roles []string) ([]string, error) {
+	for _, role := range roles {
+		if !knownRoles[role] {
+			return nil, weberror.RoleValidationError(fmt.Errorf("unknown role %q", role))
+		}
+	}
+	return roles, nil
+}
+
+// HasAnyRole reports whether granted contains at least one of required.
+func HasAnyRole(granted []string, required ...string) bool {
+	for _, g := range granted {
+		for _, r := range required {
+			if g == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasAllRoles reports whether granted contains every role of required.
+func HasAllRoles(granted []string, required ...string) bool {
+	for _, r := range required {
+		if !HasAnyRole(granted, r) {
+			return false
+		}
+	}
+	return true
+}
@@ -3,6 +3,9 @@ package user
 
 import (
 	"fmt"
+	"net/mail"
+	"strconv"
+	"unicode/utf8"
 
 	"github.com/jamesyang124/webauthn-example/internal/weberror"
 	"github.com/valyala/fasthttp"
@@ -21,21 +24,48 @@ func ValidateUsername(ctx *fasthttp.RequestCtx, requestData map[string]interface
 }
 
 // ValidateUsernameAndDisplayname validates and extracts username and displayname from requestData.
+// The columns hold at most 50 and 100 characters.
 func ValidateUsernameAndDisplayname(
 	ctx *fasthttp.RequestCtx,
 	requestData map[string]interface{},
 ) (string, string, error) {
 	username, ok := requestData["username"].(string)
-	if !ok || username == "" {
+	if !ok || username == "" || utf8.RuneCountInString(username) > 50 {
 		return "", "", weberror.UsernameValidationError(
 			fmt.Errorf("invalid or missing username"),
 		)
 	}
 	displayname, ok := requestData["displayname"].(string)
-	if !ok || displayname == "" {
+	if !ok || displayname == "" || utf8.RuneCountInString(displayname) > 100 {
 		return "", "", weberror.DisplayNameValidationError(
 			fmt.Errorf("invalid or missing displayname"),
 		)
 	}
 	return username, displayname, nil
 }
+
+// ValidateEmail validates and extracts a bare email address from requestData. Display
+// names and angle brackets are rejected, and the column holds at most 100 characters.
+func ValidateEmail(requestData map[string]interface{}, email *string) (string, error) {
+	value, ok := requestData["email"].(string)
+	if !ok || value == "" || len(value) > 100 {
+		return "", weberror.EmailValidationError(fmt.Errorf("invalid or missing email"))
+	}
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value {
+		return "", weberror.EmailValidationError(fmt.Errorf("invalid email address"))
+	}
+	*email = value
+	return value, nil
+}
+
+// ValidateUserIDParam validates and extracts the numeric userId path parameter.
+// A malformed ID cannot name any user, so it is reported as not found.
+func ValidateUserIDParam(ctx *fasthttp.RequestCtx, userID *string) (string, error) {
+	param, _ := ctx.UserValue("userId").(string)
+	if _, err := strconv.ParseInt(param, 10, 64); err != nil {
+		return "", weberror.UserNotFoundError(err, "parse user id")
+	}
+	*userID = param
+	return param, nil
+}
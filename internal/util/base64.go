@@ -23,7 +23,7 @@ func DecodeCredentialID(ctx *fasthttp.RequestCtx, encoded string) ([]byte, error
 
 	res, err := base64.RawURLEncoding.DecodeString(encoded)
 	if err != nil {
-		return nil, weberror.CredentialDecodeError(err).Log()
+		return nil, weberror.CredentialDecodeError(err).LogCtx(ctx)
 	}
 	return res, nil
 
@@ -33,7 +33,7 @@ func DecodeCredentialID(ctx *fasthttp.RequestCtx, encoded string) ([]byte, error
 func DecodeCredentialPublicKey(ctx *fasthttp.RequestCtx, encoded string, credentialPublicKey *[]byte) ([]byte, error) {
 	decoded, err := DecodeRawURLEncoding(encoded)
 	if err != nil {
-		return nil, weberror.CredentialPublicKeyDecodeError(err).Log()
+		return nil, weberror.CredentialPublicKeyDecodeError(err).LogCtx(ctx)
 	}
 	*credentialPublicKey = decoded
 	return decoded, nil
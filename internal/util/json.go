@@ -12,7 +12,7 @@ import (
 func ParseJSONBody(ctx *fasthttp.RequestCtx, v interface{}) (string, error) {
 	err := json.Unmarshal(ctx.PostBody(), v)
 	if err != nil {
-		return "", weberror.JSONParseError(err).Log()
+		return "", weberror.JSONParseError(err).LogCtx(ctx)
 	}
 	return "", nil
 }
@@ -21,7 +21,7 @@ func ParseJSONBody(ctx *fasthttp.RequestCtx, v interface{}) (string, error) {
 func MarshalAndRespondOnError(ctx *fasthttp.RequestCtx, v interface{}) ([]byte, error) {
 	responseJSON, err := json.Marshal(v)
 	if err != nil {
-		return responseJSON, weberror.JSONMarshalError(err).Log()
+		return responseJSON, weberror.JSONMarshalError(err).LogCtx(ctx)
 	}
 	return responseJSON, nil
 }
@@ -30,7 +30,7 @@ func MarshalAndRespondOnError(ctx *fasthttp.RequestCtx, v interface{}) ([]byte,
 func UnmarshalAndRespondOnError(ctx *fasthttp.RequestCtx, data []byte, v interface{}) ([]byte, error) {
 	err := json.Unmarshal(data, v)
 	if err != nil {
-		return data, weberror.JSONParseError(err).Log()
+		return data, weberror.JSONParseError(err).LogCtx(ctx)
 	}
 	return data, nil
 }
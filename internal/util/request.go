@@ -13,7 +13,7 @@ func ConvertFastHTTPToHTTPRequest(ctx *fasthttp.RequestCtx, req *http.Request) (
 	var httpRequest http.Request
 	err := fasthttpadaptor.ConvertRequest(ctx, &httpRequest, true)
 	if err != nil {
-		return nil, weberror.RequestConversionError(err).Log()
+		return nil, weberror.RequestConversionError(err).LogCtx(ctx)
 	}
 	*req = httpRequest
 	return req, nil
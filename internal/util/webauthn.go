@@ -1,50 +1,50 @@
 // Package util provides utility functions for JSON, base64, and WebAuthn operations.
 //
-// This package includes functions to initialize WebAuthn, begin and finish
-// registration and login processes, and create WebAuthnUser instances. It is
+// This package includes functions to begin and finish registration and login
+// processes with the WebAuthn instance of the request's tenant, and create
+// WebAuthnUser instances. It is
 // meant to be used internally within the webauthn-example application.
 package util
 
 import (
+	"bytes"
 	"html/template"
-	"log"
 	"net/http"
-	"sync"
+	"time"
 
 	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
 	"github.com/jamesyang124/webauthn-example/internal/weberror"
 	"github.com/jamesyang124/webauthn-example/types"
 	"github.com/valyala/fasthttp"
 )
 
-var (
-	WebAuthn     *webauthn.WebAuthn
-	RegisterTmpl *template.Template
-	once         sync.Once
-)
+var RegisterTmpl *template.Template
 
-// InitWebAuthn initializes the WebAuthn instance with the correct config.
-func InitWebAuthn() {
-	once.Do(func() {
-		var err error
-		WebAuthn, err = webauthn.New(&webauthn.Config{
-			RPDisplayName: "Example Corp",
-			RPID:          "localhost",
-			RPOrigins:     []string{"http://localhost:8080"},
-		})
-		if err != nil {
-			log.Fatalf("failed to create WebAuthn instance: %v", err)
-		}
-	})
+// relyingParty returns the WebAuthn instance of the tenant serving the request. Routes
+// running ceremonies are wrapped with middlewares.RequireTenant, so there always is one.
+func relyingParty(ctx *fasthttp.RequestCtx) *webauthn.WebAuthn {
+	return tenant.From(ctx).WebAuthn
 }
 
 // BeginRegistration wraps WebAuthn.BeginRegistration and handles errors.
+// Credentials the user already registered are excluded from the ceremony; opts
+// usually come from Tenant.RegistrationOptions.
 func BeginRegistration(
 	ctx *fasthttp.RequestCtx,
 	user *types.WebAuthnUser,
+	opts ...webauthn.RegistrationOption,
 ) (options *protocol.CredentialCreation, sessionData *webauthn.SessionData, ok bool) {
-	options, sessionData, err := WebAuthn.BeginRegistration(user)
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.Credentials))
+	for _, credential := range user.Credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+	options, sessionData, err := relyingParty(ctx).BeginRegistration(
+		user,
+		append([]webauthn.RegistrationOption{webauthn.WithExclusions(exclusions)}, opts...)...,
+	)
 	if err != nil {
 		appErr := weberror.WebAuthnBeginRegistrationError(err)
 		httpErr := weberror.ToHTTPError(appErr)
@@ -61,7 +61,7 @@ func FinishRegistration(
 	sessionData webauthn.SessionData,
 	httpRequest *http.Request,
 ) (credential *webauthn.Credential, ok bool) {
-	credential, err := WebAuthn.FinishRegistration(user, sessionData, httpRequest)
+	credential, err := relyingParty(ctx).FinishRegistration(user, sessionData, httpRequest)
 	if err != nil {
 		appErr := weberror.WebAuthnFinishRegistrationError(err)
 		httpErr := weberror.ToHTTPError(appErr)
@@ -71,16 +71,47 @@ func FinishRegistration(
 	return credential, true
 }
 
-// BeginLogin wraps WebAuthn.BeginLogin using TryIO pattern.
+// ParseAttestation parses the credential of a registration, so that the challenge it
+// answers can be read before the session data is loaded.
+func ParseAttestation(
+	ctx *fasthttp.RequestCtx,
+	credentialData []byte,
+	parsed *protocol.ParsedCredentialCreationData,
+) (string, error) {
+	attestation, err := protocol.ParseCredentialCreationResponseBytes(credentialData)
+	if err != nil {
+		return "", weberror.CredentialDataInvalidError(err).LogCtx(ctx)
+	}
+	*parsed = *attestation
+	return attestation.Response.CollectedClientData.Challenge, nil
+}
+
+// CreateCredential validates a registration parsed with ParseAttestation.
+func CreateCredential(
+	ctx *fasthttp.RequestCtx,
+	user *types.WebAuthnUser,
+	sessionData webauthn.SessionData,
+	parsed *protocol.ParsedCredentialCreationData,
+) (*webauthn.Credential, error) {
+	credential, err := relyingParty(ctx).CreateCredential(user, sessionData, parsed)
+	if err != nil {
+		return nil, weberror.WebAuthnFinishRegistrationError(err).LogCtx(ctx)
+	}
+	return credential, nil
+}
+
+// BeginLogin wraps WebAuthn.BeginLogin using TryIO pattern. opts usually carry the
+// extension inputs of the tenant, see extension.LoginOptions.
 func BeginLogin(
 	ctx *fasthttp.RequestCtx,
 	user *types.WebAuthnUser,
 	beginLoginResponse *types.BeginLoginResponse,
+	opts ...webauthn.LoginOption,
 ) (*types.BeginLoginResponse, error) {
 
-	options, sessionData, err := WebAuthn.BeginLogin(user)
+	options, sessionData, err := relyingParty(ctx).BeginLogin(user, opts...)
 	if err != nil {
-		return nil, weberror.WebAuthnBeginLoginError(err).Log()
+		return nil, weberror.WebAuthnBeginLoginError(err).LogCtx(ctx)
 	}
 	*beginLoginResponse = types.BeginLoginResponse{
 		Options:     options,
@@ -89,16 +120,124 @@ func BeginLogin(
 	return beginLoginResponse, nil
 }
 
-// FinishLogin wraps WebAuthn.FinishLogin and handles errors.
-func FinishLogin(
+// BeginStepUp begins a login of the signed-in user that requires user verification, so
+// that its assertion proves the user is present and verified right now.
+func BeginStepUp(
+	ctx *fasthttp.RequestCtx,
+	user *types.WebAuthnUser,
+	beginLoginResponse *types.BeginLoginResponse,
+) (*types.BeginLoginResponse, error) {
+	options, sessionData, err := relyingParty(ctx).BeginLogin(
+		user, webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, weberror.WebAuthnBeginLoginError(err).LogCtx(ctx)
+	}
+	*beginLoginResponse = types.BeginLoginResponse{
+		Options:     options,
+		SessionData: sessionData,
+	}
+	return beginLoginResponse, nil
+}
+
+// BeginTransactionLogin begins a login of the user answering the given challenge, which
+// is derived from a transaction, with user verification required.
+func BeginTransactionLogin(
+	ctx *fasthttp.RequestCtx,
+	user *types.WebAuthnUser,
+	challenge []byte,
+	timeout time.Duration,
+	beginLoginResponse *types.BeginLoginResponse,
+) (*types.BeginLoginResponse, error) {
+	options, sessionData, err := relyingParty(ctx).BeginLogin(
+		user,
+		webauthn.WithChallenge(challenge),
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+		func(opts *protocol.PublicKeyCredentialRequestOptions) {
+			opts.Timeout = int(timeout.Milliseconds())
+		},
+	)
+	if err != nil {
+		return nil, weberror.WebAuthnBeginLoginError(err).LogCtx(ctx)
+	}
+	*beginLoginResponse = types.BeginLoginResponse{
+		Options:     options,
+		SessionData: sessionData,
+	}
+	return beginLoginResponse, nil
+}
+
+// ValidateLogin validates an assertion parsed with ParseAssertion, for callers that
+// need its raw fields afterwards.
+func ValidateLogin(
 	ctx *fasthttp.RequestCtx,
 	user *types.WebAuthnUser,
 	sessionData webauthn.SessionData,
-	httpRequest *http.Request,
+	parsed *protocol.ParsedCredentialAssertionData,
 ) (*webauthn.Credential, error) {
-	credential, err := WebAuthn.FinishLogin(user, sessionData, httpRequest)
+	credential, err := relyingParty(ctx).ValidateLogin(user, sessionData, parsed)
 	if err != nil {
-		return nil, weberror.WebAuthnFinishLoginError(err).Log()
+		return nil, weberror.WebAuthnFinishLoginError(err).LogCtx(ctx)
+	}
+	return credential, nil
+}
+
+// BeginDiscoverableLogin begins a login for conditional mediation: the options carry no
+// allow list, so the browser offers every passkey of the relying party in the autofill
+// of the username field, and they time out with the challenge after timeout.
+func BeginDiscoverableLogin(
+	ctx *fasthttp.RequestCtx,
+	timeout time.Duration,
+	beginLoginResponse *types.BeginLoginResponse,
+	opts ...webauthn.LoginOption,
+) (*types.BeginLoginResponse, error) {
+	options, sessionData, err := relyingParty(ctx).BeginDiscoverableMediatedLogin(
+		protocol.MediationConditional,
+		append([]webauthn.LoginOption{
+			func(opts *protocol.PublicKeyCredentialRequestOptions) {
+				opts.Timeout = int(timeout.Milliseconds())
+			},
+		}, opts...)...,
+	)
+	if err != nil {
+		return nil, weberror.WebAuthnBeginLoginError(err).LogCtx(ctx)
+	}
+	*beginLoginResponse = types.BeginLoginResponse{
+		Options:     options,
+		SessionData: sessionData,
+	}
+	return beginLoginResponse, nil
+}
+
+// ParseAssertion parses the credential of a login, so that its client data can be read
+// before the session data it answers is loaded.
+func ParseAssertion(
+	ctx *fasthttp.RequestCtx,
+	credentialData []byte,
+	parsed *protocol.ParsedCredentialAssertionData,
+) (string, error) {
+	assertion, err := protocol.ParseCredentialRequestResponseBytes(credentialData)
+	if err != nil {
+		return "", weberror.CredentialDataInvalidError(err).LogCtx(ctx)
+	}
+	*parsed = *assertion
+	return assertion.Response.CollectedClientData.Challenge, nil
+}
+
+// FinishDiscoverableLogin validates a discoverable login against the user its user
+// handle resolved to.
+func FinishDiscoverableLogin(
+	ctx *fasthttp.RequestCtx,
+	user *types.WebAuthnUser,
+	sessionData webauthn.SessionData,
+	parsed *protocol.ParsedCredentialAssertionData,
+) (*webauthn.Credential, error) {
+	credential, err := relyingParty(ctx).ValidateDiscoverableLogin(
+		func(_, _ []byte) (webauthn.User, error) { return user, nil },
+		sessionData, parsed,
+	)
+	if err != nil {
+		return nil, weberror.WebAuthnFinishLoginError(err).LogCtx(ctx)
 	}
 	return credential, nil
 }
@@ -113,14 +252,101 @@ func NewWebAuthnUser(id, name, displayName string) *types.WebAuthnUser {
 	}
 }
 
-// NewWebAuthnUserWithCredential creates a WebAuthnUser with a credential using TryIO pattern.
-func NewWebAuthnUserWithCredential(id, name, displayName string, credentialID, credentialPublicKey []byte) (*types.WebAuthnUser, error) {
+// DecodeStoredCredentials decodes persisted credentials into webauthn.Credential values using TryIO pattern.
+// Transports end up in allowCredentials, and the flags let the library check that
+// BackupEligible did not change. assertion is the login being validated, nil when
+// building options; a credential whose BackupEligible is unknown takes it from the
+// assertion it signed, as its first login after the flag was recorded.
+func DecodeStoredCredentials(
+	ctx *fasthttp.RequestCtx,
+	stored []types.StoredCredential,
+	assertion *protocol.ParsedCredentialAssertionData,
+) ([]webauthn.Credential, error) {
+	credentials := make([]webauthn.Credential, 0, len(stored))
+	for _, sc := range stored {
+		credentialID, err := DecodeCredentialID(ctx, sc.CredentialID)
+		if err != nil {
+			return nil, err
+		}
+		var publicKey []byte
+		if _, err := DecodeCredentialPublicKey(ctx, sc.PublicKey, &publicKey); err != nil {
+			return nil, err
+		}
+		transports := make([]protocol.AuthenticatorTransport, len(sc.Transports))
+		for i, transport := range sc.Transports {
+			transports[i] = protocol.AuthenticatorTransport(transport)
+		}
+		var aaguid []byte
+		if id, err := uuid.Parse(sc.AAGUID); err == nil {
+			aaguid = id[:]
+		}
+		var backupEligible bool
+		switch {
+		case sc.BackupEligible != nil:
+			backupEligible = *sc.BackupEligible
+		case assertion != nil && bytes.Equal(assertion.RawID, credentialID):
+			backupEligible = assertion.Response.AuthenticatorData.Flags.HasBackupEligible()
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              credentialID,
+			PublicKey:       publicKey,
+			AttestationType: sc.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserPresent:    sc.UserPresent,
+				UserVerified:   sc.UserVerified,
+				BackupEligible: backupEligible,
+				BackupState:    sc.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:     aaguid,
+				SignCount:  sc.SignCount,
+				Attachment: protocol.AuthenticatorAttachment(sc.Attachment),
+			},
+		})
+	}
+	return credentials, nil
+}
+
+// EncodeCredential converts a credential from a ceremony into its persisted form.
+func EncodeCredential(credential *webauthn.Credential) types.StoredCredential {
+	transports := make([]string, len(credential.Transport))
+	for i, transport := range credential.Transport {
+		transports[i] = string(transport)
+	}
+	var aaguid string
+	if id, err := uuid.FromBytes(credential.Authenticator.AAGUID); err == nil {
+		aaguid = id.String()
+	}
+	backupEligible := credential.Flags.BackupEligible
+	return types.StoredCredential{
+		CredentialID:    EncodeRawURLEncoding(credential.ID),
+		PublicKey:       EncodeRawURLEncoding(credential.PublicKey),
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      transports,
+		UserPresent:     credential.Flags.UserPresent,
+		UserVerified:    credential.Flags.UserVerified,
+		BackupEligible:  &backupEligible,
+		BackupState:     credential.Flags.BackupState,
+		AAGUID:          aaguid,
+		AttestationType: credential.AttestationType,
+		Attachment:      string(credential.Authenticator.Attachment),
+	}
+}
+
+// NewWebAuthnUserWithCredentials creates a WebAuthnUser with its registered credentials using TryIO pattern.
+func NewWebAuthnUserWithCredentials(id, name, displayName string, credentials []webauthn.Credential) (*types.WebAuthnUser, error) {
 
-	if len(credentialID) == 0 {
-		return nil, weberror.ErrCredentialIDEmpty
+	if len(credentials) == 0 {
+		return nil, weberror.ErrNoCredentials
 	}
-	if len(credentialPublicKey) == 0 {
-		return nil, weberror.ErrCredentialPublicKeyEmpty
+	for _, credential := range credentials {
+		if len(credential.ID) == 0 {
+			return nil, weberror.ErrCredentialIDEmpty
+		}
+		if len(credential.PublicKey) == 0 {
+			return nil, weberror.ErrCredentialPublicKeyEmpty
+		}
 	}
 	if id == "" || name == "" || displayName == "" {
 		return nil, weberror.ErrUserFieldsEmpty
@@ -129,33 +355,6 @@ func NewWebAuthnUserWithCredential(id, name, displayName string, credentialID, c
 		ID:          id,
 		Name:        name,
 		DisplayName: displayName,
-		Credentials: []webauthn.Credential{
-			{
-				ID:        credentialID,
-				PublicKey: credentialPublicKey,
-			},
-		},
-	}, nil
-}
-
-// NewWebAuthnUserWithBackupEligible creates a WebAuthnUser with a credential and BackupEligible=true.
-func NewWebAuthnUserWithBackupEligible(
-	id, name, displayName string,
-	credentialID, credentialPublicKey []byte,
-	backupEligible bool,
-) (*types.WebAuthnUser, error) {
-	return &types.WebAuthnUser{
-		ID:          id,
-		Name:        name,
-		DisplayName: displayName,
-		Credentials: []webauthn.Credential{
-			{
-				ID:        credentialID,
-				PublicKey: credentialPublicKey,
-				Flags: webauthn.CredentialFlags{
-					BackupEligible: backupEligible,
-				},
-			},
-		},
+		Credentials: credentials,
 	}, nil
 }
@@ -1,8 +1,11 @@
 package weberror
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/jamesyang124/webauthn-example/internal/logging"
+
 	"go.uber.org/zap"
 )
 
@@ -29,11 +32,20 @@ func (a *AppError) Unwrap() error {
 
 // Log logs the application error with structured fields
 func (a *AppError) Log() *AppError {
-	fields := append(a.Fields, zap.String("error_code", a.Code))
+	return a.log(logging.L("weberror"))
+}
+
+// LogCtx logs the application error like Log, adding the request ID of ctx
+func (a *AppError) LogCtx(ctx context.Context) *AppError {
+	return a.log(logging.WithRequest(ctx, logging.L("weberror")))
+}
+
+func (a *AppError) log(logger *zap.Logger) *AppError {
+	fields := append(a.Fields[:len(a.Fields):len(a.Fields)], zap.String("error_code", a.Code))
 	if a.Err != nil {
 		fields = append(fields, zap.Error(a.Err))
 	}
-	zap.L().Error(a.LogMsg, fields...)
+	logger.Error(a.LogMsg, fields...)
 	return a
 }
 
@@ -113,6 +125,115 @@ var (
 		Fields: []zap.Field{zap.String("component", "validation")},
 	}
 
+	ErrNoCredentials = &AppError{
+		Code:   "NO_CREDENTIALS_ERROR",
+		LogMsg: "User has no registered credentials",
+		Fields: []zap.Field{zap.String("component", "validation")},
+	}
+
+	ErrEmailValidation = &AppError{
+		Code:   "EMAIL_VALIDATION_ERROR",
+		LogMsg: "Email validation failed",
+		Fields: []zap.Field{zap.String("component", "validation")},
+	}
+
+	ErrRoleValidation = &AppError{
+		Code:   "ROLE_VALIDATION_ERROR",
+		LogMsg: "Unknown role",
+		Fields: []zap.Field{zap.String("component", "validation")},
+	}
+
+	ErrExtensionValidation = &AppError{
+		Code:   "EXTENSION_VALIDATION_ERROR",
+		LogMsg: "Extension request validation failed",
+		Fields: []zap.Field{zap.String("component", "validation")},
+	}
+
+	ErrRegistrationProfile = &AppError{
+		Code:   "REGISTRATION_PROFILE_ERROR",
+		LogMsg: "Registration profile not offered by the tenant",
+		Fields: []zap.Field{zap.String("component", "validation")},
+	}
+
+	// Access Control Errors
+	ErrUnauthenticated = &AppError{
+		Code:   "UNAUTHENTICATED_ERROR",
+		LogMsg: "Request has no valid session",
+		Fields: []zap.Field{zap.String("component", "auth")},
+	}
+
+	ErrForbidden = &AppError{
+		Code:   "FORBIDDEN_ERROR",
+		LogMsg: "Session lacks the required role",
+		Fields: []zap.Field{zap.String("component", "auth")},
+	}
+
+	ErrTargetPrivileged = &AppError{
+		Code:   "TARGET_PRIVILEGED_ERROR",
+		LogMsg: "Target user holds a role the operator lacks",
+		Fields: []zap.Field{zap.String("component", "auth")},
+	}
+
+	ErrSelfLock = &AppError{
+		Code:   "SELF_LOCK_ERROR",
+		LogMsg: "Operator tried to lock their own account",
+		Fields: []zap.Field{zap.String("component", "auth")},
+	}
+
+	ErrAccountLocked = &AppError{
+		Code:   "ACCOUNT_LOCKED_ERROR",
+		LogMsg: "Account is locked",
+		Fields: []zap.Field{zap.String("component", "auth")},
+	}
+
+	ErrStepUpRequired = &AppError{
+		Code:   "STEP_UP_REQUIRED_ERROR",
+		LogMsg: "Session has no recent user verification",
+		Fields: []zap.Field{zap.String("component", "auth")},
+	}
+
+	ErrDeviceBoundRequired = &AppError{
+		Code:   "DEVICE_BOUND_REQUIRED_ERROR",
+		LogMsg: "Backup eligible credential rejected by the backup policy",
+		Fields: []zap.Field{zap.String("component", "auth")},
+	}
+
+	ErrCredentialAlgorithm = &AppError{
+		Code:   "CREDENTIAL_ALGORITHM_ERROR",
+		LogMsg: "Credential algorithm rejected by the tenant policy",
+		Fields: []zap.Field{zap.String("component", "auth")},
+	}
+
+	ErrInvalidPassword = &AppError{
+		Code:   "INVALID_PASSWORD_ERROR",
+		LogMsg: "Password sign-in with unknown username or wrong password",
+		Fields: []zap.Field{zap.String("component", "auth")},
+	}
+
+	ErrPasswordLoginDisabled = &AppError{
+		Code:   "PASSWORD_LOGIN_DISABLED_ERROR",
+		LogMsg: "Password sign-in is disabled for the user",
+		Fields: []zap.Field{zap.String("component", "auth")},
+	}
+
+	ErrPasskeyRequired = &AppError{
+		Code:   "PASSKEY_REQUIRED_ERROR",
+		LogMsg: "Password sign-in cannot be disabled without a passkey",
+		Fields: []zap.Field{zap.String("component", "auth")},
+	}
+
+	ErrTooManyAttempts = &AppError{
+		Code:   "TOO_MANY_ATTEMPTS_ERROR",
+		LogMsg: "Too many password sign-in attempts",
+		Fields: []zap.Field{zap.String("component", "auth")},
+	}
+
+	ErrCSRF = &AppError{
+		Code:   "CSRF_ERROR",
+		LogMsg: "CSRF validation failed",
+		Fields: []zap.Field{zap.String("component", "auth")},
+	}
+
 	// Database Errors
 	ErrUserNotFound = &AppError{
 		Code:   "USER_NOT_FOUND_ERROR",
@@ -120,6 +241,49 @@ var (
 		Fields: []zap.Field{zap.String("component", "database")},
 	}
 
+	ErrUsernameTaken = &AppError{
+		Code:   "USERNAME_TAKEN_ERROR",
+		LogMsg: "Username is already used by another user",
+		Fields: []zap.Field{zap.String("component", "database")},
+	}
+
+	ErrEmailTaken = &AppError{
+		Code:   "EMAIL_TAKEN_ERROR",
+		LogMsg: "Email is already used by another user",
+		Fields: []zap.Field{zap.String("component", "database")},
+	}
+
+	ErrCredentialNotFound = &AppError{
+		Code:   "CREDENTIAL_NOT_FOUND_ERROR",
+		LogMsg: "Credential not found in database",
+		Fields: []zap.Field{zap.String("component", "database")},
+	}
+
+	ErrChallengeNotFound = &AppError{
+		Code:   "CHALLENGE_NOT_FOUND_ERROR",
+		LogMsg: "Challenge expired or already used",
+		Fields: []zap.Field{zap.String("component", "redis")},
+	}
+
+	ErrTransactionNotFound = &AppError{
+		Code:   "TRANSACTION_NOT_FOUND_ERROR",
+		LogMsg: "Transaction not found or not approved",
+		Fields: []zap.Field{zap.String("component", "database")},
+	}
+
+	ErrTransactionInvalid = &AppError{
+		Code:   "TRANSACTION_INVALID_ERROR",
+		LogMsg: "Transaction request is invalid",
+		Fields: []zap.Field{zap.String("component", "validation")},
+	}
+
+	// Tenant Errors
+	ErrUnknownTenant = &AppError{
+		Code:   "UNKNOWN_TENANT_ERROR",
+		LogMsg: "No tenant serves the requested host",
+		Fields: []zap.Field{zap.String("component", "tenant")},
+	}
+
 	ErrDatabaseQuery = &AppError{
 		Code:   "DATABASE_QUERY_ERROR",
 		LogMsg: "Database query failed",
@@ -245,6 +409,180 @@ func DisplayNameValidationError(err error) *AppError {
 	return &newErr
 }
 
+// EmailValidationError creates an email validation error
+func EmailValidationError(err error) *AppError {
+	newErr := *ErrEmailValidation // copy
+	newErr.Err = err
+	return &newErr
+}
+
+// RoleValidationError creates a role validation error
+func RoleValidationError(err error) *AppError {
+	newErr := *ErrRoleValidation // copy
+	newErr.Err = err
+	return &newErr
+}
+
+// ExtensionValidationError creates an error for extension inputs a login options request
+// cannot have
+func ExtensionValidationError(err error) *AppError {
+	newErr := *ErrExtensionValidation // copy
+	newErr.Err = err
+	return &newErr
+}
+
+// RegistrationProfileError creates an error for a registration profile the tenant does not offer
+func RegistrationProfileError(profile string) *AppError {
+	newErr := *ErrRegistrationProfile // copy
+	newErr.Fields = append(newErr.Fields, zap.String("profile", profile))
+	return &newErr
+}
+
+// UnauthenticatedError creates an error for a request without a valid session
+func UnauthenticatedError(err error) *AppError {
+	newErr := *ErrUnauthenticated // copy
+	newErr.Err = err
+	return &newErr
+}
+
+// ForbiddenError creates an error for a session that lacks every required role
+func ForbiddenError(userID string, required []string) *AppError {
+	newErr := *ErrForbidden // copy
+	newErr.Fields = append(newErr.Fields, zap.String("user_id", userID), zap.Strings("required_roles", required))
+	return &newErr
+}
+
+// TargetPrivilegedError creates an error for an admin action on a user holding a role the
+// operator lacks
+func TargetPrivilegedError(operatorID, userID string) *AppError {
+	newErr := *ErrTargetPrivileged // copy
+	newErr.Fields = append(newErr.Fields, zap.String("operator_id", operatorID), zap.String("user_id", userID))
+	return &newErr
+}
+
+// SelfLockError creates an error for an operator locking their own account
+func SelfLockError(userID string) *AppError {
+	newErr := *ErrSelfLock // copy
+	newErr.Fields = append(newErr.Fields, zap.String("user_id", userID))
+	return &newErr
+}
+
+// AccountLockedError creates an error for a locked account
+func AccountLockedError(userID string) *AppError {
+	newErr := *ErrAccountLocked // copy
+	newErr.Fields = append(newErr.Fields, zap.String("user_id", userID))
+	return &newErr
+}
+
+// InvalidPasswordError creates an error for a password sign-in that failed, whether the
+// user does not exist or the password is wrong
+func InvalidPasswordError(username string) *AppError {
+	newErr := *ErrInvalidPassword // copy
+	newErr.Fields = append(newErr.Fields, zap.String("username", username))
+	return &newErr
+}
+
+// PasswordLoginDisabledError creates an error for a password sign-in of a user who turned it off
+func PasswordLoginDisabledError(userID string) *AppError {
+	newErr := *ErrPasswordLoginDisabled // copy
+	newErr.Fields = append(newErr.Fields, zap.String("user_id", userID))
+	return &newErr
+}
+
+// PasskeyRequiredError creates an error for disabling password sign-in of a user without a passkey
+func PasskeyRequiredError(userID string) *AppError {
+	newErr := *ErrPasskeyRequired // copy
+	newErr.Fields = append(newErr.Fields, zap.String("user_id", userID))
+	return &newErr
+}
+
+// TooManyAttemptsError creates an error for a password sign-in over the attempt limit of
+// the username from the client IP
+func TooManyAttemptsError(username, ip string) *AppError {
+	newErr := *ErrTooManyAttempts // copy
+	newErr.Fields = append(newErr.Fields, zap.String("username", username), zap.String("client_ip", ip))
+	return &newErr
+}
+
+// CSRFError creates an error for a state-changing request that failed the CSRF checks
+func CSRFError(err error) *AppError {
+	newErr := *ErrCSRF // copy
+	newErr.Err = err
+	return &newErr
+}
+
+// CredentialNotFoundError creates a credential not found error
+func CredentialNotFoundError(operation string) *AppError {
+	newErr := *ErrCredentialNotFound // copy
+	newErr.Fields = append(newErr.Fields, zap.String("operation", operation))
+	return &newErr
+}
+
+// StepUpRequiredError creates an error for a session whose last user verification is too old
+func StepUpRequiredError(userID string) *AppError {
+	newErr := *ErrStepUpRequired // copy
+	newErr.Fields = append(newErr.Fields, zap.String("user_id", userID))
+	return &newErr
+}
+
+// DeviceBoundRequiredError creates an error for a synced or syncable credential of a user
+// whose roles require device-bound credentials
+func DeviceBoundRequiredError(userID, credentialID string) *AppError {
+	newErr := *ErrDeviceBoundRequired // copy
+	newErr.Fields = append(newErr.Fields, zap.String("user_id", userID), zap.String("credential_id", credentialID))
+	return &newErr
+}
+
+// CredentialAlgorithmError creates an error for a credential whose public key uses an
+// algorithm outside the policy of the tenant
+func CredentialAlgorithmError(credentialID string, algorithm int64) *AppError {
+	newErr := *ErrCredentialAlgorithm // copy
+	newErr.Fields = append(newErr.Fields, zap.String("credential_id", credentialID), zap.Int64("algorithm", algorithm))
+	return &newErr
+}
+
+// UsernameTakenError creates an error for a username another user of the tenant already has
+func UsernameTakenError(err error) *AppError {
+	newErr := *ErrUsernameTaken // copy
+	newErr.Err = err
+	return &newErr
+}
+
+// EmailTakenError creates an error for an email another user of the tenant already has
+func EmailTakenError(err error) *AppError {
+	newErr := *ErrEmailTaken // copy
+	newErr.Err = err
+	return &newErr
+}
+
+// TransactionNotFoundError creates an error for a transaction without a stored proof
+func TransactionNotFoundError(err error) *AppError {
+	newErr := *ErrTransactionNotFound // copy
+	newErr.Err = err
+	return &newErr
+}
+
+// TransactionInvalidError creates an error for a transaction request that fails validation
+func TransactionInvalidError(err error) *AppError {
+	newErr := *ErrTransactionInvalid // copy
+	newErr.Err = err
+	return &newErr
+}
+
+// UnknownTenantError creates an error for a request to a host no tenant serves
+func UnknownTenantError(host string) *AppError {
+	newErr := *ErrUnknownTenant // copy
+	newErr.Fields = append(newErr.Fields, zap.String("host", host))
+	return &newErr
+}
+
+// ChallengeNotFoundError creates an error for a single-use challenge that expired or was already answered
+func ChallengeNotFoundError(err error) *AppError {
+	newErr := *ErrChallengeNotFound // copy
+	newErr.Err = err
+	return &newErr
+}
+
 // UserNotFoundError creates a user not found error
 func UserNotFoundError(err error, operation string) *AppError {
 	newErr := *ErrUserNotFound // copy
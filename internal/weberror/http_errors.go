@@ -26,6 +26,10 @@ func (h *HTTPError) Unwrap() error {
 	return h.AppErr
 }
 
+// ErrorCodeKey is the request user value holding the code of the application error
+// a request failed with, for the access log.
+const ErrorCodeKey = "error_code"
+
 // RespondAndLog sets the HTTP response and logs the application error
 func (h *HTTPError) RespondAndLog(ctx *fasthttp.RequestCtx) {
 	// Set HTTP response
@@ -35,7 +39,8 @@ func (h *HTTPError) RespondAndLog(ctx *fasthttp.RequestCtx) {
 
 	// Log the application error if present
 	if h.AppErr != nil {
-		h.AppErr.Log()
+		ctx.SetUserValue(ErrorCodeKey, h.AppErr.Code)
+		h.AppErr.LogCtx(ctx)
 	}
 }
 
@@ -104,6 +109,13 @@ func ToHTTPError(appErr *AppError) *HTTPError {
 			appErr,
 		)
 
+	case "NO_CREDENTIALS_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusNotFound,
+			`{"error": "No credentials registered"}`,
+			appErr,
+		)
+
 	case "USER_NOT_FOUND_ERROR":
 		return NewHTTPError(
 			fasthttp.StatusNotFound,
@@ -111,6 +123,174 @@ func ToHTTPError(appErr *AppError) *HTTPError {
 			appErr,
 		)
 
+	case "CREDENTIAL_NOT_FOUND_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusNotFound,
+			`{"error": "Credential not found"}`,
+			appErr,
+		)
+
+	case "CHALLENGE_NOT_FOUND_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusBadRequest,
+			`{"error": "Challenge expired or already used"}`,
+			appErr,
+		)
+
+	case "TRANSACTION_NOT_FOUND_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusNotFound,
+			`{"error": "Transaction not found"}`,
+			appErr,
+		)
+
+	case "TRANSACTION_INVALID_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusBadRequest,
+			`{"error": "Invalid transaction"}`,
+			appErr,
+		)
+
+	case "UNKNOWN_TENANT_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusNotFound,
+			`{"error": "Unknown host"}`,
+			appErr,
+		)
+
+	case "EMAIL_VALIDATION_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusBadRequest,
+			`{"error": "Invalid email"}`,
+			appErr,
+		)
+
+	case "USERNAME_TAKEN_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusConflict,
+			`{"error": "Username already in use"}`,
+			appErr,
+		)
+
+	case "EMAIL_TAKEN_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusConflict,
+			`{"error": "Email already in use"}`,
+			appErr,
+		)
+
+	case "ROLE_VALIDATION_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusBadRequest,
+			`{"error": "Unknown role"}`,
+			appErr,
+		)
+
+	case "EXTENSION_VALIDATION_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusBadRequest,
+			`{"error": "Invalid extension request"}`,
+			appErr,
+		)
+
+	case "REGISTRATION_PROFILE_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusBadRequest,
+			`{"error": "Unknown registration profile"}`,
+			appErr,
+		)
+
+	case "UNAUTHENTICATED_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusUnauthorized,
+			`{"error": "Authentication required"}`,
+			appErr,
+		)
+
+	case "INVALID_PASSWORD_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusUnauthorized,
+			`{"error": "Invalid username or password"}`,
+			appErr,
+		)
+
+	case "FORBIDDEN_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusForbidden,
+			`{"error": "Forbidden"}`,
+			appErr,
+		)
+
+	case "TARGET_PRIVILEGED_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusForbidden,
+			`{"error": "User holds a role you lack"}`,
+			appErr,
+		)
+
+	case "SELF_LOCK_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusForbidden,
+			`{"error": "You cannot lock your own account"}`,
+			appErr,
+		)
+
+	case "ACCOUNT_LOCKED_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusForbidden,
+			`{"error": "Account is locked"}`,
+			appErr,
+		)
+
+	case "STEP_UP_REQUIRED_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusForbidden,
+			`{"error": "Step-up authentication required"}`,
+			appErr,
+		)
+
+	case "DEVICE_BOUND_REQUIRED_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusForbidden,
+			`{"error": "A device-bound credential is required"}`,
+			appErr,
+		)
+
+	case "CREDENTIAL_ALGORITHM_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusForbidden,
+			`{"error": "Credential algorithm not allowed"}`,
+			appErr,
+		)
+
+	case "PASSWORD_LOGIN_DISABLED_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusForbidden,
+			`{"error": "Password sign-in is disabled, sign in with a passkey"}`,
+			appErr,
+		)
+
+	case "PASSKEY_REQUIRED_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusConflict,
+			`{"error": "Enroll a passkey before disabling password sign-in"}`,
+			appErr,
+		)
+
+	case "CSRF_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusForbidden,
+			`{"error": "CSRF validation failed"}`,
+			appErr,
+		)
+
+	case "TOO_MANY_ATTEMPTS_ERROR":
+		return NewHTTPError(
+			fasthttp.StatusTooManyRequests,
+			`{"error": "Too many sign-in attempts, try again later"}`,
+			appErr,
+		)
+
 	// Server errors (5xx)
 	case "CREDENTIAL_ID_DECODE_ERROR":
 		return NewHTTPError(
@@ -1,17 +1,30 @@
 // Package main is the entry point for the WebAuthn example application.
 // It initializes the logger, loads environment variables, sets up database
 // and Redis connections, and starts the HTTP server with the defined routes.
+// Subcommands (see commands.go) reuse the same setup for operational tasks.
 package main
 
 import (
+	"crypto/tls"
 	"database/sql"
+	"fmt"
+	"net"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	// Import without alias
 	"context"
 
 	"github.com/go-redis/redis/v8" // Import Redis package
-	"github.com/jamesyang124/webauthn-example/internal/util"
+	"github.com/jamesyang124/webauthn-example/internal/aaguid"
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/jamesyang124/webauthn-example/internal/health"
+	"github.com/jamesyang124/webauthn-example/internal/logging"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/tlscert"
+	"github.com/jamesyang124/webauthn-example/middlewares"
 	"github.com/jamesyang124/webauthn-example/types"
 	"github.com/joho/godotenv" // Import godotenv package
 	_ "github.com/lib/pq"      // Import PostgreSQL driver
@@ -20,9 +33,44 @@ import (
 )
 
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the subcommand named by args, defaulting to serve, and returns the exit code.
+func run(args []string) int {
+
+	// Bootstrap logger until the configuration in .env is loaded
+	bootstrap, _ := zap.NewDevelopment()
+	zap.ReplaceGlobals(bootstrap)
+
+	if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		fmt.Print(usage)
+		return 0
+	}
+
+	// Proofs are verified without any configuration, on the machine of the auditor
+	if len(args) > 0 && args[0] == "verify-proof" {
+		return runVerifyProof(args[1:])
+	}
+
+	// Load environment variables from .env file
+	err := godotenv.Load()
+	if err != nil {
+		zap.L().Error("Error loading .env file", zap.Error(err))
+		return 1
+	}
 
-	// Initialize zap logger
-	logger, _ := zap.NewDevelopment()
+	// Initialize zap logger from LOG_MODE, LOG_FORMAT, LOG_LEVEL and LOG_LEVELS
+	logConfig, err := logging.LoadConfig()
+	if err != nil {
+		zap.L().Error("Invalid logging configuration", zap.Error(err))
+		return 1
+	}
+	logger, err := logging.New(logConfig)
+	if err != nil {
+		zap.L().Error("Failed to build logger", zap.Error(err))
+		return 1
+	}
 	zap.ReplaceGlobals(logger)
 	defer func() {
 		if err := logger.Sync(); err != nil {
@@ -30,31 +78,63 @@ func main() {
 		}
 	}()
 
-	// Load environment variables from .env file
-	err := godotenv.Load()
+	if len(args) > 0 && args[0] != "serve" {
+		return runCommand(args)
+	}
+	return serve()
+}
+
+// openDatabase opens the PostgreSQL connection pool configured by DATABASE_URL.
+func openDatabase() (*sql.DB, error) {
+	connStr := os.Getenv("DATABASE_URL")
+	return sql.Open("postgres", connStr)
+}
+
+// openRedis creates the Redis client configured by REDIS_URL.
+func openRedis() *redis.Client {
+	redisAddr := os.Getenv("REDIS_URL")
+	return redis.NewClient(&redis.Options{
+		Addr: redisAddr,
+	})
+}
+
+func serve() int {
+	cfg, err := config.Load()
 	if err != nil {
-		zap.L().Error("Error loading .env file", zap.Error(err))
-		return
+		zap.L().Error("Invalid configuration", zap.Error(err))
+		return 1
 	}
 
+	// Stop on SIGINT/SIGTERM; the same context cancels the startup retries
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize database connection
-	connStr := os.Getenv("DATABASE_URL")
-	db, err := sql.Open("postgres", connStr)
+	db, err := openDatabase()
 	if err != nil {
 		zap.L().Error("Failed to connect to database", zap.Error(err))
-		return
+		return 1
 	}
 	defer func() {
 		if err := db.Close(); err != nil {
 			zap.L().Error("Error closing database", zap.Error(err))
 		}
 	}()
+	if err := waitFor(ctx, cfg.Server, "database", db.PingContext); err != nil {
+		zap.L().Error("Failed to connect to database", zap.Error(err))
+		return 1
+	}
+
+	// Apply pending migrations when asked to; the advisory lock serializes concurrent starts
+	if os.Getenv("MIGRATE_ON_START") == "true" {
+		if _, err := migrateUp(ctx, db); err != nil {
+			zap.L().Error("Failed to apply migrations", zap.Error(err))
+			return 1
+		}
+	}
 
 	// Initialize Redis client
-	redisAddr := os.Getenv("REDIS_URL")
-	redisClient := redis.NewClient(&redis.Options{
-		Addr: redisAddr,
-	})
+	redisClient := openRedis()
 	defer func() {
 		if err := redisClient.Close(); err != nil {
 			zap.L().Error("Error closing redis client", zap.Error(err))
@@ -62,30 +142,111 @@ func main() {
 	}()
 
 	// Test Redis connection
-	ctx := context.Background()
-	_, err = redisClient.Ping(ctx).Result()
-	if err != nil {
+	if err := waitFor(ctx, cfg.Server, "redis", func(ctx context.Context) error {
+		return redisClient.Ping(ctx).Err()
+	}); err != nil {
 		zap.L().Error("Failed to connect to Redis", zap.Error(err))
-		return
+		return 1
 	}
 
 	presistance := new(types.Persistance)
 	presistance.Db = db
 	presistance.Cache = redisClient
 
-	util.InitWebAuthn()
+	tenants, err := tenant.NewRegistry(cfg.Tenants)
+	if err != nil {
+		zap.L().Error("Failed to create WebAuthn relying parties", zap.Error(err))
+		return 1
+	}
+
+	if err := aaguid.Load(cfg.Authenticators); err != nil {
+		zap.L().Error("Failed to load authenticator metadata", zap.Error(err))
+		return 1
+	}
 
 	// Pass presistance to PrepareRoutes
-	routesHandler := PrepareRoutes(presistance)
+	routesHandler := PrepareRoutes(presistance, cfg, tenants)
 
 	// Start the server
-	zap.L().Info("Starting server on :8080")
 	fasthttpServer := &fasthttp.Server{
-		Logger:  nil,
+		Logger:  logging.PrintfLogger("fasthttp"),
 		Handler: routesHandler,
 	}
+	listener, err := net.Listen("tcp", cfg.Server.Addr)
+	if err != nil {
+		zap.L().Error("Failed to listen", zap.String("addr", cfg.Server.Addr), zap.Error(err))
+		return 1
+	}
+	if cfg.TLS.Enabled() {
+		reloader, err := tlscert.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			zap.L().Error("Failed to load TLS certificate", zap.Error(err))
+			if err := listener.Close(); err != nil {
+				zap.L().Error("Error closing listener", zap.Error(err))
+			}
+			return 1
+		}
+		go reloader.Watch(ctx, cfg.TLS.ReloadInterval)
+		listener = tls.NewListener(listener, tlscert.ServerConfig(cfg.TLS, reloader))
+	}
+	zap.L().Info("Starting server", zap.String("addr", cfg.Server.Addr), zap.Bool("tls", cfg.TLS.Enabled()))
 
-	if err := fasthttpServer.ListenAndServe(":8080"); err != nil {
+	serveErr := make(chan error, 2)
+	go func() {
+		serveErr <- fasthttpServer.Serve(listener)
+	}()
+
+	var redirectServer *fasthttp.Server
+	if cfg.TLS.RedirectAddr != "" {
+		redirectServer = &fasthttp.Server{
+			Logger:  logging.PrintfLogger("fasthttp"),
+			Handler: middlewares.RequestID(middlewares.HTTPSRedirect(cfg.Server.Addr)),
+		}
+		zap.L().Info("Redirecting HTTP to HTTPS", zap.String("addr", cfg.TLS.RedirectAddr))
+		go func() {
+			serveErr <- redirectServer.ListenAndServe(cfg.TLS.RedirectAddr)
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
 		zap.L().Error("Error in ListenAndServe", zap.Error(err))
+		return 1
+	case <-ctx.Done():
+	}
+
+	// Fail readiness first and keep serving until load balancers stop sending traffic,
+	// then drain
+	zap.L().Info("Shutting down server",
+		zap.Duration("drain_delay", cfg.Server.DrainDelay),
+		zap.Duration("timeout", cfg.Server.ShutdownTimeout))
+	health.StartDraining()
+	time.Sleep(cfg.Server.DrainDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if redirectServer != nil {
+		// Redirects are answered immediately; the API server gets the rest of the timeout
+		if err := redirectServer.ShutdownWithContext(shutdownCtx); err != nil {
+			zap.L().Warn("Redirect server did not stop cleanly", zap.Error(err))
+		}
 	}
+	if err := fasthttpServer.ShutdownWithContext(shutdownCtx); err != nil {
+		zap.L().Error("Server did not drain before the shutdown timeout", zap.Error(err))
+		return 1
+	}
+	zap.L().Info("Server stopped")
+	return 0
+}
+
+// waitFor retries check with backoff until the dependency is reachable.
+func waitFor(ctx context.Context, server config.Server, name string, check func(ctx context.Context) error) error {
+	return health.Retry(ctx, server.StartupAttempts, server.StartupMaxBackoff, check,
+		func(attempt int, wait time.Duration, err error) {
+			zap.L().Warn("Dependency not reachable yet, retrying",
+				zap.String("dependency", name),
+				zap.Int("attempt", attempt),
+				zap.Duration("wait", wait),
+				zap.Error(err),
+			)
+		})
 }
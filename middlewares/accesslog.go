@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/jamesyang124/webauthn-example/internal/clientip"
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/jamesyang124/webauthn-example/internal/logging"
+	"github.com/jamesyang124/webauthn-example/internal/session"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// AccessLog logs one entry per request once it is handled. Requests that failed, with
+// a status of 400 or more or an application error, are always logged; successful ones
+// are sampled at cfg.SampleRate. The route is the template registered with the router,
+// so that entries of /users/{userId} group together; it needs SaveMatchedRoutePath.
+func AccessLog(cfg config.AccessLog) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			start := time.Now()
+			next(ctx)
+			latency := time.Since(start)
+
+			status := ctx.Response.StatusCode()
+			errorCode, _ := ctx.UserValue(weberror.ErrorCodeKey).(string)
+			failed := status >= fasthttp.StatusBadRequest || errorCode != ""
+			if !failed && (cfg.SampleRate <= 0 || cfg.SampleRate < 1 && rand.Float64() >= cfg.SampleRate) {
+				return
+			}
+
+			route, _ := ctx.UserValue(router.MatchedRoutePathParam).(string)
+			if route == "" {
+				route = "unmatched"
+			}
+			userID, _ := ctx.UserValue(session.UserIDKey).(string)
+			tenantID := ""
+			if t := tenant.From(ctx); t != nil {
+				tenantID = t.ID
+			}
+
+			level := zapcore.InfoLevel
+			switch {
+			case status >= fasthttp.StatusInternalServerError:
+				level = zapcore.ErrorLevel
+			case failed:
+				level = zapcore.WarnLevel
+			}
+			logging.WithRequest(ctx, logging.L("access")).Log(level, "request",
+				zap.String("method", string(ctx.Method())),
+				zap.String("route", route),
+				zap.Int("status", status),
+				zap.Duration("latency", latency),
+				zap.Int("bytes", responseSize(ctx)),
+				zap.String("client_ip", clientip.IP(ctx)),
+				zap.String("user_agent", string(ctx.UserAgent())),
+				zap.String("tenant", tenantID),
+				zap.String("user_id", userID),
+				zap.String("error_code", errorCode),
+			)
+		}
+	}
+}
+
+// responseSize returns the size of the response body without reading streamed bodies,
+// such as files, whose size is then taken from Content-Length.
+func responseSize(ctx *fasthttp.RequestCtx) int {
+	if ctx.Response.IsBodyStream() {
+		return max(ctx.Response.Header.ContentLength(), 0)
+	}
+	return len(ctx.Response.Body())
+}
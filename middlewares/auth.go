@@ -0,0 +1,110 @@
+package middlewares
+
+import (
+	"time"
+
+	"github.com/jamesyang124/webauthn-example/internal/session"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/user"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/jamesyang124/webauthn-example/types"
+	"github.com/valyala/fasthttp"
+)
+
+// AuthSessionKey is the request user value under which RequireRoles, RequireSession and
+// RequireRecentUV store the *types.AuthSession of the caller.
+const AuthSessionKey = "auth_session"
+
+// RolesKey is the request user value under which RequireRoles stores the roles the caller
+// held when the request was let through.
+const RolesKey = "auth_roles"
+
+// RequireRoles only lets requests through whose session belongs to an unlocked user
+// holding at least one of roles. Roles are re-read on every request so that revoking
+// a role or locking the account takes effect immediately.
+func RequireRoles(persistance *types.Persistance, roles ...string) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			authSession, err := session.GetAuthSession(ctx, persistance.Cache)
+			if err != nil {
+				respondAppError(ctx, err)
+				return
+			}
+
+			var granted []string
+			var locked bool
+			if _, err := user.QueryUserAccess(persistance.Db, tenant.From(ctx).ID, authSession.UserID, &granted, &locked); err != nil {
+				respondAppError(ctx, err)
+				return
+			}
+			if locked {
+				respondAppError(ctx, weberror.AccountLockedError(authSession.UserID))
+				return
+			}
+			if !user.HasAnyRole(granted, roles...) {
+				respondAppError(ctx, weberror.ForbiddenError(authSession.UserID, roles))
+				return
+			}
+
+			ctx.SetUserValue(AuthSessionKey, authSession)
+			ctx.SetUserValue(RolesKey, granted)
+			next(ctx)
+		}
+	}
+}
+
+// RequireSession only lets requests through whose session belongs to an unlocked user,
+// however they signed in.
+func RequireSession(persistance *types.Persistance) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			authSession, err := session.GetAuthSession(ctx, persistance.Cache)
+			if err != nil {
+				respondAppError(ctx, err)
+				return
+			}
+			if _, err := user.EnsureUserNotLocked(persistance.Db, tenant.From(ctx).ID, authSession.UserID); err != nil {
+				respondAppError(ctx, err)
+				return
+			}
+
+			ctx.SetUserValue(AuthSessionKey, authSession)
+			next(ctx)
+		}
+	}
+}
+
+// RequireRecentUV only lets requests through whose session belongs to an unlocked user
+// who passed user verification within maxAge, at login or in a step-up ceremony. Other
+// sessions get a STEP_UP_REQUIRED_ERROR, telling the client to run the step-up ceremony
+// and retry.
+func RequireRecentUV(persistance *types.Persistance, maxAge time.Duration) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			authSession, err := session.GetAuthSession(ctx, persistance.Cache)
+			if err != nil {
+				respondAppError(ctx, err)
+				return
+			}
+			if _, err := user.EnsureUserNotLocked(persistance.Db, tenant.From(ctx).ID, authSession.UserID); err != nil {
+				respondAppError(ctx, err)
+				return
+			}
+			if authSession.UserVerifiedAt.IsZero() || time.Since(authSession.UserVerifiedAt) > maxAge {
+				respondAppError(ctx, weberror.StepUpRequiredError(authSession.UserID))
+				return
+			}
+
+			ctx.SetUserValue(AuthSessionKey, authSession)
+			next(ctx)
+		}
+	}
+}
+
+func respondAppError(ctx *fasthttp.RequestCtx, err error) {
+	appErr, ok := err.(*weberror.AppError)
+	if !ok {
+		appErr = weberror.UnexpectedError(err, "middleware")
+	}
+	weberror.ToHTTPError(appErr).RespondAndLog(ctx)
+}
@@ -0,0 +1,19 @@
+package middlewares
+
+import (
+	"github.com/jamesyang124/webauthn-example/internal/clientip"
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/valyala/fasthttp"
+)
+
+// ClientIP resolves the client address and scheme of every request once, for
+// clientip.IP and clientip.Scheme in the middlewares and handlers after it.
+func ClientIP(cfg config.Proxy) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	resolver := clientip.NewResolver(cfg)
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			resolver.Store(ctx)
+			next(ctx)
+		}
+	}
+}
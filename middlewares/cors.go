@@ -1,17 +1,167 @@
 // Package middlewares provides HTTP middleware utilities for the WebAuthn example application.
 package middlewares
 
-import "github.com/valyala/fasthttp"
-
-func CorsMiddleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
-	return func(ctx *fasthttp.RequestCtx) {
-		ctx.Response.Header.Set("Access-Control-Allow-Origin", "*")
-		ctx.Response.Header.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		ctx.Response.Header.Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		if string(ctx.Method()) == fasthttp.MethodOptions {
-			ctx.SetStatusCode(fasthttp.StatusOK)
-			return
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/valyala/fasthttp"
+)
+
+// corsMethods are the methods the API is served with. CorsMiddleware adds any other
+// method the router serves, so that a new route cannot fail its preflight.
+var corsMethods = []string{
+	fasthttp.MethodGet, fasthttp.MethodPost, fasthttp.MethodPut, fasthttp.MethodDelete, fasthttp.MethodOptions,
+}
+
+// allowedMethods returns corsMethods followed by the other routed methods, sorted.
+func allowedMethods(routed []string) []string {
+	methods := append([]string{}, corsMethods...)
+	known := map[string]bool{}
+	for _, method := range methods {
+		known[method] = true
+	}
+	extra := []string{}
+	for _, method := range routed {
+		if !known[method] {
+			known[method] = true
+			extra = append(extra, method)
+		}
+	}
+	sort.Strings(extra)
+	return append(methods, extra...)
+}
+
+// corsPolicy is the precomputed form of config.CORS.
+type corsPolicy struct {
+	exact          map[string]bool
+	wildcards      []originPattern
+	allowedMethods map[string]bool
+	allowedHeaders map[string]bool
+	allowMethods   string
+	allowHeaders   string
+	exposeHeaders  string
+	maxAge         string
+}
+
+// originPattern matches https://*.example.com style origins: any subdomain of suffix,
+// with the same scheme and port, but not the bare domain.
+type originPattern struct {
+	scheme string
+	suffix string
+}
+
+func (p originPattern) matches(origin string) bool {
+	rest, ok := strings.CutPrefix(origin, p.scheme+"://")
+	if !ok {
+		return false
+	}
+	sub, ok := strings.CutSuffix(rest, p.suffix)
+	return ok && sub != "" && !strings.HasSuffix(sub, ".") && !strings.ContainsAny(sub, ":/")
+}
+
+func newCorsPolicy(cfg config.CORS, routed []string) *corsPolicy {
+	methods := allowedMethods(routed)
+	policy := &corsPolicy{
+		exact:          map[string]bool{},
+		allowedMethods: map[string]bool{},
+		allowedHeaders: map[string]bool{},
+		allowMethods:   strings.Join(methods, ", "),
+		allowHeaders:   strings.Join(cfg.AllowedHeaders, ", "),
+		exposeHeaders:  strings.Join(cfg.ExposedHeaders, ", "),
+		maxAge:         strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if scheme, host, ok := strings.Cut(origin, "://*"); ok {
+			policy.wildcards = append(policy.wildcards, originPattern{scheme: scheme, suffix: host})
+			continue
+		}
+		policy.exact[origin] = true
+	}
+	for _, method := range methods {
+		policy.allowedMethods[method] = true
+	}
+	for _, header := range cfg.AllowedHeaders {
+		policy.allowedHeaders[strings.ToLower(header)] = true
+	}
+	return policy
+}
+
+func (p *corsPolicy) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.exact[origin] {
+		return true
+	}
+	for _, pattern := range p.wildcards {
+		if pattern.matches(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) allowsPreflight(method, headers string) bool {
+	if !p.allowedMethods[method] {
+		return false
+	}
+	for _, header := range strings.Split(headers, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header != "" && !p.allowedHeaders[header] {
+			return false
+		}
+	}
+	return true
+}
+
+// CorsMiddleware applies the CORS policy. Allowed origins are echoed back together with
+// Access-Control-Allow-Credentials so that the session cookie can be sent; other origins
+// get no CORS headers, and their preflight requests are rejected with 403. routed are
+// the methods the router serves, which preflights may ask for.
+func CorsMiddleware(cfg config.CORS, routed []string) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	policy := newCorsPolicy(cfg, routed)
+
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			// Responses differ per origin, so shared caches must key on it
+			ctx.Response.Header.Add("Vary", "Origin")
+
+			origin := string(ctx.Request.Header.Peek("Origin"))
+			requestMethod := string(ctx.Request.Header.Peek("Access-Control-Request-Method"))
+			preflight := ctx.IsOptions() && origin != "" && requestMethod != ""
+
+			if origin == "" || !policy.allowsOrigin(origin) {
+				if preflight {
+					ctx.SetStatusCode(fasthttp.StatusForbidden)
+					return
+				}
+				next(ctx)
+				return
+			}
+
+			ctx.Response.Header.Set("Access-Control-Allow-Origin", origin)
+			ctx.Response.Header.Set("Access-Control-Allow-Credentials", "true")
+
+			if preflight {
+				requestHeaders := string(ctx.Request.Header.Peek("Access-Control-Request-Headers"))
+				if !policy.allowsPreflight(requestMethod, requestHeaders) {
+					ctx.SetStatusCode(fasthttp.StatusForbidden)
+					return
+				}
+				ctx.Response.Header.Add("Vary", "Access-Control-Request-Method")
+				ctx.Response.Header.Add("Vary", "Access-Control-Request-Headers")
+				ctx.Response.Header.Set("Access-Control-Allow-Methods", policy.allowMethods)
+				ctx.Response.Header.Set("Access-Control-Allow-Headers", policy.allowHeaders)
+				ctx.Response.Header.Set("Access-Control-Max-Age", policy.maxAge)
+				ctx.SetStatusCode(fasthttp.StatusNoContent)
+				return
+			}
+
+			if policy.exposeHeaders != "" {
+				ctx.Response.Header.Set("Access-Control-Expose-Headers", policy.exposeHeaders)
+			}
+			next(ctx)
 		}
-		next(ctx)
 	}
 }
@@ -0,0 +1,100 @@
+package middlewares
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/valyala/fasthttp"
+)
+
+func TestCorsMiddleware(t *testing.T) {
+	cfg := config.CORS{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"},
+		AllowedHeaders: []string{"Content-Type", "X-CSRF-Token"},
+		MaxAge:         10 * time.Minute,
+	}
+	routed := []string{fasthttp.MethodGet, fasthttp.MethodPost, fasthttp.MethodPatch}
+
+	tests := []struct {
+		name           string
+		method         string
+		origin         string
+		requestMethod  string
+		requestHeaders string
+		wantStatus     int
+		wantAllowed    bool
+		wantNext       bool
+	}{
+		{"no origin", fasthttp.MethodGet, "", "", "", fasthttp.StatusOK, false, true},
+		{"exact origin", fasthttp.MethodPost, "https://app.example.com", "", "", fasthttp.StatusOK, true, true},
+		{"exact origin is case insensitive", fasthttp.MethodPost, "HTTPS://APP.EXAMPLE.COM", "", "", fasthttp.StatusOK, true, true},
+		{"unknown origin gets no CORS headers", fasthttp.MethodPost, "https://evil.example", "", "", fasthttp.StatusOK, false, true},
+		{"other scheme", fasthttp.MethodPost, "http://app.example.com", "", "", fasthttp.StatusOK, false, true},
+		{"wildcard subdomain", fasthttp.MethodGet, "https://a.example.org", "", "", fasthttp.StatusOK, true, true},
+		{"wildcard nested subdomain", fasthttp.MethodGet, "https://a.b.example.org", "", "", fasthttp.StatusOK, true, true},
+		{"wildcard excludes bare domain", fasthttp.MethodGet, "https://example.org", "", "", fasthttp.StatusOK, false, true},
+		{"wildcard excludes lookalike domain", fasthttp.MethodGet, "https://evilexample.org", "", "", fasthttp.StatusOK, false, true},
+		{"wildcard excludes other port", fasthttp.MethodGet, "https://a.example.org:8443", "", "", fasthttp.StatusOK, false, true},
+		{"wildcard excludes other scheme", fasthttp.MethodGet, "http://a.example.org", "", "", fasthttp.StatusOK, false, true},
+		{"preflight PUT", fasthttp.MethodOptions, "https://app.example.com", fasthttp.MethodPut, "content-type", fasthttp.StatusNoContent, true, false},
+		{"preflight DELETE", fasthttp.MethodOptions, "https://app.example.com", fasthttp.MethodDelete, "", fasthttp.StatusNoContent, true, false},
+		{"preflight routed PATCH", fasthttp.MethodOptions, "https://a.example.org", fasthttp.MethodPatch, "X-CSRF-Token", fasthttp.StatusNoContent, true, false},
+		{"preflight unrouted method", fasthttp.MethodOptions, "https://app.example.com", fasthttp.MethodTrace, "", fasthttp.StatusForbidden, true, false},
+		{"preflight unknown header", fasthttp.MethodOptions, "https://app.example.com", fasthttp.MethodPost, "X-Other", fasthttp.StatusForbidden, true, false},
+		{"preflight unknown origin", fasthttp.MethodOptions, "https://evil.example", fasthttp.MethodPost, "", fasthttp.StatusForbidden, false, false},
+		{"OPTIONS without request method is not a preflight", fasthttp.MethodOptions, "https://app.example.com", "", "", fasthttp.StatusOK, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := CorsMiddleware(cfg, routed)(func(ctx *fasthttp.RequestCtx) {
+				called = true
+			})
+
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Request.Header.SetMethod(tt.method)
+			if tt.origin != "" {
+				ctx.Request.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				ctx.Request.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			if tt.requestHeaders != "" {
+				ctx.Request.Header.Set("Access-Control-Request-Headers", tt.requestHeaders)
+			}
+			handler(ctx)
+
+			if got := ctx.Response.StatusCode(); got != tt.wantStatus {
+				t.Errorf("status = %d, want %d", got, tt.wantStatus)
+			}
+			if called != tt.wantNext {
+				t.Errorf("next called = %t, want %t", called, tt.wantNext)
+			}
+			allowOrigin := string(ctx.Response.Header.Peek("Access-Control-Allow-Origin"))
+			if tt.wantAllowed && allowOrigin != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", allowOrigin, tt.origin)
+			}
+			if !tt.wantAllowed && allowOrigin != "" {
+				t.Errorf("Access-Control-Allow-Origin = %q, want none", allowOrigin)
+			}
+		})
+	}
+}
+
+func TestAllowedMethods(t *testing.T) {
+	got := allowedMethods([]string{fasthttp.MethodPost, fasthttp.MethodPatch, fasthttp.MethodHead, fasthttp.MethodPatch})
+	want := []string{
+		fasthttp.MethodGet, fasthttp.MethodPost, fasthttp.MethodPut, fasthttp.MethodDelete, fasthttp.MethodOptions,
+		fasthttp.MethodHead, fasthttp.MethodPatch,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("allowedMethods = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("allowedMethods = %v, want %v", got, want)
+		}
+	}
+}
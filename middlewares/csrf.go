@@ -0,0 +1,141 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/valyala/fasthttp"
+)
+
+// CSRF token cookie and header of the double-submit check.
+const (
+	CSRFCookieName = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// CSRFProtection rejects state-changing requests (anything but GET, HEAD and OPTIONS)
+// whose Origin, or Referer when Origin is absent, is not an origin of the tenant of the
+// request (of any tenant when the host has none), and
+// requests whose X-CSRF-Token header does not match the csrf_token cookie. Paths in
+// exempt skip both checks; they must be protected otherwise, like the WebAuthn
+// ceremonies whose client data origin is verified by the library.
+func CSRFProtection(tenants *tenant.Registry, exempt map[string]bool) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	allOrigins := originSet(tenants.Origins())
+	tenantOrigins := map[string]map[string]bool{}
+	for _, t := range tenants.Tenants() {
+		tenantOrigins[t.ID] = originSet(t.RelyingParty.AllOrigins())
+	}
+
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			if isSafeMethod(ctx) || exempt[string(ctx.Path())] {
+				next(ctx)
+				return
+			}
+
+			origins := allOrigins
+			if t := tenant.From(ctx); t != nil {
+				origins = tenantOrigins[t.ID]
+			}
+			if origin, ok := requestOrigin(ctx); ok && !origins[origin] {
+				respondAppError(ctx, weberror.CSRFError(fmt.Errorf("origin %q is not allowed", origin)))
+				return
+			}
+
+			cookie := ctx.Request.Header.Cookie(CSRFCookieName)
+			header := ctx.Request.Header.Peek(CSRFHeaderName)
+			if len(cookie) == 0 || subtle.ConstantTimeCompare(cookie, header) != 1 {
+				respondAppError(ctx, weberror.CSRFError(fmt.Errorf("missing or mismatched %s", CSRFHeaderName)))
+				return
+			}
+
+			next(ctx)
+		}
+	}
+}
+
+func originSet(origins []string) map[string]bool {
+	set := map[string]bool{}
+	for _, origin := range origins {
+		set[origin] = true
+	}
+	return set
+}
+
+func isSafeMethod(ctx *fasthttp.RequestCtx) bool {
+	return ctx.IsGet() || ctx.IsHead() || ctx.IsOptions()
+}
+
+// requestOrigin returns the lower-cased origin named by the Origin header, or by the
+// Referer header when Origin is absent. ok is false when neither is sent, as with
+// non-browser clients, which are then only checked by the token.
+func requestOrigin(ctx *fasthttp.RequestCtx) (origin string, ok bool) {
+	if v := ctx.Request.Header.Peek("Origin"); len(v) > 0 {
+		return strings.ToLower(string(v)), true
+	}
+	v := ctx.Request.Header.Peek("Referer")
+	if len(v) == 0 {
+		return "", false
+	}
+	u, err := url.Parse(string(v))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		// An unparsable referrer cannot match any origin
+		return string(v), true
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), true
+}
+
+// fromRelatedOrigin reports whether the request comes from a related origin of its tenant.
+func fromRelatedOrigin(ctx *fasthttp.RequestCtx) bool {
+	t := tenant.From(ctx)
+	origin, ok := requestOrigin(ctx)
+	if t == nil || !ok {
+		return false
+	}
+	return originSet(t.RelyingParty.RelatedOrigins)[origin]
+}
+
+// CSRFTokenHandler returns the CSRF token in the response body, issuing a new csrf_token
+// cookie when the request has none. SPAs on another origin cannot read the cookie and
+// must take the token from the body. The cookie is SameSite=Strict, except for requests
+// from a related origin of the tenant: those are cross-site, and browsers only send a
+// SameSite=None cookie back to them.
+func CSRFTokenHandler(ctx *fasthttp.RequestCtx) {
+	token := string(ctx.Request.Header.Cookie(CSRFCookieName))
+	if token == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			respondAppError(ctx, weberror.UnexpectedError(err, "generate csrf token"))
+			return
+		}
+		token = base64.RawURLEncoding.EncodeToString(b)
+
+		cookie := fasthttp.AcquireCookie()
+		defer fasthttp.ReleaseCookie(cookie)
+		cookie.SetKey(CSRFCookieName)
+		cookie.SetValue(token)
+		cookie.SetPath("/")
+		cookie.SetSecure(true)
+		cookie.SetSameSite(fasthttp.CookieSameSiteStrictMode)
+		if fromRelatedOrigin(ctx) {
+			cookie.SetSameSite(fasthttp.CookieSameSiteNoneMode)
+		}
+		ctx.Response.Header.SetCookie(cookie)
+	}
+
+	response, err := json.Marshal(map[string]string{"csrfToken": token})
+	if err != nil {
+		respondAppError(ctx, weberror.JSONMarshalError(err))
+		return
+	}
+	ctx.SetContentType("application/json")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBody(response)
+}
@@ -0,0 +1,159 @@
+package middlewares
+
+import (
+	"testing"
+
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/valyala/fasthttp"
+)
+
+func testTenants(t *testing.T) *tenant.Registry {
+	t.Helper()
+	tenants, err := tenant.NewRegistry([]config.Tenant{
+		{
+			ID: "default",
+			RelyingParty: config.RelyingParty{
+				ID:             "example.com",
+				DisplayName:    "Example",
+				Origins:        []string{"https://example.com"},
+				RelatedOrigins: []string{"https://example.co.uk"},
+			},
+		},
+		{
+			ID:    "other",
+			Hosts: []string{"other.example"},
+			RelyingParty: config.RelyingParty{
+				ID:          "other.example",
+				DisplayName: "Other",
+				Origins:     []string{"https://other.example"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("tenant registry: %v", err)
+	}
+	return tenants
+}
+
+func TestCSRFProtection(t *testing.T) {
+	tenants := testTenants(t)
+	exempt := map[string]bool{"/api/v1/webauthn/register/options": true}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		tenant   string
+		origin   string
+		referer  string
+		cookie   string
+		header   string
+		wantNext bool
+	}{
+		{"GET is safe", fasthttp.MethodGet, "/api/v1/account", "default", "https://evil.example", "", "", "", true},
+		{"HEAD is safe", fasthttp.MethodHead, "/api/v1/account", "default", "https://evil.example", "", "", "", true},
+		{"OPTIONS is safe", fasthttp.MethodOptions, "/api/v1/account", "default", "https://evil.example", "", "", "", true},
+		{"exempt path", fasthttp.MethodPost, "/api/v1/webauthn/register/options", "default", "https://evil.example", "", "", "", true},
+		{"matching token and origin", fasthttp.MethodPost, "/api/v1/password/login", "default", "https://example.com", "", "t0ken", "t0ken", true},
+		{"related origin", fasthttp.MethodPost, "/api/v1/password/login", "default", "https://example.co.uk", "", "t0ken", "t0ken", true},
+		{"origin is case insensitive", fasthttp.MethodPut, "/api/v1/account/email", "default", "HTTPS://EXAMPLE.COM", "", "t0ken", "t0ken", true},
+		{"no origin nor referer is checked by token only", fasthttp.MethodDelete, "/api/v1/account/credentials/x", "default", "", "", "t0ken", "t0ken", true},
+		{"referer of the tenant", fasthttp.MethodPost, "/api/v1/password/login", "default", "", "https://example.com/login?next=1", "t0ken", "t0ken", true},
+		{"missing token", fasthttp.MethodPost, "/api/v1/password/login", "default", "https://example.com", "", "", "", false},
+		{"missing header", fasthttp.MethodPost, "/api/v1/password/login", "default", "https://example.com", "", "t0ken", "", false},
+		{"missing cookie", fasthttp.MethodPost, "/api/v1/password/login", "default", "https://example.com", "", "", "t0ken", false},
+		{"mismatched token", fasthttp.MethodPut, "/api/v1/account/password-login", "default", "https://example.com", "", "t0ken", "other", false},
+		{"foreign origin", fasthttp.MethodPost, "/api/v1/password/login", "default", "https://evil.example", "", "t0ken", "t0ken", false},
+		{"origin of another tenant", fasthttp.MethodPost, "/api/v1/password/login", "default", "https://other.example", "", "t0ken", "t0ken", false},
+		{"foreign referer", fasthttp.MethodPost, "/api/v1/password/login", "default", "", "https://evil.example/page", "t0ken", "t0ken", false},
+		{"unparsable referer", fasthttp.MethodPost, "/api/v1/password/login", "default", "", "not a url", "t0ken", "t0ken", false},
+		{"origin wins over referer", fasthttp.MethodPost, "/api/v1/password/login", "default", "https://evil.example", "https://example.com/", "t0ken", "t0ken", false},
+		{"without tenant any tenant origin", fasthttp.MethodPost, "/api/v1/password/login", "", "https://other.example", "", "t0ken", "t0ken", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := CSRFProtection(tenants, exempt)(func(ctx *fasthttp.RequestCtx) {
+				called = true
+			})
+
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Request.Header.SetMethod(tt.method)
+			ctx.Request.SetRequestURI(tt.path)
+			if tt.tenant != "" {
+				ctx.SetUserValue(tenant.Key, tenants.ByID(tt.tenant))
+			}
+			if tt.origin != "" {
+				ctx.Request.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				ctx.Request.Header.Set("Referer", tt.referer)
+			}
+			if tt.cookie != "" {
+				ctx.Request.Header.SetCookie(CSRFCookieName, tt.cookie)
+			}
+			if tt.header != "" {
+				ctx.Request.Header.Set(CSRFHeaderName, tt.header)
+			}
+			handler(ctx)
+
+			if called != tt.wantNext {
+				t.Fatalf("next called = %t, want %t (status %d)", called, tt.wantNext, ctx.Response.StatusCode())
+			}
+			if !tt.wantNext && ctx.Response.StatusCode() != fasthttp.StatusForbidden {
+				t.Errorf("status = %d, want %d", ctx.Response.StatusCode(), fasthttp.StatusForbidden)
+			}
+		})
+	}
+}
+
+func TestCSRFTokenHandler(t *testing.T) {
+	tenants := testTenants(t)
+
+	tests := []struct {
+		name         string
+		origin       string
+		cookie       string
+		wantSameSite fasthttp.CookieSameSite
+		wantIssued   bool
+	}{
+		{"same origin", "https://example.com", "", fasthttp.CookieSameSiteStrictMode, true},
+		{"no origin", "", "", fasthttp.CookieSameSiteStrictMode, true},
+		{"related origin", "https://example.co.uk", "", fasthttp.CookieSameSiteNoneMode, true},
+		{"foreign origin", "https://evil.example", "", fasthttp.CookieSameSiteStrictMode, true},
+		{"existing cookie is kept", "https://example.com", "t0ken", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &fasthttp.RequestCtx{}
+			ctx.SetUserValue(tenant.Key, tenants.ByID("default"))
+			if tt.origin != "" {
+				ctx.Request.Header.Set("Origin", tt.origin)
+			}
+			if tt.cookie != "" {
+				ctx.Request.Header.SetCookie(CSRFCookieName, tt.cookie)
+			}
+			CSRFTokenHandler(ctx)
+
+			cookie := fasthttp.AcquireCookie()
+			defer fasthttp.ReleaseCookie(cookie)
+			cookie.SetKey(CSRFCookieName)
+			issued := ctx.Response.Header.Cookie(cookie)
+			if issued != tt.wantIssued {
+				t.Fatalf("cookie issued = %t, want %t", issued, tt.wantIssued)
+			}
+			if !issued {
+				return
+			}
+			if cookie.SameSite() != tt.wantSameSite {
+				t.Errorf("SameSite = %v, want %v", cookie.SameSite(), tt.wantSameSite)
+			}
+			if !cookie.Secure() {
+				t.Error("cookie is not Secure")
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// DeprecationPolicy describes when a route was deprecated and when it stops being served.
+type DeprecationPolicy struct {
+	Since  time.Time
+	Sunset time.Time
+}
+
+// DeprecatedRoute marks responses of a legacy route with the Deprecation (RFC 9745) and
+// Sunset (RFC 8594) headers and links to the route that replaces it.
+func DeprecatedRoute(policy DeprecationPolicy, successor string) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	deprecation := fmt.Sprintf("@%d", policy.Since.Unix())
+	sunset := policy.Sunset.UTC().Format(http.TimeFormat)
+	link := fmt.Sprintf(`<%s>; rel="successor-version"`, successor)
+
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			ctx.Response.Header.Set("Deprecation", deprecation)
+			ctx.Response.Header.Set("Sunset", sunset)
+			ctx.Response.Header.Add("Link", link)
+			next(ctx)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"net"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// HTTPSRedirect answers every request with a permanent redirect to the same host and
+// URI over HTTPS, on the port of httpsAddr. 308 keeps the method and body of the
+// request, unlike 301.
+func HTTPSRedirect(httpsAddr string) fasthttp.RequestHandler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return func(ctx *fasthttp.RequestCtx) {
+		host := string(ctx.Host())
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if host == "" {
+			ctx.Error("Bad Request", fasthttp.StatusBadRequest)
+			return
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		ctx.Redirect("https://"+host+string(ctx.RequestURI()), fasthttp.StatusPermanentRedirect)
+	}
+}
@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/jamesyang124/webauthn-example/internal/logging"
+	"github.com/valyala/fasthttp"
+)
+
+// RequestIDHeader carries the request ID in requests and responses.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds IDs accepted from callers, which end up in every log line.
+const maxRequestIDLength = 128
+
+// RequestID reuses the X-Request-ID of the caller, such as a load balancer, when it is
+// well formed, and generates one otherwise. The ID is echoed in the response and stored
+// under logging.RequestIDKey for AppError.LogCtx and logging.WithRequest.
+func RequestID(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		id := string(ctx.Request.Header.Peek(RequestIDHeader))
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		ctx.SetUserValue(logging.RequestIDKey, id)
+		ctx.Response.Header.Set(RequestIDHeader, id)
+		next(ctx)
+		// Handlers that reset the response (ctx.Error) drop the header
+		ctx.Response.Header.Set(RequestIDHeader, id)
+	}
+}
+
+// validRequestID accepts printable IDs without separators that could forge log fields.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		ok := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			r == '-' || r == '_' || r == '.' || r == ':' || r == '/' || r == '+' || r == '='
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// Correlation is best effort; a fixed marker still shows the ID was not generated
+		return "unavailable"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,170 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/jamesyang124/webauthn-example/internal/clientip"
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/jamesyang124/webauthn-example/internal/logging"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// cspNonceKey is the request user value holding the nonce of the response.
+const cspNonceKey = "csp_nonce"
+
+// securityAppliedKey marks a response whose security headers were already written.
+const securityAppliedKey = "security_headers_applied"
+
+// nonceSource is replaced by 'nonce-<value>' in SecurityPolicy.ContentSecurityPolicy.
+const nonceSource = "{nonce}"
+
+// SecurityPolicy is the set of security headers sent by SecurityHeaders. Empty fields
+// are not sent. Routes that need a different policy, such as the SPA, wrap their handler
+// with their own SecurityHeaders.
+type SecurityPolicy struct {
+	// ContentSecurityPolicy directives; a {nonce} source generates a nonce per response.
+	ContentSecurityPolicy []string
+	// StrictTransportSecurity is only sent on TLS connections, as browsers ignore it otherwise.
+	StrictTransportSecurity string
+	FrameOptions            string
+	ReferrerPolicy          string
+	PermissionsPolicy       string
+}
+
+// APISecurityPolicy is the policy for JSON responses: nothing may be loaded or framed.
+func APISecurityPolicy(cfg config.Security) SecurityPolicy {
+	return SecurityPolicy{
+		ContentSecurityPolicy:   []string{"default-src 'none'", "frame-ancestors 'none'"},
+		StrictTransportSecurity: hstsValue(cfg),
+		FrameOptions:            "DENY",
+		ReferrerPolicy:          "no-referrer",
+		PermissionsPolicy:       permissionsPolicy(nil),
+	}
+}
+
+// SPASecurityPolicy is the policy for the single page application in views/dist. Scripts
+// and styles need the per-response nonce that rootPage injects into index.html; scripts
+// they load are trusted through 'strict-dynamic'.
+func SPASecurityPolicy(cfg config.Security) SecurityPolicy {
+	frameAncestors := "'none'"
+	frameOptions := "DENY"
+	if len(cfg.FrameAncestors) > 0 {
+		frameAncestors = "'self' " + strings.Join(cfg.FrameAncestors, " ")
+		// X-Frame-Options cannot express an allow-list; browsers use frame-ancestors instead
+		frameOptions = ""
+	}
+	connectSrc := strings.TrimSpace("'self' " + strings.Join(cfg.ConnectSources, " "))
+
+	return SecurityPolicy{
+		ContentSecurityPolicy: []string{
+			"default-src 'self'",
+			"script-src " + nonceSource + " 'strict-dynamic'",
+			"style-src 'self' " + nonceSource,
+			"img-src 'self' data:",
+			"connect-src " + connectSrc,
+			"object-src 'none'",
+			"base-uri 'none'",
+			"form-action 'self'",
+			"frame-ancestors " + frameAncestors,
+		},
+		StrictTransportSecurity: hstsValue(cfg),
+		FrameOptions:            frameOptions,
+		ReferrerPolicy:          "strict-origin-when-cross-origin",
+		PermissionsPolicy:       permissionsPolicy(cfg.WebAuthnDelegates),
+	}
+}
+
+func hstsValue(cfg config.Security) string {
+	if cfg.HSTSMaxAge <= 0 {
+		return ""
+	}
+	value := fmt.Sprintf("max-age=%d", int64(cfg.HSTSMaxAge.Seconds()))
+	if cfg.HSTSIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return value
+}
+
+// permissionsPolicy allows WebAuthn ceremonies on our own origin and in iframes of the
+// delegate origins, and disables powerful features the application never uses.
+func permissionsPolicy(delegates []string) string {
+	allow := "self"
+	for _, origin := range delegates {
+		allow += fmt.Sprintf(" %q", origin)
+	}
+	return strings.Join([]string{
+		"publickey-credentials-get=(" + allow + ")",
+		"publickey-credentials-create=(" + allow + ")",
+		"camera=()",
+		"microphone=()",
+		"geolocation=()",
+		"payment=()",
+		"usb=()",
+	}, ", ")
+}
+
+// SecurityHeaders sets the headers of policy on every response. Headers are written
+// after the handler ran, so that handlers resetting the response (ctx.Error, file
+// server errors) keep them, and only by the innermost SecurityHeaders of a route.
+func SecurityHeaders(policy SecurityPolicy) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	csp := strings.Join(policy.ContentSecurityPolicy, "; ")
+	usesNonce := strings.Contains(csp, nonceSource)
+
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			value := csp
+			if usesNonce {
+				nonce, err := newNonce()
+				if err != nil {
+					logging.WithRequest(ctx, logging.L("middlewares")).Error("Failed to generate CSP nonce", zap.Error(err))
+					ctx.Error("Internal server error", fasthttp.StatusInternalServerError)
+					return
+				}
+				ctx.SetUserValue(cspNonceKey, nonce)
+				value = strings.ReplaceAll(csp, nonceSource, "'nonce-"+nonce+"'")
+			}
+
+			next(ctx)
+
+			if ctx.UserValue(securityAppliedKey) != nil {
+				return
+			}
+			ctx.SetUserValue(securityAppliedKey, true)
+
+			header := &ctx.Response.Header
+			header.Set("X-Content-Type-Options", "nosniff")
+			setIfNotEmpty(header, "Content-Security-Policy", value)
+			if clientip.Scheme(ctx) == "https" {
+				setIfNotEmpty(header, "Strict-Transport-Security", policy.StrictTransportSecurity)
+			}
+			setIfNotEmpty(header, "X-Frame-Options", policy.FrameOptions)
+			setIfNotEmpty(header, "Referrer-Policy", policy.ReferrerPolicy)
+			setIfNotEmpty(header, "Permissions-Policy", policy.PermissionsPolicy)
+		}
+	}
+}
+
+func setIfNotEmpty(header *fasthttp.ResponseHeader, key, value string) {
+	if value != "" {
+		header.Set(key, value)
+	}
+}
+
+// CSPNonce returns the nonce generated for the response, or "" when the policy of the
+// route does not use one.
+func CSPNonce(ctx *fasthttp.RequestCtx) string {
+	nonce, _ := ctx.UserValue(cspNonceKey).(string)
+	return nonce
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/valyala/fasthttp"
+)
+
+// RequireServiceToken only lets requests through that carry token as a bearer token in
+// the Authorization header, for routes called by backend services rather than
+// browsers. An empty token rejects every request.
+func RequireServiceToken(token string) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			presented, ok := bytes.CutPrefix(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization), []byte("Bearer "))
+			if token == "" || !ok || subtle.ConstantTimeCompare(presented, []byte(token)) != 1 {
+				respondAppError(ctx, weberror.UnauthenticatedError(errors.New("missing or invalid service token")))
+				return
+			}
+			next(ctx)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/weberror"
+	"github.com/valyala/fasthttp"
+)
+
+// Tenant stores the tenant serving the Host of the request under tenant.Key. Requests
+// to unknown hosts pass through without a tenant, so that probes and static files
+// work on any host; routes that need a tenant are wrapped with RequireTenant.
+func Tenant(tenants *tenant.Registry) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			if t := tenants.ForHost(string(ctx.Host())); t != nil {
+				ctx.SetUserValue(tenant.Key, t)
+			}
+			next(ctx)
+		}
+	}
+}
+
+// RequireTenant rejects requests to hosts no tenant serves with a 404.
+func RequireTenant(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if tenant.From(ctx) == nil {
+			respondAppError(ctx, weberror.UnknownTenantError(string(ctx.Host())))
+			return
+		}
+		next(ctx)
+	}
+}
@@ -6,17 +6,52 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"regexp"
+	"time"
 
 	"github.com/fasthttp/router"
 	"github.com/jamesyang124/webauthn-example/handlers"
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/jamesyang124/webauthn-example/internal/openapi"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/internal/user"
 	"github.com/jamesyang124/webauthn-example/middlewares"
 	"github.com/jamesyang124/webauthn-example/types"
 	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
 )
 
+// nonceTags matches the opening tags that need the CSP nonce of the response.
+var nonceTags = regexp.MustCompile(`<(script|style|link)\b`)
+
+// rootPage serves the SPA entry point with the CSP nonce of the response added to its
+// script, style and link tags.
 func rootPage(ctx *fasthttp.RequestCtx) {
-	ctx.SetContentType("text/html")
-	ctx.SendFile("./views/dist/index.html")
+	page, err := os.ReadFile("./views/dist/index.html")
+	if err != nil {
+		zap.L().Error("Failed to read index.html", zap.Error(err))
+		ctx.Error("Not Found", fasthttp.StatusNotFound)
+		return
+	}
+	if nonce := middlewares.CSPNonce(ctx); nonce != "" {
+		page = nonceTags.ReplaceAll(page, []byte(`<$1 nonce="`+nonce+`"`))
+	}
+	ctx.SetContentType("text/html; charset=utf-8")
+	ctx.SetBody(page)
+}
+
+// staticFiles serves the built SPA assets below root. Directory listings are disabled
+// and index.html is only served through rootPage, which adds the CSP nonce.
+func staticFiles(root string, stripSlashes int) fasthttp.RequestHandler {
+	fs := &fasthttp.FS{
+		Root:            root,
+		AcceptByteRange: true,
+	}
+	if stripSlashes > 0 {
+		fs.PathRewrite = fasthttp.NewPathSlashesStripper(stripSlashes)
+	}
+	return fs.NewRequestHandler()
 }
 
 func versionHandler(ctx *fasthttp.RequestCtx) {
@@ -30,6 +65,12 @@ func versionHandler(ctx *fasthttp.RequestCtx) {
 	ctx.SetBody(jsonResponse)
 }
 
+func readyz(persistance *types.Persistance, tenants *tenant.Registry) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleReadyz(ctx, persistance.Db, persistance.Cache, tenants)
+	}
+}
+
 func waRegisterOptions(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
 	return func(ctx *fasthttp.RequestCtx) {
 		handlers.HandleRegisterOptions(ctx, persistance.Db, persistance.Cache)
@@ -55,6 +96,132 @@ func waAuthenticateVerification(persistance *types.Persistance) func(ctx *fastht
 	}
 }
 
+func waDiscoverableOptions(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleDiscoverableOptions(ctx, persistance.Cache)
+	}
+}
+
+func waDiscoverableVerification(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleDiscoverableVerification(ctx, persistance.Db, persistance.Cache)
+	}
+}
+
+func waStepUpOptions(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleStepUpOptions(ctx, persistance.Db, persistance.Cache)
+	}
+}
+
+func waStepUpVerification(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleStepUpVerification(ctx, persistance.Db, persistance.Cache)
+	}
+}
+
+func passwordLogin(persistance *types.Persistance, limit config.PasswordLogin) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandlePasswordLogin(ctx, persistance.Db, persistance.Cache, limit.MaxAttempts, limit.Window)
+	}
+}
+
+func account(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleAccount(ctx, persistance.Db)
+	}
+}
+
+func accountListCredentials(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleAccountListCredentials(ctx, persistance.Db)
+	}
+}
+
+func accountEnrollmentOptions(persistance *types.Persistance, maxAge time.Duration) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleEnrollmentOptions(ctx, persistance.Db, persistance.Cache, maxAge)
+	}
+}
+
+func accountEnrollmentVerification(persistance *types.Persistance, maxAge time.Duration) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleEnrollmentVerification(ctx, persistance.Db, persistance.Cache, maxAge)
+	}
+}
+
+func accountSetPasswordLogin(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleAccountSetPasswordLogin(ctx, persistance.Db)
+	}
+}
+
+func accountDeleteCredential(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleAccountDeleteCredential(ctx, persistance.Db)
+	}
+}
+
+func accountChangeEmail(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleAccountChangeEmail(ctx, persistance.Db)
+	}
+}
+
+func createTransaction(persistance *types.Persistance, ttl time.Duration) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleCreateTransaction(ctx, persistance.Db, persistance.Cache, ttl)
+	}
+}
+
+func transactionVerification(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleTransactionVerification(ctx, persistance.Db, persistance.Cache)
+	}
+}
+
+func getTransactionProof(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleGetTransactionProof(ctx, persistance.Db)
+	}
+}
+
+func adminAPISearchUsers(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleAdminSearchUsers(ctx, persistance.Db)
+	}
+}
+
+func adminAPIListCredentials(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleAdminListCredentials(ctx, persistance.Db)
+	}
+}
+
+func adminAPIRevokeCredential(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleAdminRevokeCredential(ctx, persistance.Db)
+	}
+}
+
+func adminAPIRevokeSessions(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleAdminRevokeSessions(ctx, persistance.Db, persistance.Cache)
+	}
+}
+
+func adminAPILockUser(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleAdminLockUser(ctx, persistance.Db, persistance.Cache)
+	}
+}
+
+func adminAPIUnlockUser(persistance *types.Persistance) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		handlers.HandleAdminUnlockUser(ctx, persistance.Db, persistance.Cache)
+	}
+}
+
 func notFoundHandler(ctx *fasthttp.RequestCtx) {
 	ctx.SetStatusCode(fasthttp.StatusNotFound)
 	ctx.SetContentType("application/json; charset=utf-8")
@@ -66,24 +233,182 @@ func notFoundHandler(ctx *fasthttp.RequestCtx) {
 	ctx.SetBody(jsonResponse)
 }
 
-func PrepareRoutes(persistance *types.Persistance) fasthttp.RequestHandler {
+// route is a single method/path/handler registration within an API version.
+type route struct {
+	method  string
+	path    string
+	handler fasthttp.RequestHandler
+}
+
+// apiVersion is a versioned API namespace. Versions share the handlers package for the
+// ceremony logic and only differ in the routes (and payload adapters) they expose.
+// Admin routes are served under prefix+"/admin" and are never aliased without a prefix.
+type apiVersion struct {
+	prefix      string
+	routes      func(persistance *types.Persistance, cfg *config.Config) []route
+	adminRoutes func(persistance *types.Persistance) []route
+}
+
+// apiVersions lists every served API version, oldest first.
+var apiVersions = []apiVersion{
+	{prefix: "/api/v1", routes: routesV1, adminRoutes: adminRoutesV1},
+}
+
+// legacyVersion is the version whose ceremony routes are still served without a prefix
+// under the original /webauthn/... paths.
+const legacyVersion = "/api/v1"
+
+// legacyPaths are the ceremony routes that existed before versioning. Routes added since
+// are only served under a version prefix.
+var legacyPaths = map[string]bool{
+	"/webauthn/register/options":          true,
+	"/webauthn/register/verification":     true,
+	"/webauthn/authenticate/options":      true,
+	"/webauthn/authenticate/verification": true,
+}
+
+// csrfExemptPaths are the version-relative paths that skip middlewares.CSRFProtection.
+// Only the ceremonies belong here, since the WebAuthn library verifies the origin in
+// their client data, and service routes authenticated by a bearer token, which
+// browsers never send on their own.
+var csrfExemptPaths = []string{
+	"/webauthn/register/options",
+	"/webauthn/register/verification",
+	"/webauthn/authenticate/options",
+	"/webauthn/authenticate/verification",
+	"/webauthn/authenticate/discoverable/options",
+	"/webauthn/authenticate/discoverable/verification",
+	"/webauthn/stepup/options",
+	"/webauthn/stepup/verification",
+	"/account/passkeys/options",
+	"/account/passkeys/verification",
+	"/transactions",
+	"/transactions/verification",
+}
+
+// routesV1 are the ceremonies, the password sign-in, the account routes of the signed-in
+// user and the transaction confirmation routes. Account changes need a user verification
+// within STEP_UP_MAX_AGE, from the login or from the step-up ceremony; only the first
+// passkey of a user signed in with a password is enrolled without one. Transactions are
+// submitted and read by backend services holding TRANSACTION_SERVICE_TOKEN.
+func routesV1(persistance *types.Persistance, cfg *config.Config) []route {
+	stepUp := middlewares.RequireRecentUV(persistance, cfg.StepUp.MaxAge)
+	signedIn := middlewares.RequireSession(persistance)
+	service := middlewares.RequireServiceToken(cfg.Transactions.ServiceToken)
+	return []route{
+		{fasthttp.MethodGet, "/csrf", middlewares.CSRFTokenHandler},
+		{fasthttp.MethodPost, "/webauthn/register/options", waRegisterOptions(persistance)},
+		{fasthttp.MethodPost, "/webauthn/register/verification", waRegisterVerification(persistance)},
+		{fasthttp.MethodPost, "/webauthn/authenticate/options", waAuthenticateOptions(persistance)},
+		{fasthttp.MethodPost, "/webauthn/authenticate/verification", waAuthenticateVerification(persistance)},
+		{fasthttp.MethodPost, "/webauthn/authenticate/discoverable/options", waDiscoverableOptions(persistance)},
+		{fasthttp.MethodPost, "/webauthn/authenticate/discoverable/verification", waDiscoverableVerification(persistance)},
+		{fasthttp.MethodPost, "/webauthn/stepup/options", waStepUpOptions(persistance)},
+		{fasthttp.MethodPost, "/webauthn/stepup/verification", waStepUpVerification(persistance)},
+		{fasthttp.MethodPost, "/password/login", passwordLogin(persistance, cfg.PasswordLogin)},
+		{fasthttp.MethodGet, "/account", signedIn(account(persistance))},
+		{fasthttp.MethodGet, "/account/credentials", signedIn(accountListCredentials(persistance))},
+		{fasthttp.MethodPost, "/account/passkeys/options", signedIn(accountEnrollmentOptions(persistance, cfg.StepUp.MaxAge))},
+		{fasthttp.MethodPost, "/account/passkeys/verification", signedIn(accountEnrollmentVerification(persistance, cfg.StepUp.MaxAge))},
+		{fasthttp.MethodPut, "/account/password-login", stepUp(accountSetPasswordLogin(persistance))},
+		{fasthttp.MethodDelete, "/account/credentials/{credentialId}", stepUp(accountDeleteCredential(persistance))},
+		{fasthttp.MethodPut, "/account/email", stepUp(accountChangeEmail(persistance))},
+		{fasthttp.MethodPost, "/transactions", service(createTransaction(persistance, cfg.Transactions.TTL))},
+		{fasthttp.MethodPost, "/transactions/verification", transactionVerification(persistance)},
+		{fasthttp.MethodGet, "/transactions/{transactionId}", service(getTransactionProof(persistance))},
+	}
+}
+
+// adminRoutesV1 lets every staff role read, while only admin and support may act on accounts.
+func adminRoutesV1(persistance *types.Persistance) []route {
+	read := middlewares.RequireRoles(persistance, user.RoleAdmin, user.RoleSupport, user.RoleAuditor)
+	write := middlewares.RequireRoles(persistance, user.RoleAdmin, user.RoleSupport)
+	return []route{
+		{fasthttp.MethodGet, "/users", read(adminAPISearchUsers(persistance))},
+		{fasthttp.MethodGet, "/users/{userId}/credentials", read(adminAPIListCredentials(persistance))},
+		{fasthttp.MethodDelete, "/users/{userId}/credentials/{credentialId}", write(adminAPIRevokeCredential(persistance))},
+		{fasthttp.MethodPost, "/users/{userId}/sessions/revoke", write(adminAPIRevokeSessions(persistance))},
+		{fasthttp.MethodPost, "/users/{userId}/lock", write(adminAPILockUser(persistance))},
+		{fasthttp.MethodPost, "/users/{userId}/unlock", write(adminAPIUnlockUser(persistance))},
+	}
+}
+
+// PrepareRoutes builds the handler of the server. API routes only serve hosts of a
+// tenant; the SPA, probes and metadata routes serve any host.
+func PrepareRoutes(persistance *types.Persistance, cfg *config.Config, tenants *tenant.Registry) fasthttp.RequestHandler {
+	routes := newRouter(persistance, cfg, tenants)
+
+	// Keep openapi.json honest: every documented operation must be routed and vice versa
+	if err := openapi.VerifyRoutes(routes.List()); err != nil {
+		zap.L().Error("OpenAPI document does not match registered routes", zap.Error(err))
+	}
+
+	csrfExempt := map[string]bool{}
+	for _, path := range csrfExemptPaths {
+		csrfExempt[path] = true
+		for _, version := range apiVersions {
+			csrfExempt[version.prefix+path] = true
+		}
+	}
+	csrf := middlewares.CSRFProtection(tenants, csrfExempt)
+
+	apiSecurity := middlewares.SecurityHeaders(middlewares.APISecurityPolicy(cfg.Security))
+	accessLog := middlewares.AccessLog(cfg.AccessLog)
+	clientIP := middlewares.ClientIP(cfg.Proxy)
+	tenantOf := middlewares.Tenant(tenants)
+	// Preflights may ask for any method a route is served with
+	routedMethods := []string{}
+	for method := range routes.List() {
+		routedMethods = append(routedMethods, method)
+	}
+	cors := middlewares.CorsMiddleware(cfg.CORS, routedMethods)
+	return middlewares.RequestID(clientIP(tenantOf(accessLog(cors(apiSecurity(csrf(routes.Handler)))))))
+}
+
+// newRouter registers the pages, the versioned API and the admin API, without the
+// middlewares that PrepareRoutes wraps around them.
+func newRouter(persistance *types.Persistance, cfg *config.Config, tenants *tenant.Registry) *router.Router {
 	routes := router.New()
+	// The access log groups requests by route template
+	routes.SaveMatchedRoutePath = true
 
-	routes.GET("/", rootPage)
-	routes.ServeFiles("/{filepath:*}", "./views/dist")
-	routes.ServeFiles("/assets/{filepath:*}", "./views/dist/assets")
+	// The SPA needs a policy that lets its own scripts run; everything else keeps the API policy
+	spaSecurity := middlewares.SecurityHeaders(middlewares.SPASecurityPolicy(cfg.Security))
+	routes.GET("/", spaSecurity(rootPage))
+	routes.GET("/index.html", spaSecurity(rootPage))
+	routes.GET("/{filepath:*}", spaSecurity(staticFiles("./views/dist", 0)))
+	routes.GET("/assets/{filepath:*}", spaSecurity(staticFiles("./views/dist/assets", 1)))
 
 	routes.GET("/version", versionHandler)
+	routes.GET("/openapi.json", openapi.Handler)
+	routes.GET("/healthz", handlers.HandleHealthz)
+	routes.GET("/readyz", readyz(persistance, tenants))
+	routes.GET("/.well-known/webauthn", handlers.HandleWellKnownWebAuthn)
 
-	waRegister := routes.Group("/webauthn/register")
-	waRegister.POST("/options", waRegisterOptions(persistance))
-	waRegister.POST("/verification", waRegisterVerification(persistance))
+	deprecationPolicy := middlewares.DeprecationPolicy{
+		Since:  cfg.LegacyAPI.DeprecatedAt,
+		Sunset: cfg.LegacyAPI.Sunset,
+	}
+	for _, version := range apiVersions {
+		api := routes.Group(version.prefix)
+		for _, r := range version.routes(persistance, cfg) {
+			handler := middlewares.RequireTenant(r.handler)
+			api.Handle(r.method, r.path, handler)
 
-	waAuth := routes.Group("/webauthn/authenticate")
-	waAuth.POST("/options", waAuthenticateOptions(persistance))
-	waAuth.POST("/verification", waAuthenticateVerification(persistance))
+			// Unversioned aliases keep existing clients working until the sunset date
+			if version.prefix == legacyVersion && legacyPaths[r.path] {
+				deprecated := middlewares.DeprecatedRoute(deprecationPolicy, version.prefix+r.path)
+				routes.Handle(r.method, r.path, deprecated(handler))
+			}
+		}
+		if version.adminRoutes != nil {
+			admin := api.Group("/admin")
+			for _, r := range version.adminRoutes(persistance) {
+				admin.Handle(r.method, r.path, middlewares.RequireTenant(r.handler))
+			}
+		}
+	}
 
 	routes.NotFound = notFoundHandler
-
-	return middlewares.CorsMiddleware(routes.Handler)
+	return routes
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jamesyang124/webauthn-example/internal/config"
+	"github.com/jamesyang124/webauthn-example/internal/openapi"
+	"github.com/jamesyang124/webauthn-example/internal/tenant"
+	"github.com/jamesyang124/webauthn-example/types"
+)
+
+// TestRoutesMatchOpenAPI fails when a route is registered without being documented in
+// openapi.json, or documented without being registered.
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	tenants, err := tenant.NewRegistry(nil)
+	if err != nil {
+		t.Fatalf("empty tenant registry: %v", err)
+	}
+	persistance := &types.Persistance{}
+	cfg := &config.Config{}
+
+	if PrepareRoutes(persistance, cfg, tenants) == nil {
+		t.Fatal("PrepareRoutes returned no handler")
+	}
+	if err := openapi.VerifyRoutes(newRouter(persistance, cfg, tenants).List()); err != nil {
+		t.Fatal(err)
+	}
+}
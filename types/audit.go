@@ -0,0 +1,18 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEvent is a security relevant action recorded in the audit_events table.
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	UserID     *int64          `json:"userId,omitempty"`
+	Username   string          `json:"username,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	Detail     json.RawMessage `json:"detail"`
+}
@@ -0,0 +1,45 @@
+package types
+
+import "time"
+
+// StoredCredential is a WebAuthn credential as persisted in the credentials table.
+// CredentialID and PublicKey are base64.RawURLEncoding encoded. The flags are those of
+// the latest ceremony, except BackupEligible, which never changes; it is nil for
+// credentials registered before it was recorded, until their next login. AAGUID is empty for
+// credentials registered before it was recorded. Authenticator is resolved from the
+// AAGUID when the credential is listed, see aaguid.Annotate. BackupClass is derived
+// from the backup flags, see backup.Classify, and BackedUpAt is when BS was first seen.
+// Discoverable, LargeBlob and PRF are the extension outputs reported by the client,
+// nil when it never did, see package extension.
+type StoredCredential struct {
+	ID                 int64          `json:"id"`
+	UserID             int64          `json:"userId"`
+	CredentialID       string         `json:"credentialId"`
+	PublicKey          string         `json:"publicKey"`
+	SignCount          uint32         `json:"signCount"`
+	Transports         []string       `json:"transports"`
+	UserPresent        bool           `json:"userPresent"`
+	UserVerified       bool           `json:"userVerified"`
+	BackupEligible     *bool          `json:"backupEligible,omitempty"`
+	BackupState        bool           `json:"backupState"`
+	AAGUID             string         `json:"aaguid,omitempty"`
+	AttestationType    string         `json:"attestationType,omitempty"`
+	Attachment         string         `json:"attachment,omitempty"`
+	BackupClass        string         `json:"backupClass"`
+	BackedUpAt         *time.Time     `json:"backedUpAt,omitempty"`
+	Discoverable       *bool          `json:"discoverable,omitempty"`
+	LargeBlob          *bool          `json:"largeBlob,omitempty"`
+	LargeBlobWrittenAt *time.Time     `json:"largeBlobWrittenAt,omitempty"`
+	PRF                *bool          `json:"prf,omitempty"`
+	Authenticator      *Authenticator `json:"authenticator,omitempty"`
+	CreatedAt          time.Time      `json:"createdAt"`
+	LastUsedAt         *time.Time     `json:"lastUsedAt,omitempty"`
+}
+
+// Authenticator names the model of the authenticator holding a credential. Icons are
+// URLs or data URIs, for light and dark backgrounds.
+type Authenticator struct {
+	Name     string `json:"name"`
+	Icon     string `json:"icon,omitempty"`
+	IconDark string `json:"iconDark,omitempty"`
+}
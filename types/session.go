@@ -0,0 +1,14 @@
+package types
+
+import "time"
+
+// AuthSession is the signed-in state stored in Redis behind the session cookie.
+type AuthSession struct {
+	ID        string    `json:"-"`
+	UserID    string    `json:"userId"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"createdAt"`
+	// UserVerifiedAt is when the user last passed user verification in this session,
+	// at login or in a step-up ceremony. It is zero when they never did.
+	UserVerifiedAt time.Time `json:"userVerifiedAt"`
+}
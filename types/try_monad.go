@@ -114,7 +114,22 @@ func (tc *TryIOChain[T]) ThenCredentialCreation(fn func(T) (*protocol.Credential
 	return ThenTyped(tc, fn)
 }
 
+// ThenStoredCredentials transforms to []StoredCredential type.
+func (tc *TryIOChain[T]) ThenStoredCredentials(fn func(T) ([]StoredCredential, error)) *TryIOChain[[]StoredCredential] {
+	return ThenTyped(tc, fn)
+}
+
+// ThenWebAuthnCredentials transforms to []webauthn.Credential type.
+func (tc *TryIOChain[T]) ThenWebAuthnCredentials(fn func(T) ([]webauthn.Credential, error)) *TryIOChain[[]webauthn.Credential] {
+	return ThenTyped(tc, fn)
+}
+
 // ThenInt64 transforms to int64 type.
 func (tc *TryIOChain[T]) ThenInt64(fn func(T) (int64, error)) *TryIOChain[int64] {
 	return ThenTyped(tc, fn)
 }
+
+// ThenAuthSession transforms to *AuthSession type.
+func (tc *TryIOChain[T]) ThenAuthSession(fn func(T) (*AuthSession, error)) *TryIOChain[*AuthSession] {
+	return ThenTyped(tc, fn)
+}
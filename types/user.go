@@ -0,0 +1,15 @@
+package types
+
+import "time"
+
+// UserSummary is the account view used by operational tooling.
+type UserSummary struct {
+	ID              int64      `json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	DisplayName     string     `json:"displayName,omitempty"`
+	Roles           []string   `json:"roles"`
+	LockedAt        *time.Time `json:"lockedAt,omitempty"`
+	CredentialCount int        `json:"credentialCount"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
@@ -1,7 +1,14 @@
-import { useState } from 'react';
+import { useEffect, useRef, useState } from 'react';
 import { LoginFormData } from '../../types/auth';
 import { AuthenticationResponseData } from 'webauthn';
-import { base64UrlToBase64Std, base64StdToArrayBuffers } from '../../utils';
+import {
+  base64UrlToBase64Std,
+  base64StdToArrayBuffers,
+  credentialForServer,
+  decodeExtensionInputs,
+  derivePrfKey,
+  fetchCSRFToken,
+} from '../../utils';
 
 const handleWebAuthnLogin = async (responseData: AuthenticationResponseData, username: string) => {
   try {
@@ -14,25 +21,30 @@ const handleWebAuthnLogin = async (responseData: AuthenticationResponseData, use
       publicKey: {
         ...responseData.publicKey,
         challenge: base64StdToArrayBuffers(challenge),
-        allowCredentials
+        allowCredentials,
+        extensions: decodeExtensionInputs(responseData.publicKey.extensions),
       },
     };
 
     // Get WebAuthn assertion from browser
     const assertionResponse = await navigator.credentials.get(options);
     console.log('authentication assertionResponse', assertionResponse);
+    if (await derivePrfKey(assertionResponse)) {
+      console.log('Derived an encryption key from the PRF output of the passkey');
+    }
 
     const payload = {
-      credential: assertionResponse,
+      credential: credentialForServer(assertionResponse),
       username: username
     };
 
     // Send assertion to server for authentication verification
-    const response = await fetch(`${import.meta.env.VITE_API_URL}/webauthn/authenticate/verification`, {
+    const response = await fetch(`${import.meta.env.VITE_API_URL}/api/v1/webauthn/authenticate/verification`, {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify(payload),
-      mode: 'cors', // Added to avoid CORS issues
+      mode: 'cors',
+      credentials: 'include', // Send and accept the session cookie across origins
     });
 
     // Parse authentication verification response
@@ -50,6 +62,59 @@ const handleWebAuthnLogin = async (responseData: AuthenticationResponseData, use
   }
 };
 
+// Conditional mediation: the browser offers passkeys in the autofill of the username
+// field, and the user handle of the chosen passkey identifies the user to the server.
+const startConditionalLogin = async (signal: AbortSignal) => {
+  if (!window.PublicKeyCredential?.isConditionalMediationAvailable ||
+    !(await PublicKeyCredential.isConditionalMediationAvailable())) {
+    return;
+  }
+  try {
+    const response = await fetch(`${import.meta.env.VITE_API_URL}/api/v1/webauthn/authenticate/discoverable/options`, {
+      method: 'POST',
+      mode: 'cors',
+      credentials: 'include',
+      signal,
+    });
+    const responseData: AuthenticationResponseData = await response.json();
+
+    const assertionResponse = await navigator.credentials.get({
+      mediation: 'conditional',
+      publicKey: {
+        ...responseData.publicKey,
+        challenge: base64StdToArrayBuffers(base64UrlToBase64Std(responseData.publicKey.challenge)),
+        allowCredentials: [],
+        extensions: decodeExtensionInputs(responseData.publicKey.extensions),
+      },
+      signal,
+    });
+    if (await derivePrfKey(assertionResponse)) {
+      console.log('Derived an encryption key from the PRF output of the passkey');
+    }
+
+    const verification = await fetch(`${import.meta.env.VITE_API_URL}/api/v1/webauthn/authenticate/discoverable/verification`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ credential: credentialForServer(assertionResponse) }),
+      mode: 'cors',
+      credentials: 'include', // Send and accept the session cookie across origins
+    });
+    const verificationResponse = await verification.json();
+    console.log('Authentication verification response:', verificationResponse);
+
+    if (verification.ok) {
+      alert('Authentication verified successfully!');
+    } else {
+      alert('Authentication verification failed.');
+    }
+  } catch (error) {
+    // Aborted when the form unmounts or the user signs in with the button instead
+    if ((error as DOMException).name !== 'AbortError') {
+      console.error('Error during conditional authentication:', error);
+    }
+  }
+};
+
 const handleLoginFlow = async (username: string) => {
   try {
     if (!username) {
@@ -57,11 +122,12 @@ const handleLoginFlow = async (username: string) => {
       return;
     }
     // Request authentication options from server
-    const response = await fetch(`${import.meta.env.VITE_API_URL}/webauthn/authenticate/options`, {
+    const response = await fetch(`${import.meta.env.VITE_API_URL}/api/v1/webauthn/authenticate/options`, {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({ "username": username }),
-      mode: 'cors', // Added to avoid CORS issues
+      mode: 'cors',
+      credentials: 'include', // Send and accept the session cookie across origins
     });
     // Parse authentication options response
     const responseData: AuthenticationResponseData = await response.json();
@@ -73,11 +139,91 @@ const handleLoginFlow = async (username: string) => {
   }
 };
 
+// After a password sign-in the user is offered to enroll a passkey for the account,
+// without a new ceremony to prove who they are.
+const enrollPasskey = async () => {
+  const response = await fetch(`${import.meta.env.VITE_API_URL}/api/v1/account/passkeys/options`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({}),
+    mode: 'cors',
+    credentials: 'include',
+  });
+  if (!response.ok) {
+    throw new Error(`Passkey enrollment failed: ${response.statusText}`);
+  }
+  const responseData = await response.json();
+  const credential = await navigator.credentials.create({
+    publicKey: {
+      ...responseData.publicKey,
+      challenge: base64StdToArrayBuffers(base64UrlToBase64Std(responseData.publicKey.challenge)),
+      user: {
+        ...responseData.publicKey.user,
+        id: base64StdToArrayBuffers(base64UrlToBase64Std(responseData.publicKey.user.id)),
+      },
+      excludeCredentials: responseData.publicKey.excludeCredentials?.map((cred: { id: string }) => ({
+        type: 'public-key' as const,
+        id: base64StdToArrayBuffers(base64UrlToBase64Std(cred.id)),
+      })),
+    },
+  });
+
+  const verification = await fetch(`${import.meta.env.VITE_API_URL}/api/v1/account/passkeys/verification`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ credential }),
+    mode: 'cors',
+    credentials: 'include',
+  });
+  console.log('Passkey enrollment response:', await verification.json());
+  alert(verification.ok ? 'Passkey enrolled, sign in with it next time!' : 'Passkey enrollment failed.');
+};
+
+const handlePasswordLogin = async (username: string, password: string) => {
+  try {
+    if (!username || !password) {
+      alert('Please enter a username and password.');
+      return;
+    }
+    const response = await fetch(`${import.meta.env.VITE_API_URL}/api/v1/password/login`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': await fetchCSRFToken() },
+      body: JSON.stringify({ username, password }),
+      mode: 'cors',
+      credentials: 'include', // Send and accept the session cookie across origins
+    });
+    const loginResponse = await response.json();
+    console.log('Password login response:', loginResponse);
+    if (!response.ok) {
+      alert(`Password sign-in failed: ${loginResponse.error}`);
+      return;
+    }
+
+    if (loginResponse.enrollPasskey && confirm('Signed in. Create a passkey to sign in without your password next time?')) {
+      await enrollPasskey();
+    } else {
+      alert('Signed in successfully!');
+    }
+  } catch (error) {
+    console.error('Error during password sign-in:', error);
+    alert('An error occurred during password sign-in. Please try again.');
+  }
+};
+
 const LoginForm = () => {
   const [formData, setFormData] = useState<LoginFormData>({
     username: 'user1',
+    password: '',
   });
   const [loading, setLoading] = useState(false);
+  const conditionalLogin = useRef<AbortController | null>(null);
+
+  useEffect(() => {
+    const controller = new AbortController();
+    conditionalLogin.current = controller;
+    startConditionalLogin(controller.signal);
+    return () => controller.abort();
+  }, []);
 
   const handleChange = (e: React.ChangeEvent<HTMLInputElement>) => {
     const { name, value } = e.target;
@@ -91,12 +237,22 @@ const LoginForm = () => {
     e.preventDefault();
     setLoading(true);
 
+    // Only one WebAuthn request can be pending, so cancel the autofill request first
+    conditionalLogin.current?.abort();
+
     // Execute complete login flow
     await handleLoginFlow(formData.username);
 
     setLoading(false);
   };
 
+  const handlePasswordSubmit = async () => {
+    setLoading(true);
+    conditionalLogin.current?.abort();
+    await handlePasswordLogin(formData.username, formData.password);
+    setLoading(false);
+  };
+
   return (
     <form className="space-y-6" onSubmit={handleSubmit}>
       <div>
@@ -108,7 +264,7 @@ const LoginForm = () => {
             id="username"
             name="username"
             type="text"
-            autoComplete="username"
+            autoComplete="username webauthn"
             required
             className={`block w-full appearance-none rounded-md border border-gray-300 px-3 py-2 placeholder-gray-400 shadow-sm focus:border-indigo-500 focus:outline-none focus:ring-indigo-500 sm:text-sm`}
             placeholder="Enter passkey's username"
@@ -118,6 +274,23 @@ const LoginForm = () => {
         </div>
       </div>
 
+      <div>
+        <label htmlFor="password" className="block text-sm font-medium text-gray-700">
+          Password (accounts without a passkey)
+        </label>
+        <div className="mt-1">
+          <input
+            id="password"
+            name="password"
+            type="password"
+            autoComplete="current-password"
+            className={`block w-full appearance-none rounded-md border border-gray-300 px-3 py-2 placeholder-gray-400 shadow-sm focus:border-indigo-500 focus:outline-none focus:ring-indigo-500 sm:text-sm`}
+            placeholder="Enter your password"
+            value={formData.password}
+            onChange={handleChange}
+          />
+        </div>
+      </div>
 
       <div>
         <button
@@ -131,6 +304,17 @@ const LoginForm = () => {
           {loading ? 'Signing in...' : 'Sign in'}
         </button>
       </div>
+
+      <div>
+        <button
+          type="button"
+          disabled={loading || !formData.password}
+          onClick={handlePasswordSubmit}
+          className="flex w-full justify-center rounded-md border border-gray-300 bg-white py-2 px-4 text-sm font-medium text-gray-700 hover:bg-gray-50 disabled:cursor-not-allowed disabled:opacity-50"
+        >
+          Sign in with password
+        </button>
+      </div>
     </form>
   );
 };
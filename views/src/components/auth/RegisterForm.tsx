@@ -27,18 +27,18 @@ const handleWebAuthnRegistration = async (responseData: RegistrationResponseData
     const credential = await navigator.credentials.create(options);
     console.log(credential);
 
+    // The server creates the user with the email and display name of the options request
     const payload = {
       credential,
-      username: options.publicKey.user.name,
-      displayname: options.publicKey.user.displayName,
     };
 
     // Send credential to server for verification
-    const response = await fetch(`${import.meta.env.VITE_API_URL}/webauthn/register/verification`, {
+    const response = await fetch(`${import.meta.env.VITE_API_URL}/api/v1/webauthn/register/verification`, {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify(payload),
-      mode: 'cors', // Added to avoid CORS issues
+      mode: 'cors',
+      credentials: 'include', // Send and accept the session cookie across origins
     });
 
     // Parse server response
@@ -48,14 +48,14 @@ const handleWebAuthnRegistration = async (responseData: RegistrationResponseData
     if (response.ok) {
       alert('Registration successful!');
     } else {
-      alert('Registration failed.');
+      alert(`Registration failed: ${verificationResponse.error}`);
     }
   } catch (error) {
     console.error('Error during registration:', error);
   }
 };
 
-const handleRegistrationFlow = async (username: string) => {
+const handleRegistrationFlow = async ({ username, email, displayName, profile }: RegisterFormData) => {
   try {
     if (!username) {
       alert('Please enter a username.');
@@ -63,14 +63,18 @@ const handleRegistrationFlow = async (username: string) => {
     }
     console.log('Registration options ajax request in:');
     // Request registration options from server
-    const response = await fetch(`${import.meta.env.VITE_API_URL}/webauthn/register/options`, {
+    const response = await fetch(`${import.meta.env.VITE_API_URL}/api/v1/webauthn/register/options`, {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
-      body: JSON.stringify({ "username": username }),
-      mode: 'cors', // Added to avoid CORS issues
+      body: JSON.stringify({ username, email, displayname: displayName, ...(profile ? { profile } : {}) }),
+      mode: 'cors',
+      credentials: 'include', // Send and accept the session cookie across origins
     });
     if (!response.ok) {
-      throw new Error(`Registration failed: ${response.statusText}`);
+      // The username or email may belong to another user already
+      const { error } = await response.json();
+      alert(`Registration failed: ${error}`);
+      return;
     }
 
     // Parse registration options response
@@ -87,12 +91,15 @@ const handleRegistrationFlow = async (username: string) => {
 
 const RegisterForm = () => {
   const [formData, setFormData] = useState<RegisterFormData>({
-    username: 'user1',
+    username: '',
+    email: '',
+    displayName: '',
+    profile: '',
   });
   const [loading, setLoading] = useState(false);
   const [errors, setErrors] = useState<Partial<RegisterFormData>>({});
 
-  const handleChange = (e: React.ChangeEvent<HTMLInputElement>) => {
+  const handleChange = (e: React.ChangeEvent<HTMLInputElement | HTMLSelectElement>) => {
     const { name, value } = e.target;
     setFormData((prev) => ({
       ...prev,
@@ -114,6 +121,12 @@ const RegisterForm = () => {
     if (!formData.username.trim()) {
       newErrors.username = 'Username is required';
     }
+    if (!formData.email.trim()) {
+      newErrors.email = 'Email is required';
+    }
+    if (!formData.displayName.trim()) {
+      newErrors.displayName = 'Display name is required';
+    }
 
     setErrors(newErrors);
     return Object.keys(newErrors).length === 0;
@@ -129,7 +142,7 @@ const RegisterForm = () => {
     setLoading(true);
 
     // Execute complete registration flow
-    await handleRegistrationFlow(formData.username);
+    await handleRegistrationFlow(formData);
 
     setLoading(false);
   };
@@ -159,6 +172,71 @@ const RegisterForm = () => {
         </div>
       </div>
 
+      <div>
+        <label htmlFor="email" className="block text-sm font-medium text-gray-700">
+          Email
+        </label>
+        <div className="mt-1">
+          <input
+            id="email"
+            name="email"
+            type="email"
+            autoComplete="email"
+            required
+            className={`block w-full appearance-none rounded-md border ${errors.email ? 'border-red-300' : 'border-gray-300'
+              } px-3 py-2 placeholder-gray-400 shadow-sm focus:border-indigo-500 focus:outline-none focus:ring-indigo-500 sm:text-sm`}
+            placeholder="Enter your email"
+            value={formData.email}
+            onChange={handleChange}
+          />
+          {errors.email && (
+            <p className="mt-1 text-sm text-red-600">{errors.email}</p>
+          )}
+        </div>
+      </div>
+
+      <div>
+        <label htmlFor="displayName" className="block text-sm font-medium text-gray-700">
+          Display name
+        </label>
+        <div className="mt-1">
+          <input
+            id="displayName"
+            name="displayName"
+            type="text"
+            autoComplete="name"
+            required
+            className={`block w-full appearance-none rounded-md border ${errors.displayName ? 'border-red-300' : 'border-gray-300'
+              } px-3 py-2 placeholder-gray-400 shadow-sm focus:border-indigo-500 focus:outline-none focus:ring-indigo-500 sm:text-sm`}
+            placeholder="Enter your name"
+            value={formData.displayName}
+            onChange={handleChange}
+          />
+          {errors.displayName && (
+            <p className="mt-1 text-sm text-red-600">{errors.displayName}</p>
+          )}
+        </div>
+      </div>
+
+      <div>
+        <label htmlFor="profile" className="block text-sm font-medium text-gray-700">
+          Authenticator
+        </label>
+        <div className="mt-1">
+          <select
+            id="profile"
+            name="profile"
+            className="block w-full rounded-md border border-gray-300 px-3 py-2 shadow-sm focus:border-indigo-500 focus:outline-none focus:ring-indigo-500 sm:text-sm"
+            value={formData.profile}
+            onChange={handleChange}
+          >
+            <option value="">Any passkey</option>
+            <option value="this-device">This device</option>
+            <option value="security-key">A security key</option>
+          </select>
+        </div>
+      </div>
+
       <div>
         <button
           type="submit"
@@ -1,7 +1,13 @@
 export interface LoginFormData {
   username: string;
+  // Only used to sign in with the password of an account without passkeys
+  password: string;
 }
 
 interface RegisterFormData {
   username: string;
+  email: string;
+  displayName: string;
+  // A registration profile of the tenant, '' for its default policy
+  profile: string;
 }
\ No newline at end of file
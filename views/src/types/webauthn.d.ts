@@ -55,4 +55,5 @@ export interface AuthenticationResponseData {
     userVerification?: any;
     extensions?: any;
   };
+  mediation?: CredentialMediationRequirement;
 }
\ No newline at end of file
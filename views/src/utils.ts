@@ -4,4 +4,66 @@ export const base64UrlToBase64Std = (baseText: string): string => {
 
 export const base64StdToArrayBuffers = (baseText: string): Uint8Array<ArrayBuffer> => {
   return Uint8Array.from(atob(baseText), c => c.charCodeAt(0));
-};
\ No newline at end of file
+};
+
+const base64UrlToArrayBuffer = (baseText: string): Uint8Array<ArrayBuffer> => {
+  return base64StdToArrayBuffers(base64UrlToBase64Std(baseText).padEnd(Math.ceil(baseText.length / 4) * 4, '='));
+};
+
+// The server sends the binary extension inputs of a login, the PRF salt and the
+// large blob to write, base64url encoded.
+export const decodeExtensionInputs = (extensions?: any): AuthenticationExtensionsClientInputs | undefined => {
+  if (!extensions) {
+    return undefined;
+  }
+  const inputs = { ...extensions };
+  if (extensions.prf?.eval?.first) {
+    inputs.prf = { eval: { first: base64UrlToArrayBuffer(extensions.prf.eval.first) } };
+  }
+  if (extensions.largeBlob?.write) {
+    inputs.largeBlob = { write: base64UrlToArrayBuffer(extensions.largeBlob.write) };
+  }
+  return inputs;
+};
+
+// The PRF results and the large blob read are secrets of the client: they are removed
+// before the credential is sent to the server, which only learns they were returned.
+export const credentialForServer = (credential: Credential | null): any => {
+  const json = JSON.parse(JSON.stringify(credential));
+  const outputs = json?.clientExtensionResults;
+  if (outputs?.prf?.results) {
+    outputs.prf.results = {};
+  }
+  if (outputs?.largeBlob?.blob) {
+    delete outputs.largeBlob.blob;
+  }
+  return json;
+};
+
+// derivePrfKey derives an AES-GCM key from the PRF output of a login, for data the
+// client encrypts with the credential.
+export const derivePrfKey = async (credential: Credential | null): Promise<CryptoKey | undefined> => {
+  const first = (credential as PublicKeyCredential | null)?.getClientExtensionResults().prf?.results?.first;
+  if (!first) {
+    return undefined;
+  }
+  const material = await crypto.subtle.importKey('raw', first, 'HKDF', false, ['deriveKey']);
+  return crypto.subtle.deriveKey(
+    { name: 'HKDF', hash: 'SHA-256', salt: new Uint8Array(), info: new TextEncoder().encode('webauthn-example encryption key') },
+    material,
+    { name: 'AES-GCM', length: 256 },
+    false,
+    ['encrypt', 'decrypt'],
+  );
+};
+
+// fetchCSRFToken sets the csrf_token cookie and returns the token, which requests
+// outside the WebAuthn ceremonies send back in the X-CSRF-Token header.
+export const fetchCSRFToken = async (): Promise<string> => {
+  const response = await fetch(`${import.meta.env.VITE_API_URL}/api/v1/csrf`, {
+    mode: 'cors',
+    credentials: 'include',
+  });
+  const { csrfToken } = await response.json();
+  return csrfToken;
+};